@@ -5,6 +5,9 @@ go 1.23.5
 require (
 	github.com/Azure/azure-sdk-for-go/sdk/storage/azblob v1.6.1
 	github.com/gin-gonic/gin v1.10.1
+	github.com/makiuchi-d/gozxing v0.1.1
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/image v0.24.0
 )
 
 require (
@@ -27,7 +30,6 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
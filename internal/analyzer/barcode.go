@@ -0,0 +1,646 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+const (
+	// barcodeBlocksPerSide sets the block size of the bar search to the image's long side
+	// over this count, but at least minBarcodeBlock pixels
+	barcodeBlocksPerSide = 120
+	minBarcodeBlock      = 12
+	// minBarcodeCoherence is the share of a block's gradient energy that must lie along
+	// one direction, as it does across parallel bars; text stays well below it
+	minBarcodeCoherence = 0.8
+	// minBarcodeGradient is the smallest RMS luma gradient of a bar block; moderately
+	// blurred bars stay above it
+	minBarcodeGradient = 8
+	// minSharpBarcodeGradient is the RMS luma gradient of a region below which its bars
+	// are too soft to read unless they plainly cross the sample
+	minSharpBarcodeGradient = 40
+	// maxBarcodeBend is the largest difference in degrees between the bar directions of
+	// neighbouring blocks of one barcode
+	maxBarcodeBend = 12.0
+	// maxBarcodeJoinGap is the widest gap, relative to their height, across which two
+	// groups of bars are joined into one symbol; inside PDF417 symbols the rows break up
+	// the bars, leaving the start and stop columns as separate groups
+	maxBarcodeJoinGap = 20
+	// minBarcodeJoinOverlap is the share of the taller group's extent along the bars that
+	// two joined groups must share
+	minBarcodeJoinOverlap = 0.7
+	// minBarcodeBusyShare is the share of blocks in the gap that must have strong gradients
+	minBarcodeBusyShare = 0.8
+	// minBarcodeBlocks is the smallest number of blocks a barcode covers
+	minBarcodeBlocks = 4
+	// minBarcodeColumnShare is the share of the luma variance across the middle of a
+	// linear barcode explained by its bars; text lines reach about half
+	minBarcodeColumnShare = 0.6
+	// minBarcodeBandCorrelation is the smallest correlation between the column profiles
+	// of the upper and lower quarters of an unreadable linear barcode
+	minBarcodeBandCorrelation = 0.8
+	// maxGratingVariation is the largest coefficient of variation of the bar and of the
+	// space widths of an even grating, which is not taken for an unreadable barcode
+	maxGratingVariation = 0.2
+	// linearBarcodeBands is the number of bands of rows the linear readers try separately
+	linearBarcodeBands = 3
+	// minBarcodeEdges is the smallest number of dark-light edges across a linear barcode;
+	// the shortest symbols (EAN-8) have over 40
+	minBarcodeEdges = 20
+	// barcodeQuietZone pads the bar area along the reading direction by this share of its
+	// length, so the readers see the quiet zones
+	barcodeQuietZone = 0.1
+	// maxBarcodeSample bounds the sides of the upright copy the readers decode
+	maxBarcodeSample = 2400
+)
+
+// BarcodeSymbology names a barcode type
+type BarcodeSymbology string
+
+const (
+	SymbologyCode128 BarcodeSymbology = "code128"
+	SymbologyCode39  BarcodeSymbology = "code39"
+	SymbologyEAN13   BarcodeSymbology = "ean13"
+	SymbologyEAN8    BarcodeSymbology = "ean8"
+	SymbologyUPCA    BarcodeSymbology = "upc_a"
+	SymbologyUPCE    BarcodeSymbology = "upc_e"
+	SymbologyITF     BarcodeSymbology = "itf"
+	SymbologyPDF417  BarcodeSymbology = "pdf417"
+)
+
+// Barcode is a linear barcode or PDF417 symbol found by its bars
+type Barcode struct {
+	// Symbology is empty when a barcode was found but neither decoded nor recognized
+	Symbology BarcodeSymbology `json:"symbology,omitempty"`
+	// Decoded is false when the bars were found but could not be read
+	Decoded bool   `json:"decoded"`
+	Payload string `json:"payload,omitempty"`
+	// Polygon is the outline of the bars clockwise from the top-left corner in reading
+	// direction, in native pixel coordinates
+	Polygon [4]Point `json:"polygon"`
+}
+
+// barcodeFormats maps the formats of the linear readers to symbologies
+var barcodeFormats = map[gozxing.BarcodeFormat]BarcodeSymbology{
+	gozxing.BarcodeFormat_CODE_128: SymbologyCode128,
+	gozxing.BarcodeFormat_CODE_39:  SymbologyCode39,
+	gozxing.BarcodeFormat_EAN_13:   SymbologyEAN13,
+	gozxing.BarcodeFormat_EAN_8:    SymbologyEAN8,
+	gozxing.BarcodeFormat_UPC_A:    SymbologyUPCA,
+	gozxing.BarcodeFormat_UPC_E:    SymbologyUPCE,
+	gozxing.BarcodeFormat_ITF:      SymbologyITF,
+}
+
+// barcodeRegion is an oriented rectangle around a group of bars: origin is its top-left
+// corner, u the reading direction across the bars and v the direction along them
+type barcodeRegion struct {
+	origin         Point
+	u, v           Point
+	length, height float64
+	// gradient is the RMS luma gradient of the region's blocks
+	gradient float64
+}
+
+// at maps a point of the upright sample, in pixels along u and v, to the image
+func (r barcodeRegion) at(x, y float64) Point {
+	return Point{X: r.origin.X + x*r.u.X + y*r.v.X, Y: r.origin.Y + x*r.u.Y + y*r.v.Y}
+}
+
+// polygon returns the outline of the part of the region between x0 and x1 along u
+func (r barcodeRegion) polygon(x0, x1 float64) [4]Point {
+	return [4]Point{r.at(x0, 0), r.at(x1, 0), r.at(x1, r.height), r.at(x0, r.height)}
+}
+
+// detectBarcodes finds areas of parallel bars and decodes them
+func detectBarcodes(gray *image.Gray) []Barcode {
+	var barcodes []Barcode
+	for _, region := range locateBarcodes(gray) {
+		sample := sampleRegion(gray, region)
+		scale := region.length / float64(sample.Bounds().Dx())
+		barcode := Barcode{Polygon: region.polygon(0, region.length)}
+
+		payload, isPDF417, err := decodePDF417(sample)
+		switch {
+		case err == nil:
+			barcode.Symbology, barcode.Decoded, barcode.Payload = SymbologyPDF417, true, payload
+		case isPDF417:
+			barcode.Symbology = SymbologyPDF417
+		case countEdges(sample) < minBarcodeEdges:
+			continue
+		case region.gradient < minSharpBarcodeGradient && !crossingBars(sample):
+			// Blurred text is dropped before the slower readers run
+			continue
+		default:
+			result := decodeLinearBarcode(sample)
+			if result == nil {
+				// Text and textures that pass for bars are dropped here
+				if !crossingBars(sample) {
+					continue
+				}
+				break
+			}
+			barcode.Symbology = barcodeFormats[result.GetBarcodeFormat()]
+			barcode.Decoded = true
+			barcode.Payload = result.GetText()
+			// Narrow the outline to the scanned bars
+			if points := result.GetResultPoints(); len(points) >= 2 {
+				x0, x1 := points[0].GetX(), points[0].GetX()
+				for _, p := range points[1:] {
+					x0, x1 = math.Min(x0, p.GetX()), math.Max(x1, p.GetX())
+				}
+				barcode.Polygon = region.polygon(x0*scale, x1*scale)
+			}
+		}
+		barcodes = append(barcodes, barcode)
+	}
+	return dropOverlapping(barcodes)
+}
+
+// dropOverlapping keeps one of the barcodes whose outlines hold each other's centre,
+// preferring decoded ones; a blurred symbol can break up into overlapping groups
+func dropOverlapping(barcodes []Barcode) []Barcode {
+	sort.SliceStable(barcodes, func(i, j int) bool { return barcodes[i].Decoded && !barcodes[j].Decoded })
+	var kept []Barcode
+	for _, b := range barcodes {
+		overlaps := false
+		for _, k := range kept {
+			if quadContains(k.Polygon, quadCentre(b.Polygon)) || quadContains(b.Polygon, quadCentre(k.Polygon)) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// decodeLinearBarcode tries the linear readers on the upper, middle and lower thirds of
+// an upright sample and returns a result that at least two of them agree on. The check
+// digits of EAN and UPC codes are weak, and text or the rows of a PDF417 symbol can now
+// and then be read as one; they do not read the same along the whole height.
+func decodeLinearBarcode(sample *image.Gray) *gozxing.Result {
+	rect := sample.Bounds()
+	var results []*gozxing.Result
+	for band := 0; band < linearBarcodeBands; band++ {
+		y0 := rect.Min.Y + rect.Dy()*band/linearBarcodeBands
+		y1 := rect.Min.Y + rect.Dy()*(band+1)/linearBarcodeBands
+		result := decodeLinearBand(sample.SubImage(image.Rect(rect.Min.X, y0, rect.Max.X, y1)))
+		if result == nil {
+			continue
+		}
+		for _, earlier := range results {
+			if earlier.GetBarcodeFormat() == result.GetBarcodeFormat() && earlier.GetText() == result.GetText() {
+				return result
+			}
+		}
+		results = append(results, result)
+	}
+	return nil
+}
+
+// decodeLinearBand tries the linear readers on one band of a sample
+func decodeLinearBand(band image.Image) *gozxing.Result {
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+		// Listing UPC-A makes EAN-13 codes with a leading zero come back as UPC-A
+		gozxing.DecodeHintType_POSSIBLE_FORMATS: []gozxing.BarcodeFormat{
+			gozxing.BarcodeFormat_EAN_13, gozxing.BarcodeFormat_UPC_A,
+			gozxing.BarcodeFormat_EAN_8, gozxing.BarcodeFormat_UPC_E,
+		},
+	}
+	readers := []gozxing.Reader{
+		oned.NewCode128Reader(),
+		oned.NewCode39Reader(),
+		oned.NewMultiFormatUPCEANReader(hints),
+		oned.NewITFReader(),
+	}
+	source := gozxing.NewLuminanceSourceFromImage(band)
+	// The global threshold suits the long, even runs of linear codes; the hybrid one
+	// copes with shading across them
+	for _, binarizer := range []gozxing.Binarizer{gozxing.NewGlobalHistgramBinarizer(source), gozxing.NewHybridBinarizer(source)} {
+		bitmap, err := gozxing.NewBinaryBitmap(binarizer)
+		if err != nil {
+			continue
+		}
+		for _, reader := range readers {
+			if result, err := reader.Decode(bitmap, hints); err == nil {
+				return result
+			}
+		}
+	}
+	return nil
+}
+
+// locateBarcodes finds regions of parallel bars. The image is split into blocks; blocks
+// whose gradients are strong and nearly all point the same way are joined with
+// neighbours of the same bar direction, and the groups are joined across busy gaps.
+func locateBarcodes(gray *image.Gray) []barcodeRegion {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	block := max(minBarcodeBlock, max(w, h)/barcodeBlocksPerSide)
+	grid := barcodeGrid{cols: w / block, rows: h / block, block: block}
+	if grid.cols < 2 || grid.rows < 1 {
+		return nil
+	}
+
+	// Structure tensor sums per block
+	size := grid.cols * grid.rows
+	jxx, jyy, jxy := make([]float64, size), make([]float64, size), make([]float64, size)
+	for y := 1; y < grid.rows*block && y < h-1; y++ {
+		row := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):]
+		above := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y-1):]
+		below := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y+1):]
+		base := (y / block) * grid.cols
+		for x := 1; x < grid.cols*block && x < w-1; x++ {
+			// Scharr derivatives, scaled to central differences; their response does not
+			// lean towards the axes on fine bars as plain differences do
+			gx := (3*(float64(above[x+1])-float64(above[x-1])) + 10*(float64(row[x+1])-float64(row[x-1])) + 3*(float64(below[x+1])-float64(below[x-1]))) / 16
+			gy := (3*(float64(below[x-1])-float64(above[x-1])) + 10*(float64(below[x])-float64(above[x])) + 3*(float64(below[x+1])-float64(above[x+1]))) / 16
+			i := base + x/block
+			jxx[i] += gx * gx
+			jyy[i] += gy * gy
+			jxy[i] += gx * gy
+		}
+	}
+
+	// Busy blocks, bar blocks, and the doubled angle of the gradient, which makes opposite
+	// gradients (the two edges of a bar) agree
+	grid.jxx, grid.jyy, grid.jxy = jxx, jyy, jxy
+	grid.busy, grid.bar, grid.angle = make([]bool, size), make([]bool, size), make([]float64, size)
+	n := float64(block * block)
+	for i := range grid.busy {
+		energy := jxx[i] + jyy[i]
+		if energy == 0 || math.Sqrt(energy/n) < minBarcodeGradient {
+			continue
+		}
+		grid.busy[i] = true
+		grid.bar[i] = math.Hypot(jxx[i]-jyy[i], 2*jxy[i])/energy >= minBarcodeCoherence
+		grid.angle[i] = math.Atan2(2*jxy[i], jxx[i]-jyy[i])
+	}
+
+	// Scattered blocks of text and texture are dropped before the groups are joined
+	var groups [][]int
+	for _, group := range grid.components() {
+		if len(group) >= minBarcodeBlocks {
+			groups = append(groups, group)
+		}
+	}
+	for joined := true; joined; {
+		joined = false
+		for i := 0; i < len(groups); i++ {
+			for j := i + 1; j < len(groups); {
+				if grid.continues(groups[i], groups[j]) {
+					groups[i] = append(groups[i], groups[j]...)
+					groups = append(groups[:j], groups[j+1:]...)
+					joined = true
+					continue
+				}
+				j++
+			}
+		}
+	}
+
+	regions := make([]barcodeRegion, 0, len(groups))
+	for _, blocks := range groups {
+		regions = append(regions, grid.region(blocks, rect.Min))
+	}
+	return regions
+}
+
+// barcodeGrid holds the per-block gradient statistics of the bar search
+type barcodeGrid struct {
+	cols, rows, block int
+	// busy blocks have strong gradients; bar blocks also have them nearly all along angle
+	busy, bar []bool
+	angle     []float64
+	// jxx, jyy and jxy are the blocks' structure tensor sums
+	jxx, jyy, jxy []float64
+}
+
+// components groups 8-connected bar blocks with bar directions within maxBarcodeBend
+func (g barcodeGrid) components() [][]int {
+	maxBend := 2 * maxBarcodeBend * math.Pi / 180
+	visited := make([]bool, len(g.bar))
+	var groups [][]int
+	for start := range g.bar {
+		if !g.bar[start] || visited[start] {
+			continue
+		}
+		visited[start] = true
+		group := []int{start}
+		for k := 0; k < len(group); k++ {
+			cx, cy := group[k]%g.cols, group[k]/g.cols
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					x, y := cx+dx, cy+dy
+					if x < 0 || y < 0 || x >= g.cols || y >= g.rows {
+						continue
+					}
+					j := y*g.cols + x
+					if g.bar[j] && !visited[j] && math.Abs(math.Remainder(g.angle[j]-g.angle[group[k]], 2*math.Pi)) <= maxBend {
+						visited[j] = true
+						group = append(group, j)
+					}
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// frame returns the reading direction u across the bars of a group of blocks, pointing
+// right, and the bar direction v. The blocks' tensors are summed, so the strong edges of
+// the bars outweigh stray text blocks.
+func (g barcodeGrid) frame(blocks []int) (u, v Point) {
+	var xx, yy, xy float64
+	for _, i := range blocks {
+		xx += g.jxx[i]
+		yy += g.jyy[i]
+		xy += g.jxy[i]
+	}
+	theta := math.Atan2(2*xy, xx-yy) / 2
+	u = Point{X: math.Cos(theta), Y: math.Sin(theta)}
+	if u.X < 0 || (u.X == 0 && u.Y < 0) {
+		u = Point{X: -u.X, Y: -u.Y}
+	}
+	return u, Point{X: -u.Y, Y: u.X}
+}
+
+// extent returns the range of a group of blocks, corners included, along u and v
+func (g barcodeGrid) extent(blocks []int, u, v Point) (minU, maxU, minV, maxV float64) {
+	minU, maxU, minV, maxV = math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, i := range blocks {
+		bx, by := float64((i%g.cols)*g.block), float64((i/g.cols)*g.block)
+		for _, corner := range [4][2]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			px, py := bx+corner[0]*float64(g.block), by+corner[1]*float64(g.block)
+			pu, pv := px*u.X+py*u.Y, px*v.X+py*v.Y
+			minU, maxU = math.Min(minU, pu), math.Max(maxU, pu)
+			minV, maxV = math.Min(minV, pv), math.Max(maxV, pv)
+		}
+	}
+	return minU, maxU, minV, maxV
+}
+
+// continues reports whether group b continues group a across the reading direction: the
+// same bar direction, side by side along the bars, not too far apart and with busy blocks
+// in between, as the start and stop columns of a PDF417 symbol are
+func (g barcodeGrid) continues(a, b []int) bool {
+	ua, va := g.frame(a)
+	ub, _ := g.frame(b)
+	if math.Abs(ua.X*ub.X+ua.Y*ub.Y) < math.Cos(maxBarcodeBend*math.Pi/180) {
+		return false
+	}
+	aMinU, aMaxU, aMinV, aMaxV := g.extent(a, ua, va)
+	bMinU, bMaxU, bMinV, bMaxV := g.extent(b, ua, va)
+	// The columns of one symbol span the same rows; text lines beside a barcode do not
+	height := math.Max(aMaxV-aMinV, bMaxV-bMinV)
+	if math.Min(aMaxV, bMaxV)-math.Max(aMinV, bMinV) < minBarcodeJoinOverlap*height {
+		return false
+	}
+	// A wide space blurred flat leaves a gap of a block inside a symbol
+	gap := math.Max(bMinU-aMaxU, aMinU-bMaxU)
+	if gap <= float64(g.block) {
+		return true
+	}
+	if gap > maxBarcodeJoinGap*height {
+		return false
+	}
+
+	// The blocks between the two groups along the middle of their overlap
+	mid := (math.Max(aMinV, bMinV) + math.Min(aMaxV, bMaxV)) / 2
+	return g.busyShare(ua, va, math.Min(aMaxU, bMaxU), math.Max(aMinU, bMinU), mid) >= minBarcodeBusyShare
+}
+
+// busyShare returns the share of busy blocks on the line at v from u0 to u1 inside the
+// image
+func (g barcodeGrid) busyShare(u, v Point, u0, u1, at float64) float64 {
+	busy, total := 0, 0
+	for t := u0; t <= u1; t += float64(g.block) / 2 {
+		x := int(math.Floor((t*u.X + at*v.X) / float64(g.block)))
+		y := int(math.Floor((t*u.Y + at*v.Y) / float64(g.block)))
+		if x < 0 || y < 0 || x >= g.cols || y >= g.rows {
+			continue
+		}
+		total++
+		if g.busy[y*g.cols+x] {
+			busy++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(busy) / float64(total)
+}
+
+// region returns the oriented rectangle around a group of blocks, padded along the
+// reading direction for the quiet zones
+func (g barcodeGrid) region(blocks []int, origin image.Point) barcodeRegion {
+	u, v := g.frame(blocks)
+	minU, maxU, minV, maxV := g.extent(blocks, u, v)
+	// Blocks straddling the ends of the bars are partly blank and seldom coherent; take
+	// them in when the strip beyond either end is busy
+	block := float64(g.block)
+	if g.busyShare(u, v, minU, maxU, minV-block/2) >= minBarcodeBusyShare/2 {
+		minV -= block
+	}
+	if g.busyShare(u, v, minU, maxU, maxV+block/2) >= minBarcodeBusyShare/2 {
+		maxV += block
+	}
+	pad := barcodeQuietZone*(maxU-minU) + block
+	minU, maxU = minU-pad, maxU+pad
+	var energy float64
+	for _, i := range blocks {
+		energy += g.jxx[i] + g.jyy[i]
+	}
+	return barcodeRegion{
+		origin: Point{
+			X: float64(origin.X) + minU*u.X + minV*v.X,
+			Y: float64(origin.Y) + minU*u.Y + minV*v.Y,
+		},
+		u:        u,
+		v:        v,
+		length:   maxU - minU,
+		height:   maxV - minV,
+		gradient: math.Sqrt(energy / (float64(len(blocks)) * block * block)),
+	}
+}
+
+// sampleRegion copies a region upright, bars vertical, with bilinear sampling; the
+// outside of the image is white
+func sampleRegion(gray *image.Gray, r barcodeRegion) *image.Gray {
+	scale := math.Max(1, math.Max(r.length, r.height)/maxBarcodeSample)
+	w, h := max(1, int(r.length/scale)), max(1, int(r.height/scale))
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	rect := gray.Bounds()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := r.at((float64(x)+0.5)*scale, (float64(y)+0.5)*scale)
+			sx, sy := p.X-0.5, p.Y-0.5
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < rect.Min.X || y0 < rect.Min.Y || x0+1 >= rect.Max.X || y0+1 >= rect.Max.Y {
+				out.Pix[y*out.Stride+x] = 255
+				continue
+			}
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			i := gray.PixOffset(x0, y0)
+			top := float64(gray.Pix[i])*(1-fx) + float64(gray.Pix[i+1])*fx
+			bottom := float64(gray.Pix[i+gray.Stride])*(1-fx) + float64(gray.Pix[i+gray.Stride+1])*fx
+			out.Pix[y*out.Stride+x] = uint8(top*(1-fy) + bottom*fy + 0.5)
+		}
+	}
+	return out
+}
+
+// crossingBars reports whether bars run across an upright sample: the column means of
+// the middle half of its rows explain most of their variance, and the column profiles
+// of its upper and lower quarters match. Text lines fail both, and the bars must not
+// form an even grating.
+func crossingBars(sample *image.Gray) bool {
+	rect := sample.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	if h < 8 {
+		return false
+	}
+	profile := func(y0, y1 int) []float64 {
+		columns := make([]float64, w)
+		for y := y0; y < y1; y++ {
+			for x, v := range sample.Pix[y*sample.Stride : y*sample.Stride+w] {
+				columns[x] += float64(v)
+			}
+		}
+		for x := range columns {
+			columns[x] /= float64(y1 - y0)
+		}
+		return columns
+	}
+
+	// Variance explained by the column means across the middle half
+	y0, y1 := h/4, h*3/4
+	middle := profile(y0, y1)
+	var total, totalSq, between float64
+	for y := y0; y < y1; y++ {
+		for _, v := range sample.Pix[y*sample.Stride : y*sample.Stride+w] {
+			total += float64(v)
+			totalSq += float64(v) * float64(v)
+		}
+	}
+	n := float64(w * (y1 - y0))
+	mean := total / n
+	variance := totalSq/n - mean*mean
+	if variance <= 0 {
+		return false
+	}
+	for _, m := range middle {
+		between += (m - mean) * (m - mean)
+	}
+	if between/float64(w)/variance < minBarcodeColumnShare {
+		return false
+	}
+
+	// Pearson correlation of the upper and lower column profiles
+	upper, lower := profile(h/8, h*3/8), profile(h*5/8, h*7/8)
+	var mu, ml float64
+	for x := range upper {
+		mu += upper[x]
+		ml += lower[x]
+	}
+	mu, ml = mu/float64(w), ml/float64(w)
+	var sul, suu, sll float64
+	for x := range upper {
+		du, dl := upper[x]-mu, lower[x]-ml
+		sul += du * dl
+		suu += du * du
+		sll += dl * dl
+	}
+	if suu == 0 || sll == 0 || sul/math.Sqrt(suu*sll) < minBarcodeBandCorrelation {
+		return false
+	}
+	return !evenGrating(middle)
+}
+
+// evenGrating reports whether the dark and light runs of a column profile, split at its
+// mean, each have nearly the same width, as ruled lines and blurred lines of text do.
+// The bars and spaces of a barcode come in several widths.
+func evenGrating(profile []float64) bool {
+	mean := 0.0
+	for _, v := range profile {
+		mean += v
+	}
+	mean /= float64(len(profile))
+
+	// Runs between the first and the last whole dark one; the quiet zones and the runs
+	// cut off by the ends of the sample are left out
+	var widths []float64
+	darkFirst := false
+	start := 0
+	for x := 1; x < len(profile); x++ {
+		if (profile[x] < mean) == (profile[x-1] < mean) {
+			continue
+		}
+		if start > 0 {
+			if len(widths) == 0 {
+				darkFirst = profile[start] < mean
+			}
+			widths = append(widths, float64(x-start))
+		}
+		start = x
+	}
+	if len(widths) > 0 && !darkFirst {
+		widths = widths[1:]
+	}
+	if len(widths)%2 == 0 && len(widths) > 0 {
+		widths = widths[:len(widths)-1]
+	}
+	var dark, light []float64
+	for k, w := range widths {
+		if k%2 == 0 {
+			dark = append(dark, w)
+		} else {
+			light = append(light, w)
+		}
+	}
+	if len(dark) < 3 || len(light) < 2 {
+		return false
+	}
+	variation := func(widths []float64) float64 {
+		var sum, sq float64
+		for _, w := range widths {
+			sum, sq = sum+w, sq+w*w
+		}
+		n := float64(len(widths))
+		return math.Sqrt(math.Max(0, sq/n-sum*sum/n/n)) / (sum / n)
+	}
+	return math.Max(variation(dark), variation(light)) < maxGratingVariation
+}
+
+// countEdges counts the dark-light changes along the middle row of an upright sample
+func countEdges(sample *image.Gray) int {
+	rect := sample.Bounds()
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range sample.Pix[sample.PixOffset(rect.Min.X, y):sample.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+	threshold := uint8(otsuThreshold(hist[:]))
+	row := sample.Pix[sample.PixOffset(rect.Min.X, rect.Min.Y+rect.Dy()/2):sample.PixOffset(rect.Max.X, rect.Min.Y+rect.Dy()/2)]
+	edges := 0
+	for x := 1; x < len(row); x++ {
+		if (row[x] <= threshold) != (row[x-1] <= threshold) {
+			edges++
+		}
+	}
+	return edges
+}
+
+// applyBarcodeAnalysis records the barcodes in the image
+func (a *imageAnalyzer) applyBarcodeAnalysis(gray *image.Gray, result *AnalysisResult) {
+	result.Barcodes = detectBarcodes(gray)
+}
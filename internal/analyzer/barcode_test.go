@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+// linearModules encodes contents with one of gozxing's writers and returns the modules
+// of the symbol, true for bars
+func linearModules(t *testing.T, writer gozxing.Writer, format gozxing.BarcodeFormat, contents string) []bool {
+	t.Helper()
+	hints := map[gozxing.EncodeHintType]interface{}{gozxing.EncodeHintType_MARGIN: 0}
+	matrix, err := writer.Encode(contents, format, 0, 1, hints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := make([]bool, matrix.GetWidth())
+	for x := range modules {
+		modules[x] = matrix.Get(x, 0)
+	}
+	return modules
+}
+
+// barcodePage draws modules of the given width in pixels on a page, 150 pixels tall from
+// (100, 150), and returns the page with the rectangle of the bars
+func barcodePage(modules []bool, module int) (*image.Gray, image.Rectangle) {
+	page := newPage(1000, 500, 235)
+	for i, bar := range modules {
+		if bar {
+			fillRect(page, image.Rect(100+module*i, 150, 100+module*(i+1), 300), 30)
+		}
+	}
+	return page, image.Rect(100, 150, 100+module*len(modules), 300)
+}
+
+// linearSymbols are symbols from gozxing's writers with the payloads read back
+var linearSymbols = []struct {
+	name      string
+	writer    gozxing.Writer
+	format    gozxing.BarcodeFormat
+	contents  string
+	symbology BarcodeSymbology
+	payload   string
+}{
+	{"code128", oned.NewCode128Writer(), gozxing.BarcodeFormat_CODE_128, "INV-2024-00417", SymbologyCode128, "INV-2024-00417"},
+	{"code39", oned.NewCode39Writer(), gozxing.BarcodeFormat_CODE_39, "PART 77A", SymbologyCode39, "PART 77A"},
+	{"ean13", oned.NewEAN13Writer(), gozxing.BarcodeFormat_EAN_13, "4006381333931", SymbologyEAN13, "4006381333931"},
+	{"ean8", oned.NewEAN8Writer(), gozxing.BarcodeFormat_EAN_8, "96385074", SymbologyEAN8, "96385074"},
+	{"upc-a", oned.NewUPCAWriter(), gozxing.BarcodeFormat_UPC_A, "036000291452", SymbologyUPCA, "036000291452"},
+	{"upc-e", oned.NewUPCEWriter(), gozxing.BarcodeFormat_UPC_E, "01234565", SymbologyUPCE, "01234565"},
+	{"itf", oned.NewITFWriter(), gozxing.BarcodeFormat_ITF, "12345678901231", SymbologyITF, "12345678901231"},
+}
+
+func TestDetectLinearBarcodes(t *testing.T) {
+	for _, tt := range linearSymbols {
+		t.Run(tt.name, func(t *testing.T) {
+			page, bars := barcodePage(linearModules(t, tt.writer, tt.format, tt.contents), 3)
+			addNoise(page, 2, rand.New(rand.NewSource(1)))
+			for _, angle := range []float64{0, 12} {
+				img := page
+				if angle != 0 {
+					img = rotateGray(page, angle, 235)
+				}
+				barcodes := detectBarcodes(img)
+				if len(barcodes) != 1 {
+					t.Fatalf("at %.0f°: found %d barcodes, want 1: %+v", angle, len(barcodes), barcodes)
+				}
+				b := barcodes[0]
+				if !b.Decoded || b.Symbology != tt.symbology || b.Payload != tt.payload {
+					t.Errorf("at %.0f°: read %s %q (decoded %v), want %s %q", angle, b.Symbology, b.Payload, b.Decoded, tt.symbology, tt.payload)
+				}
+				if angle == 0 {
+					centre := Point{float64(bars.Min.X+bars.Max.X) / 2, float64(bars.Min.Y+bars.Max.Y) / 2}
+					if !quadContains(b.Polygon, centre) {
+						t.Errorf("outline %v misses the centre of the bars at %v", b.Polygon, centre)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDetectBlurredBarcodes(t *testing.T) {
+	// A three-pass box blur of radius 2 on 3-pixel modules leaves the bars visible
+	// but too soft to read
+	for _, tt := range linearSymbols {
+		if tt.symbology != SymbologyCode128 && tt.symbology != SymbologyEAN13 && tt.symbology != SymbologyITF {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			page, bars := barcodePage(linearModules(t, tt.writer, tt.format, tt.contents), 3)
+			barcodes := detectBarcodes(boxBlur(page, 2))
+			if len(barcodes) != 1 {
+				t.Fatalf("found %d barcodes, want 1: %+v", len(barcodes), barcodes)
+			}
+			b := barcodes[0]
+			if b.Decoded || b.Symbology != "" || b.Payload != "" {
+				t.Errorf("read %s %q (decoded %v) from a blurred symbol", b.Symbology, b.Payload, b.Decoded)
+			}
+			centre := Point{float64(bars.Min.X+bars.Max.X) / 2, float64(bars.Min.Y+bars.Max.Y) / 2}
+			if !quadContains(b.Polygon, centre) {
+				t.Errorf("outline %v misses the centre of the bars at %v", b.Polygon, centre)
+			}
+		})
+	}
+}
+
+func TestDetectBarcodesIgnoresText(t *testing.T) {
+	text := textPage(1600, 1200, rand.New(rand.NewSource(1)))
+	// Small text blurs into even bands and ruled lines make an even grating; neither has
+	// the bars and spaces of several widths a barcode has
+	small := newPage(1600, 1200, 235)
+	drawText(small, image.Rect(100, 100, 1500, 1100), 8, rand.New(rand.NewSource(2)))
+	ruled := newPage(1600, 1200, 235)
+	for y := 100; y < 1100; y += 12 {
+		fillRect(ruled, image.Rect(100, y, 1500, y+2), 60)
+	}
+	tests := []struct {
+		name string
+		img  *image.Gray
+	}{
+		{"text", text},
+		{"skewed text", rotateGray(text, 7, 235)},
+		{"blurred text", boxBlur(text, 2)},
+		{"blurred small text", boxBlur(small, 2)},
+		{"ruled lines", ruled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if barcodes := detectBarcodes(tt.img); len(barcodes) != 0 {
+				t.Errorf("found %d barcodes: %+v", len(barcodes), barcodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package analyzer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// DefaultBinarizationWindow is the side length in pixels of the neighbourhood the
+	// local methods take their statistics from; it should span a few text strokes
+	DefaultBinarizationWindow = 31
+	// MaxBinarizationWindow bounds the window side length
+	MaxBinarizationWindow = 255
+	// sauvolaK and sauvolaRange are Sauvola's sensitivity and the dynamic range of the
+	// standard deviation; larger k keeps faint strokes out of the ink
+	sauvolaK     = 0.2
+	sauvolaRange = 128.0
+	// niblackK is Niblack's offset in standard deviations below the local mean
+	niblackK = -0.2
+)
+
+// BinarizationMethod selects how the threshold between ink and background is chosen
+type BinarizationMethod string
+
+const (
+	// BinarizeOtsu uses one global threshold that best separates the two luma classes
+	BinarizeOtsu BinarizationMethod = "otsu"
+	// BinarizeSauvola thresholds each pixel against its neighbourhood's mean, lowered
+	// where the neighbourhood is flat; it copes with shading and keeps blank paper clean
+	BinarizeSauvola BinarizationMethod = "sauvola"
+	// BinarizeNiblack thresholds each pixel at its neighbourhood's mean minus a share of
+	// the standard deviation; it keeps faint strokes but turns noise on blank paper to ink
+	BinarizeNiblack BinarizationMethod = "niblack"
+)
+
+// ParseBinarizationMethod converts a request value into a BinarizationMethod, defaulting
+// to BinarizeSauvola
+func ParseBinarizationMethod(value string) (BinarizationMethod, error) {
+	switch BinarizationMethod(value) {
+	case "":
+		return BinarizeSauvola, nil
+	case BinarizeOtsu, BinarizeSauvola, BinarizeNiblack:
+		return BinarizationMethod(value), nil
+	default:
+		return "", fmt.Errorf("unsupported binarization method %q (expected otsu, sauvola or niblack)", value)
+	}
+}
+
+// BinarizeOptions configures a binarization
+type BinarizeOptions struct {
+	Method BinarizationMethod
+	// Window is the odd side length of the local methods' neighbourhood (0 = DefaultBinarizationWindow)
+	Window int
+}
+
+// Validate checks that the options are within supported ranges
+func (o BinarizeOptions) Validate() error {
+	if _, err := ParseBinarizationMethod(string(o.Method)); err != nil {
+		return err
+	}
+	if o.Window != 0 && (o.Window < 3 || o.Window > MaxBinarizationWindow || o.Window%2 == 0) {
+		return fmt.Errorf("binarization window must be an odd number between 3 and %d", MaxBinarizationWindow)
+	}
+	return nil
+}
+
+// bilevelPalette is the palette of binarized images: index 0 is ink, 1 is background
+var bilevelPalette = color.Palette{color.Gray{Y: 0}, color.Gray{Y: 255}}
+
+// binarize splits gray into ink and background. The result is a two-colour paletted
+// image, which the PNG encoder writes with one bit per pixel.
+func binarize(gray *image.Gray, opts BinarizeOptions) *image.Paletted {
+	method, _ := ParseBinarizationMethod(string(opts.Method))
+	rect := gray.Bounds()
+	out := image.NewPaletted(rect, bilevelPalette)
+
+	if method == BinarizeOtsu {
+		var hist [256]int
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+				hist[v]++
+			}
+		}
+		threshold := uint8(otsuThreshold(hist[:]))
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			src := gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)]
+			dst := out.Pix[out.PixOffset(rect.Min.X, y):]
+			for x, v := range src {
+				if v > threshold {
+					dst[x] = 1
+				}
+			}
+		}
+		return out
+	}
+
+	window := opts.Window
+	if window == 0 {
+		window = DefaultBinarizationWindow
+	}
+	forEachLocalStat(gray, window/2, func(x, y int, v uint8, mean, stddev float64) {
+		var threshold float64
+		if method == BinarizeNiblack {
+			threshold = mean + niblackK*stddev
+		} else {
+			threshold = mean * (1 + sauvolaK*(stddev/sauvolaRange-1))
+		}
+		if float64(v) >= threshold {
+			out.Pix[out.PixOffset(x, y)] = 1
+		}
+	})
+	return out
+}
+
+// forEachLocalStat calls fn for every pixel of gray with the mean and standard deviation
+// of the (2*radius+1)-pixel square around it, clipped to the image. Running column sums
+// over the window's rows keep the cost per pixel constant and the memory to one row.
+func forEachLocalStat(gray *image.Gray, radius int, fn func(x, y int, v uint8, mean, stddev float64)) {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	colSum := make([]uint32, w)
+	colSq := make([]uint32, w)
+	prefixSum := make([]uint64, w+1)
+	prefixSq := make([]uint64, w+1)
+
+	row := func(y int) []uint8 {
+		return gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):gray.PixOffset(rect.Max.X, rect.Min.Y+y)]
+	}
+	for y := 0; y < min(radius, h); y++ {
+		for x, v := range row(y) {
+			colSum[x] += uint32(v)
+			colSq[x] += uint32(v) * uint32(v)
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		// Slide the window's rows: add the row entering below, drop the one leaving above
+		if enter := y + radius; enter < h {
+			for x, v := range row(enter) {
+				colSum[x] += uint32(v)
+				colSq[x] += uint32(v) * uint32(v)
+			}
+		}
+		if leave := y - radius - 1; leave >= 0 {
+			for x, v := range row(leave) {
+				colSum[x] -= uint32(v)
+				colSq[x] -= uint32(v) * uint32(v)
+			}
+		}
+		rows := min(h-1, y+radius) - max(0, y-radius) + 1
+
+		for x := 0; x < w; x++ {
+			prefixSum[x+1] = prefixSum[x] + uint64(colSum[x])
+			prefixSq[x+1] = prefixSq[x] + uint64(colSq[x])
+		}
+		src := row(y)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(0, x-radius), min(w, x+radius+1)
+			n := float64(rows * (x1 - x0))
+			mean := float64(prefixSum[x1]-prefixSum[x0]) / n
+			variance := float64(prefixSq[x1]-prefixSq[x0])/n - mean*mean
+			fn(rect.Min.X+x, rect.Min.Y+y, src[x], mean, math.Sqrt(math.Max(0, variance)))
+		}
+	}
+}
+
+// inkRatio returns the share of ink pixels of a binarized image within rect
+func inkRatio(bin *image.Paletted, rect image.Rectangle) float64 {
+	rect = rect.Intersect(bin.Bounds())
+	if rect.Empty() {
+		return 0
+	}
+	ink := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range bin.Pix[bin.PixOffset(rect.Min.X, y):bin.PixOffset(rect.Max.X, y)] {
+			if v == 0 {
+				ink++
+			}
+		}
+	}
+	return float64(ink) / float64(rect.Dx()*rect.Dy())
+}
@@ -0,0 +1,109 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+// Blank verdicts reported in AnalysisResult.BlankVerdict
+const (
+	BlankVerdictBlank     = "BLANK"
+	BlankVerdictNearBlank = "NEAR_BLANK"
+	BlankVerdictContent   = "CONTENT"
+)
+
+const (
+	// blankMargin is the share of the document cut from each side before it is measured,
+	// so page edges and their shadows do not count while footers still do
+	blankMargin = 0.03
+	// blankContentInk, blankContentEdges and blankContentDetail are the ink ratio, edge
+	// density and detail sigma at which each measure alone shows content in full
+	blankContentInk    = 0.01
+	blankContentEdges  = 0.01
+	blankContentDetail = 10.0
+	// blankNoiseDetail is the detail sigma of plain paper, sensor noise, show-through and
+	// wood grain, below which the detail measure shows nothing
+	blankNoiseDetail = 4.0
+	// blankInkWeight, blankEdgeWeight and blankDetailWeight weigh the measures in the
+	// content score
+	blankInkWeight    = 0.5
+	blankEdgeWeight   = 0.3
+	blankDetailWeight = 0.2
+	// maxBlankScore and maxNearBlankScore are the highest content scores of blank and
+	// near-blank images; a single page number scores about 0.05, and blank pages can be
+	// skipped unseen, so any mark keeps a page out of the blank class
+	maxBlankScore     = 0.04
+	maxNearBlankScore = 0.4
+)
+
+// blankMeasures holds the content measures of the inner document area
+type blankMeasures struct {
+	// ink is the share of ink pixels, edges the share of pixels on strong edges, and
+	// detail the luma standard deviation around the local mean, which ignores shading
+	ink, edges, detail float64
+}
+
+// measureBlankness measures the inner part of the document on the region level. bin is
+// the level binarized with Sauvola's method.
+func measureBlankness(level *regionLevel, bin *image.Paletted) blankMeasures {
+	gray := level.gray
+	area, inside := level.innerDocument(blankMargin)
+	area = area.Intersect(gray.Bounds().Inset(1))
+
+	var pixels, ink, edges int
+	var residual float64
+	forEachLocalStat(gray, DefaultBinarizationWindow/2, func(x, y int, v uint8, mean, _ float64) {
+		if !(image.Point{X: x, Y: y}).In(area) || !inside(x, y) {
+			return
+		}
+		pixels++
+		if bin.Pix[bin.PixOffset(x, y)] == 0 {
+			ink++
+		}
+		i := gray.PixOffset(x, y)
+		gx := int(gray.Pix[i+1]) - int(gray.Pix[i-1])
+		gy := int(gray.Pix[i+gray.Stride]) - int(gray.Pix[i-gray.Stride])
+		if gx*gx+gy*gy > documentEdgeThreshold*documentEdgeThreshold {
+			edges++
+		}
+		d := float64(v) - mean
+		residual += d * d
+	})
+	if pixels == 0 {
+		return blankMeasures{}
+	}
+	n := float64(pixels)
+	return blankMeasures{ink: float64(ink) / n, edges: float64(edges) / n, detail: math.Sqrt(residual / n)}
+}
+
+// score combines the measures into a 0-1 content score. Each measure counts in full once
+// it reaches the level of a sparse text page and by its square root below that, so a
+// page number or a signature on an otherwise empty page still counts.
+func (m blankMeasures) score() float64 {
+	share := func(v, full float64) float64 { return math.Sqrt(math.Max(0, math.Min(1, v/full))) }
+	return blankInkWeight*share(m.ink, blankContentInk) +
+		blankEdgeWeight*share(m.edges, blankContentEdges) +
+		blankDetailWeight*share(m.detail-blankNoiseDetail, blankContentDetail-blankNoiseDetail)
+}
+
+// classifyBlankness returns the verdict for a content score and a confidence from 0.5 on
+// a class boundary to 1 at the far end of the class
+func classifyBlankness(score float64) (verdict string, confidence float64) {
+	switch {
+	case score <= maxBlankScore:
+		return BlankVerdictBlank, 0.5 + 0.5*(maxBlankScore-score)/maxBlankScore
+	case score <= maxNearBlankScore:
+		half := (maxNearBlankScore - maxBlankScore) / 2
+		return BlankVerdictNearBlank, 0.5 + 0.5*math.Min(score-maxBlankScore, maxNearBlankScore-score)/half
+	default:
+		return BlankVerdictContent, 0.5 + 0.5*math.Min(1, (score-maxNearBlankScore)/(1-maxNearBlankScore))
+	}
+}
+
+// applyBlankAnalysis classifies the document area as blank, near-blank or content
+func (a *imageAnalyzer) applyBlankAnalysis(level *regionLevel, bin *image.Paletted, result *AnalysisResult) {
+	m := measureBlankness(level, bin)
+	result.EdgeDensity = m.edges
+	result.DetailSigma = m.detail
+	result.BlankVerdict, result.BlankConfidence = classifyBlankness(m.score())
+}
@@ -0,0 +1,68 @@
+package analyzer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// tablePhoto returns a photo of an empty wooden table: broad, wavy grain under light that
+// falls off toward one corner, with sensor noise; the tones stay well inside 0-255
+func tablePhoto(w, h int, r *rand.Rand) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			grain := 12 * math.Sin(float64(x)/35+3*math.Sin(float64(y)/150))
+			light := 1 - 0.25*float64(x+y)/float64(w+h)
+			v := (150 + grain) * light
+			noise := r.NormFloat64() * 2
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(v + 25 + noise),
+				G: uint8(v + noise),
+				B: uint8(v - 30 + noise),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func TestBlankVerdict(t *testing.T) {
+	a := newTestAnalyzer(t)
+
+	white := newPage(1200, 1600, 235)
+	addNoise(white, 2, rand.New(rand.NewSource(1)))
+	// A page number in the footer of an otherwise empty page
+	numbered := newPage(1200, 1600, 235)
+	drawText(numbered, image.Rect(580, 1480, 620, 1500), 16, rand.New(rand.NewSource(2)))
+	addNoise(numbered, 2, rand.New(rand.NewSource(3)))
+	text := textPage(1200, 1600, rand.New(rand.NewSource(4)))
+	addNoise(text, 2, rand.New(rand.NewSource(5)))
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		verdict string
+	}{
+		{"white page", white, BlankVerdictBlank},
+		{"page number only", numbered, BlankVerdictNearBlank},
+		{"text page", text, BlankVerdictContent},
+		{"empty table", tablePhoto(1600, 1200, rand.New(rand.NewSource(6))), BlankVerdictBlank},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Batch requests classify pages with a fast pass before the full analysis
+			for _, mode := range []AnalysisMode{ModeFast, ModeAccurate} {
+				result := a.AnalyzeWithOptions(tt.img, AnalysisOptions{Mode: mode})
+				if result.BlankVerdict != tt.verdict {
+					t.Errorf("%s mode: verdict %s (confidence %.2f), want %s", mode, result.BlankVerdict, result.BlankConfidence, tt.verdict)
+				}
+				if result.BlankConfidence < 0.5 || result.BlankConfidence > 1 {
+					t.Errorf("%s mode: confidence %.2f outside 0.5-1", mode, result.BlankConfidence)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package analyzer
+
+import "math"
+
+// Colour verdicts reported in AnalysisResult.ColorVerdict
+const (
+	ColorVerdictOriginal   = "COLOR_ORIGINAL"
+	ColorVerdictGrayscale  = "GRAYSCALE_PHOTO"
+	ColorVerdictMonochrome = "MONOCHROME_COPY"
+)
+
+const (
+	// colorMargin is the share of the document cut from each side before its colours are
+	// measured, so the table around the document does not count
+	colorMargin = 0.03
+	// colorPixelChroma is the distance in opponent colour units (0-255) from the mean
+	// chroma of the document at which a pixel counts as coloured; measuring from the mean
+	// ignores the cast of the light on a gray copy
+	colorPixelChroma = 20.0
+	// minColorfulness is the Hasler–Süsstrunk colourfulness of a slightly colourful image,
+	// which a colour original must reach
+	minColorfulness = 15.0
+	// minColorPixelRatio is the share of coloured pixels a colour original must have;
+	// printed seals, photos and security backgrounds of cards reach it
+	minColorPixelRatio = 0.02
+	// maxCopyMidtones is the largest share of midtones in a monochrome copy, which turns
+	// the tones of the original into paper and toner
+	maxCopyMidtones = 0.15
+)
+
+// colorMeasures holds the colour measures of the inner document area
+type colorMeasures struct {
+	// colorfulness is the Hasler–Süsstrunk metric, colorRatio the share of coloured
+	// pixels and midtones the share of luma values in the middle half between ink and paper
+	colorfulness, colorRatio, midtones float64
+}
+
+// measureColorfulness measures the inner part of the document on the region level in
+// the opponent colour axes rg = R-G and yb = (R+G)/2-B. The light tints paper and toner
+// alike, so the channels are first scaled to turn the white patch gray (von Kries);
+// without a white patch the image is measured as it is.
+func measureColorfulness(level *regionLevel) colorMeasures {
+	rgba := level.rgba
+	area, inside := level.innerDocument(colorMargin)
+	area = area.Intersect(rgba.Bounds())
+
+	gains := [3]float64{1, 1, 1}
+	if r, g, b, ok := whitePatch(rgba); ok {
+		gray := (r + g + b) / 3
+		gains = [3]float64{gray / math.Max(r, 1), gray / math.Max(g, 1), gray / math.Max(b, 1)}
+	}
+	balanced := func(p []uint8) (r, g, b float64) {
+		return float64(p[0]) * gains[0], float64(p[1]) * gains[1], float64(p[2]) * gains[2]
+	}
+
+	var n float64
+	var sumRG, sumYB, sqRG, sqYB float64
+	var hist [256]int
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if !inside(x, y) {
+				continue
+			}
+			p := rgba.Pix[rgba.PixOffset(x, y):]
+			r, g, b := balanced(p)
+			rg, yb := r-g, (r+g)/2-b
+			sumRG, sumYB = sumRG+rg, sumYB+yb
+			sqRG, sqYB = sqRG+rg*rg, sqYB+yb*yb
+			hist[(299*int(p[0])+587*int(p[1])+114*int(p[2])+500)/1000]++
+			n++
+		}
+	}
+	if n == 0 {
+		return colorMeasures{}
+	}
+	meanRG, meanYB := sumRG/n, sumYB/n
+	sigma := math.Sqrt(math.Max(0, varianceOf(sumRG, sqRG, n)) + math.Max(0, varianceOf(sumYB, sqYB, n)))
+	m := colorMeasures{colorfulness: sigma + 0.3*math.Hypot(meanRG, meanYB)}
+
+	var colored int
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if !inside(x, y) {
+				continue
+			}
+			r, g, b := balanced(rgba.Pix[rgba.PixOffset(x, y):])
+			if math.Hypot(r-g-meanRG, (r+g)/2-b-meanYB) > colorPixelChroma {
+				colored++
+			}
+		}
+	}
+	m.colorRatio = float64(colored) / n
+
+	ink, paper := percentileFromHistogram(hist[:], 0.05), percentileFromHistogram(hist[:], 0.95)
+	quarter := float64(paper-ink) / 4
+	var mid int
+	for v, count := range hist {
+		if float64(v) > float64(ink)+quarter && float64(v) < float64(paper)-quarter {
+			mid += count
+		}
+	}
+	m.midtones = float64(mid) / n
+	return m
+}
+
+// verdict classifies the document as a colour original, or without colour as a
+// monochrome copy when its tones are reduced to paper and toner and as a grayscale photo
+// otherwise
+func (m colorMeasures) verdict() string {
+	switch {
+	case m.colorfulness >= minColorfulness && m.colorRatio >= minColorPixelRatio:
+		return ColorVerdictOriginal
+	case m.midtones <= maxCopyMidtones:
+		return ColorVerdictMonochrome
+	default:
+		return ColorVerdictGrayscale
+	}
+}
+
+// applyColorfulnessAnalysis classifies the document area as a colour original, a
+// grayscale photo or a monochrome copy
+func (a *imageAnalyzer) applyColorfulnessAnalysis(level *regionLevel, profile QualityProfile, result *AnalysisResult) {
+	m := measureColorfulness(level)
+	result.Colorfulness = m.colorfulness
+	result.ColorPixelRatio = m.colorRatio
+	result.ColorVerdict = m.verdict()
+	result.NotColorOriginal = profile.RequireColorOriginal && result.ColorVerdict != ColorVerdictOriginal
+}
@@ -0,0 +1,75 @@
+package analyzer
+
+import "image"
+
+// component is a 4-connected region of set pixels in a binary mask
+type component struct {
+	bounds image.Rectangle
+	area   int
+	// label is the value of the component's pixels in the label map
+	label int32
+}
+
+// labelComponents finds the 4-connected components of a row-major w x h mask,
+// ignoring components smaller than minArea pixels
+func labelComponents(mask []bool, w, h, minArea int) []component {
+	_, components := labelComponentMap(mask, w, h, minArea)
+	return components
+}
+
+// labelComponentMap is labelComponents that also returns the label of every pixel:
+// 0 for unset pixels and a positive label per component, including ignored ones
+func labelComponentMap(mask []bool, w, h, minArea int) ([]int32, []component) {
+	labels := make([]int32, len(mask))
+	var components []component
+	stack := make([]int, 0, 1024)
+	next := int32(0)
+
+	for start := range mask {
+		if !mask[start] || labels[start] != 0 {
+			continue
+		}
+
+		next++
+		comp := component{bounds: image.Rect(start%w, start/w, start%w+1, start/w+1), label: next}
+		labels[start] = next
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			comp.area++
+			comp.bounds = comp.bounds.Union(image.Rect(x, y, x+1, y+1))
+
+			if x > 0 && mask[i-1] && labels[i-1] == 0 {
+				labels[i-1] = next
+				stack = append(stack, i-1)
+			}
+			if x < w-1 && mask[i+1] && labels[i+1] == 0 {
+				labels[i+1] = next
+				stack = append(stack, i+1)
+			}
+			if y > 0 && mask[i-w] && labels[i-w] == 0 {
+				labels[i-w] = next
+				stack = append(stack, i-w)
+			}
+			if y < h-1 && mask[i+w] && labels[i+w] == 0 {
+				labels[i+w] = next
+				stack = append(stack, i+w)
+			}
+		}
+
+		if comp.area >= minArea {
+			components = append(components, comp)
+		}
+	}
+	return labels, components
+}
+
+// scaleRect maps a rectangle from a downscaled level back to native coordinates
+func scaleRect(r image.Rectangle, scale float64, origin image.Point) image.Rectangle {
+	return image.Rect(
+		origin.X+int(float64(r.Min.X)*scale), origin.Y+int(float64(r.Min.Y)*scale),
+		origin.X+int(float64(r.Max.X)*scale+0.5), origin.Y+int(float64(r.Max.Y)*scale+0.5),
+	)
+}
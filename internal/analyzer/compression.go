@@ -0,0 +1,264 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+// standardLumaQuant and standardChromaQuant are the IJG base quantization tables
+// (JPEG Annex K) in natural order; libjpeg and most encoders scale them by quality
+var standardLumaQuant = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+var standardChromaQuant = [64]int{
+	17, 18, 24, 47, 99, 99, 99, 99,
+	18, 21, 26, 66, 99, 99, 99, 99,
+	24, 26, 56, 99, 99, 99, 99, 99,
+	47, 66, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+}
+
+// zigzag maps the position of a coefficient in a DQT segment to its natural-order index
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// parseJPEGQuantTables extracts the quantization tables (natural order, indexed by
+// table id) from the DQT segments of a JPEG file. It returns nil when data is not a
+// JPEG or contains no tables.
+func parseJPEGQuantTables(data []byte) map[int][64]int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	tables := make(map[int][64]int)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return tables
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			pos++
+			continue
+		case marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Markers without a length field
+			pos += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// Start of scan or end of image: no more tables before the entropy-coded data
+			return tables
+		}
+
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return tables
+		}
+
+		if marker == 0xDB {
+			segment := data[pos+4 : end]
+			for len(segment) > 0 {
+				precision, id := segment[0]>>4, int(segment[0]&0x0F)
+				size := 64
+				if precision == 1 {
+					size = 128
+				}
+				if len(segment) < 1+size {
+					break
+				}
+				var table [64]int
+				for k := 0; k < 64; k++ {
+					if precision == 1 {
+						table[zigzag[k]] = int(segment[1+2*k])<<8 | int(segment[2+2*k])
+					} else {
+						table[zigzag[k]] = int(segment[1+k])
+					}
+				}
+				tables[id] = table
+				segment = segment[1+size:]
+			}
+		}
+		pos = end
+	}
+	return tables
+}
+
+// scaledQuantTable returns the IJG table for the given quality factor (1-100)
+func scaledQuantTable(base [64]int, quality int) [64]int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var table [64]int
+	for i, v := range base {
+		q := (v*scale + 50) / 100
+		if q < 1 {
+			q = 1
+		}
+		if q > 255 {
+			q = 255
+		}
+		table[i] = q
+	}
+	return table
+}
+
+// estimateJPEGQuality finds the IJG quality factor whose scaled standard tables best
+// match the file's luma (and chroma, when present) tables. ok is false for non-JPEG data.
+func estimateJPEGQuality(data []byte) (quality int, ok bool) {
+	tables := parseJPEGQuantTables(data)
+	luma, hasLuma := tables[0]
+	if !hasLuma {
+		return 0, false
+	}
+	chroma, hasChroma := tables[1]
+
+	bestErr := math.MaxInt
+	for q := 1; q <= 100; q++ {
+		err := 0
+		candidate := scaledQuantTable(standardLumaQuant, q)
+		for i := range luma {
+			err += abs(luma[i] - candidate[i])
+		}
+		if hasChroma {
+			candidate = scaledQuantTable(standardChromaQuant, q)
+			for i := range chroma {
+				err += abs(chroma[i] - candidate[i])
+			}
+		}
+		if err < bestErr {
+			bestErr, quality = err, q
+		}
+	}
+	return quality, true
+}
+
+const (
+	// blockStepBins and blockStepScale quantize segment scores into a histogram, so
+	// their median per phase needs no sorting
+	blockStepBins  = 1024
+	blockStepScale = 64.0
+	// minBlockActivity is the step plus texture, in levels, below which a segment lies in
+	// flat paper or sky and shows nothing either way
+	minBlockActivity = 0.5
+)
+
+// computeBlockiness measures 8x8 block artifacts on decoded pixels, so recompressed
+// images are caught whatever their current format. Every 8-pixel segment of a column
+// or row boundary is scored by the step across it against the local texture, the
+// largest step within 7 pixels on either side: (step+1)/(texture+1). A block boundary
+// stands out of the smooth blocks around it, while a rule or the edge of a glyph comes
+// with its own return edge close by. Each of the eight phases takes the median score
+// of its segments, so blocking must lift most boundaries of a phase, not just the few
+// that content happens to fall on. The strongest phase relative to the mean of the
+// others gives about 1 for clean images, higher for visible blocking. An encoder's
+// grid starts at the same phase on both axes, so a grid is only counted when both
+// axes peak at the same phase.
+func computeBlockiness(gray *image.Gray) float64 {
+	bounds := gray.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 16 || h < 16 {
+		return 0
+	}
+	// Steps summed over each 8-pixel segment: colSteps holds a line of column steps for
+	// every band of 8 rows, rowSteps a line of row steps for every band of 8 columns
+	bandsY, bandsX := h/8, w/8
+	colSteps := make([]int32, bandsY*w)
+	rowSteps := make([]int32, bandsX*h)
+	for y := 0; y < h; y++ {
+		row := gray.Pix[y*gray.Stride : y*gray.Stride+w]
+		if y/8 < bandsY {
+			line := colSteps[(y/8)*w : (y/8+1)*w]
+			for x := 1; x < w; x++ {
+				line[x] += int32(abs(int(row[x]) - int(row[x-1])))
+			}
+		}
+		if y > 0 {
+			prev := gray.Pix[(y-1)*gray.Stride : (y-1)*gray.Stride+w]
+			for x := 0; x < bandsX*8; x++ {
+				rowSteps[(x/8)*h+y] += int32(abs(int(row[x]) - int(prev[x])))
+			}
+		}
+	}
+
+	// phaseScores returns the median segment score of each phase along one axis, from
+	// lines of n segment steps
+	phaseScores := func(steps []int32, n int) (scores [8]float64) {
+		var hist [8][blockStepBins]int
+		for start := 0; start+n <= len(steps); start += n {
+			line := steps[start : start+n]
+			for i := 8; i+8 <= n; i++ {
+				var texture int32
+				for k := i - 7; k <= i+7; k++ {
+					if k != i {
+						texture = max(texture, line[k])
+					}
+				}
+				step, local := float64(line[i])/8, float64(texture)/8
+				if step+local < minBlockActivity {
+					continue
+				}
+				score := (step + 1) / (local + 1)
+				hist[i%8][min(blockStepBins-1, int(score*blockStepScale))]++
+			}
+		}
+		for p := range hist {
+			scores[p] = float64(percentileFromHistogram(hist[p][:], 0.5)) / blockStepScale
+		}
+		return scores
+	}
+	cols := phaseScores(colSteps, w)
+	rows := phaseScores(rowSteps, h)
+
+	peak := func(scores [8]float64) (phase int, ratio float64) {
+		total := 0.0
+		for p, v := range scores {
+			total += v
+			if v > scores[phase] {
+				phase = p
+			}
+		}
+		others := (total - scores[phase]) / 7
+		if others == 0 {
+			return phase, 1
+		}
+		return phase, scores[phase] / others
+	}
+	colPhase, colRatio := peak(cols)
+	rowPhase, rowRatio := peak(rows)
+	if colPhase != rowPhase {
+		return 1
+	}
+	return (colRatio + rowRatio) / 2
+}
+
+// applyCompressionAnalysis records the estimated JPEG quality and blockiness and flags
+// images that cross the profile's compression limits
+func (a *imageAnalyzer) applyCompressionAnalysis(gray *image.Gray, data []byte, profile QualityProfile, result *AnalysisResult) {
+	result.Blockiness = computeBlockiness(gray)
+	result.HeavilyCompressed = profile.MaxBlockiness > 0 && result.Blockiness > profile.MaxBlockiness
+
+	if quality, ok := estimateJPEGQuality(data); ok {
+		result.JPEGQuality = &quality
+		if quality < profile.MinJPEGQuality {
+			result.HeavilyCompressed = true
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockiness(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// A form ruled every pitch pixels on slightly noisy paper
+	form := func(pitch int) *image.Gray {
+		img := newPage(1200, 900, 250)
+		addNoise(img, 1.5, r)
+		for k := pitch; k < 900; k += pitch {
+			fillRect(img, image.Rect(0, k, 1200, k+2), 40)
+		}
+		for k := pitch; k < 1200; k += pitch {
+			fillRect(img, image.Rect(k, 0, k+2, 900), 40)
+		}
+		return img
+	}
+
+	// A smooth gradient with some texture, saved as a JPEG of the given quality
+	smooth := image.NewGray(image.Rect(0, 0, 1200, 900))
+	for y := 0; y < 900; y++ {
+		for x := 0; x < 1200; x++ {
+			v := 128 + 80*math.Sin(float64(x)/90)*math.Cos(float64(y)/70)
+			smooth.Pix[smooth.PixOffset(x, y)] = uint8(v)
+		}
+	}
+	addNoise(smooth, 3, r)
+	compressed := func(quality int) *image.Gray {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, smooth, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img.(*image.Gray)
+	}
+
+	tests := []struct {
+		name     string
+		img      *image.Gray
+		min, max float64
+	}{
+		{"form ruled every 40 pixels", form(40), 0, 1.5},
+		{"form ruled every 37 pixels", form(37), 0, 1.5},
+		{"uncompressed", smooth, 0, 1.5},
+		{"JPEG quality 20", compressed(20), 2.2, math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeBlockiness(tt.img); got < tt.min || got > tt.max {
+				t.Errorf("blockiness = %.3f, want %.1f-%.1f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
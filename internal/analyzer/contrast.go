@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// edgeContrastPercentile selects the strongest gradients, whatever the overall
+	// contrast, as the edge pixels local contrast is measured around
+	edgeContrastPercentile = 0.9
+	// edgeContrastRadius is the half-size of the window local contrast is measured in
+	edgeContrastRadius = 2
+)
+
+// otsuThreshold returns the level that maximizes the between-class variance of a
+// 256-bin histogram; values at or below it form the dark class
+func otsuThreshold(hist []int) int {
+	total, sum := 0, 0.0
+	for v, n := range hist {
+		total += n
+		sum += float64(v * n)
+	}
+	if total == 0 {
+		return 0
+	}
+
+	best, bestVar := 0, -1.0
+	darkN, darkSum := 0, 0.0
+	for t := 0; t < len(hist)-1; t++ {
+		darkN += hist[t]
+		darkSum += float64(t * hist[t])
+		lightN := total - darkN
+		if darkN == 0 || lightN == 0 {
+			continue
+		}
+		darkMean := darkSum / float64(darkN)
+		lightMean := (sum - darkSum) / float64(lightN)
+		between := float64(darkN) * float64(lightN) * (darkMean - lightMean) * (darkMean - lightMean)
+		if between > bestVar {
+			best, bestVar = t, between
+		}
+	}
+	return best
+}
+
+// rmsContrast returns the standard deviation of a 256-bin histogram in 0-1 units
+func rmsContrast(hist []int) float64 {
+	var n, sum, sumSq float64
+	for v, count := range hist {
+		c := float64(count)
+		n += c
+		sum += float64(v) * c
+		sumSq += float64(v*v) * c
+	}
+	return math.Sqrt(math.Max(0, varianceOf(sum, sumSq, n))) / 255
+}
+
+// textContrast splits the document area into text and background with Otsu's method.
+// The text class is the smaller one, so light-on-dark documents are handled too.
+func textContrast(gray *image.Gray, rect image.Rectangle) (textLuma, backgroundLuma float64, ok bool) {
+	rect = rect.Intersect(gray.Bounds())
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+
+	t := otsuThreshold(hist[:])
+	var darkN, lightN, darkSum, lightSum float64
+	for v, n := range hist {
+		if v <= t {
+			darkN += float64(n)
+			darkSum += float64(v * n)
+		} else {
+			lightN += float64(n)
+			lightSum += float64(v * n)
+		}
+	}
+	if darkN == 0 || lightN == 0 {
+		return 0, 0, false
+	}
+	darkMean, lightMean := darkSum/darkN, lightSum/lightN
+	if darkN <= lightN {
+		return darkMean, lightMean, true
+	}
+	return lightMean, darkMean, true
+}
+
+// edgeContrast averages the local Michelson contrast in small windows around the
+// strongest gradients of rect
+func edgeContrast(gray *image.Gray, rect image.Rectangle) float64 {
+	rect = rect.Intersect(gray.Bounds()).Inset(edgeContrastRadius)
+	if rect.Empty() {
+		return 0
+	}
+
+	w := rect.Dx()
+	magnitudes := make([]int, w*rect.Dy())
+	hist := make([]int, 256*2)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := gray.PixOffset(x, y)
+			gx := int(gray.Pix[i+1]) - int(gray.Pix[i-1])
+			gy := int(gray.Pix[i+gray.Stride]) - int(gray.Pix[i-gray.Stride])
+			m := int(math.Sqrt(float64(gx*gx + gy*gy)))
+			magnitudes[(y-rect.Min.Y)*w+x-rect.Min.X] = m
+			hist[m]++
+		}
+	}
+	limit := max(1, percentileFromHistogram(hist, edgeContrastPercentile))
+
+	var sum, n float64
+	for j, m := range magnitudes {
+		if m < limit {
+			continue
+		}
+		cx, cy := rect.Min.X+j%w, rect.Min.Y+j/w
+		lo, hi := 255, 0
+		for y := cy - edgeContrastRadius; y <= cy+edgeContrastRadius; y++ {
+			for _, v := range gray.Pix[gray.PixOffset(cx-edgeContrastRadius, y) : gray.PixOffset(cx+edgeContrastRadius, y)+1] {
+				lo, hi = min(lo, int(v)), max(hi, int(v))
+			}
+		}
+		if hi > 0 {
+			sum += float64(hi-lo) / float64(hi+lo)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / n
+}
+
+// applyContrastAnalysis records global, edge-local and text/background contrast. The
+// global measures come from the luma histogram; the others look at the document area.
+// A uniform area has no text to judge and is not flagged.
+func (a *imageAnalyzer) applyContrastAnalysis(gray *image.Gray, level *regionLevel, hist *histogramSet, profile QualityProfile, result *AnalysisResult) {
+	result.RMSContrast = rmsContrast(hist[0][:])
+	p1, p99 := percentileFromHistogram(hist[0][:], 0.01), percentileFromHistogram(hist[0][:], 0.99)
+	if p1+p99 > 0 {
+		result.MichelsonContrast = float64(p99-p1) / float64(p99+p1)
+	}
+	result.EdgeContrast = edgeContrast(level.gray, level.document)
+
+	if textLuma, backgroundLuma, ok := textContrast(gray, level.toNative(level.document)); ok {
+		result.TextLuma = textLuma
+		result.BackgroundLuma = backgroundLuma
+		result.TextContrast = math.Abs(backgroundLuma-textLuma) / 255
+		result.LowContrast = result.TextContrast < profile.MinTextContrast
+	}
+}
@@ -0,0 +1,52 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// documentEdgeThreshold is the central-difference gradient magnitude that counts as an edge
+	documentEdgeThreshold = 50
+	// documentEdgeTrim is the share of edge pixels ignored on each side when bounding
+	// the document, so stray edges in the background do not stretch the box
+	documentEdgeTrim = 0.02
+	// minDocumentEdgeFraction is the share of edge pixels below which no document is assumed
+	minDocumentEdgeFraction = 0.001
+)
+
+// estimateDocumentBounds returns the box holding the bulk of the edge pixels of a
+// grayscale level, which approximates where the document content lies. ok is false
+// when there are too few edges to tell.
+func estimateDocumentBounds(gray *image.Gray) (bounds image.Rectangle, ok bool) {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	if w < 3 || h < 3 {
+		return image.Rectangle{}, false
+	}
+
+	colHist := make([]int, w)
+	rowHist := make([]int, h)
+	edges := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := gray.PixOffset(rect.Min.X+x, rect.Min.Y+y)
+			gx := int(gray.Pix[i+1]) - int(gray.Pix[i-1])
+			gy := int(gray.Pix[i+gray.Stride]) - int(gray.Pix[i-gray.Stride])
+			if math.Sqrt(float64(gx*gx+gy*gy)) > documentEdgeThreshold {
+				colHist[x]++
+				rowHist[y]++
+				edges++
+			}
+		}
+	}
+	if float64(edges) < minDocumentEdgeFraction*float64(w*h) {
+		return image.Rectangle{}, false
+	}
+
+	minX := percentileFromHistogram(colHist, documentEdgeTrim)
+	maxX := percentileFromHistogram(colHist, 1-documentEdgeTrim)
+	minY := percentileFromHistogram(rowHist, documentEdgeTrim)
+	maxY := percentileFromHistogram(rowHist, 1-documentEdgeTrim)
+	return image.Rect(minX, minY, maxX+1, maxY+1).Add(rect.Min), true
+}
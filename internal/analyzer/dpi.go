@@ -0,0 +1,22 @@
+package analyzer
+
+import "math"
+
+// effectiveDPI returns the resolution in pixels per inch at which a document of the given
+// physical size was captured, from its outline with corners clockwise from the top-left
+// one. Each side pair is measured by its shorter side, the one farther from the camera,
+// so the result holds for the worst-resolved part of the document. The paper is turned
+// to match the outline; a roll format is measured across its width only.
+func effectiveDPI(corners [4]Point, size PaperSize) float64 {
+	horizontal := math.Min(distance(corners[0], corners[1]), distance(corners[3], corners[2]))
+	vertical := math.Min(distance(corners[0], corners[3]), distance(corners[1], corners[2]))
+
+	if size.HeightMM == 0 {
+		return math.Min(horizontal, vertical) / (size.WidthMM / 25.4)
+	}
+	paperW, paperH := size.WidthMM, size.HeightMM
+	if horizontal > vertical {
+		paperW, paperH = paperH, paperW
+	}
+	return math.Min(horizontal/(paperW/25.4), vertical/(paperH/25.4))
+}
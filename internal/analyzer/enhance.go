@@ -0,0 +1,439 @@
+package analyzer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// minDeskewAngle is the smallest skew in degrees worth resampling the image for
+	minDeskewAngle = 0.25
+	// minWhiteBalanceCast is the white patch cast strength below which it counts as neutral
+	minWhiteBalanceCast = 0.02
+	// maxWhiteBalanceGain bounds the per-channel gain of white balance correction
+	maxWhiteBalanceGain = 2.5
+	// stretchPercentile is the share of pixels clipped at either end by the contrast stretch
+	stretchPercentile = 0.005
+	// minStretchRange is the luma range below which the image is too flat to stretch
+	minStretchRange = 16
+	// claheTiles is the number of CLAHE tiles per side
+	claheTiles = 8
+	// claheClipLimit caps each histogram bin at this multiple of the mean bin count,
+	// which bounds how much noise in flat areas such as blank paper is amplified
+	claheClipLimit = 2.0
+	// unsharpSigma, unsharpAmount and unsharpThreshold configure the unsharp mask;
+	// differences up to the threshold are left alone so noise is not sharpened
+	unsharpSigma     = 1.0
+	unsharpAmount    = 0.8
+	unsharpThreshold = 3
+)
+
+// EnhanceStep is one stage of the enhancement pipeline
+type EnhanceStep string
+
+const (
+	// StepDeskew rotates the image by the detected text skew
+	StepDeskew EnhanceStep = "deskew"
+	// StepWhiteBalance neutralizes the colour of the brightest near-white area
+	StepWhiteBalance EnhanceStep = "white_balance"
+	// StepContrastStretch maps the luma range onto the full 0-255 range
+	StepContrastStretch EnhanceStep = "contrast_stretch"
+	// StepCLAHE equalizes local contrast with contrast-limited adaptive histogram equalization
+	StepCLAHE EnhanceStep = "clahe"
+	// StepSharpen applies an unsharp mask to the luma
+	StepSharpen EnhanceStep = "sharpen"
+)
+
+// enhanceSteps lists every step in the order the pipeline runs them
+var enhanceSteps = []EnhanceStep{StepDeskew, StepWhiteBalance, StepContrastStretch, StepCLAHE, StepSharpen}
+
+// ParseEnhanceStep converts a request value into an EnhanceStep
+func ParseEnhanceStep(value string) (EnhanceStep, error) {
+	for _, step := range enhanceSteps {
+		if EnhanceStep(value) == step {
+			return step, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported enhancement step %q (expected deskew, white_balance, contrast_stretch, clahe or sharpen)", value)
+}
+
+// EnhanceOutput is the colour format of an enhanced image
+type EnhanceOutput string
+
+const (
+	OutputColor  EnhanceOutput = "color"
+	OutputGray   EnhanceOutput = "gray"
+	OutputBinary EnhanceOutput = "binary"
+)
+
+// ParseEnhanceOutput converts a request value into an EnhanceOutput, defaulting to OutputGray
+func ParseEnhanceOutput(value string) (EnhanceOutput, error) {
+	switch EnhanceOutput(value) {
+	case "":
+		return OutputGray, nil
+	case OutputColor, OutputGray, OutputBinary:
+		return EnhanceOutput(value), nil
+	default:
+		return "", fmt.Errorf("unsupported output %q (expected color, gray or binary)", value)
+	}
+}
+
+// EnhanceOptions configures an enhancement run
+type EnhanceOptions struct {
+	// Steps selects the stages to run; they always run in pipeline order. Nil runs all.
+	Steps  []EnhanceStep
+	Output EnhanceOutput
+	// Binarization configures OutputBinary
+	Binarization BinarizeOptions
+	// Analysis configures the analyses of the original and the enhanced image
+	Analysis AnalysisOptions
+}
+
+// Validate checks that the options are within supported ranges
+func (o EnhanceOptions) Validate() error {
+	for _, step := range o.Steps {
+		if _, err := ParseEnhanceStep(string(step)); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseEnhanceOutput(string(o.Output)); err != nil {
+		return err
+	}
+	if err := o.Binarization.Validate(); err != nil {
+		return err
+	}
+	return o.Analysis.Validate()
+}
+
+// enabled reports whether the options select the step
+func (o EnhanceOptions) enabled(step EnhanceStep) bool {
+	if o.Steps == nil {
+		return true
+	}
+	for _, s := range o.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// EnhanceResult is an enhanced image with the analyses of the original and of the result
+type EnhanceResult struct {
+	// Image is an *image.RGBA, *image.Gray or, for OutputBinary, a two-colour *image.Paletted
+	Image image.Image
+	// Applied lists the selected steps that changed the image; steps that find nothing
+	// to correct, such as deskewing straight text, are left out
+	Applied []EnhanceStep
+	// SkewCorrection is the rotation applied by deskewing, in degrees clockwise
+	SkewCorrection float64
+	Before         AnalysisResult
+	After          AnalysisResult
+}
+
+// Enhance runs the enhancement pipeline for OCR preprocessing and analyzes the image
+// before and after
+func (a *imageAnalyzer) Enhance(img image.Image, opts EnhanceOptions) (EnhanceResult, error) {
+	if err := opts.Validate(); err != nil {
+		return EnhanceResult{}, err
+	}
+	output, _ := ParseEnhanceOutput(string(opts.Output))
+
+	// Both analyses are validated like any other, so their issues can decide which image
+	// goes to OCR
+	result := EnhanceResult{Applied: []EnhanceStep{}, Before: a.AnalyzeWithOptions(img, opts.Analysis)}
+
+	bounds := img.Bounds()
+	work := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(work, work.Bounds(), img, bounds.Min, draw.Src)
+
+	for _, step := range enhanceSteps {
+		if !opts.enabled(step) {
+			continue
+		}
+		applied := true
+		switch step {
+		case StepDeskew:
+			var angle float64
+			work, angle, applied = deskew(work)
+			result.SkewCorrection = angle
+		case StepWhiteBalance:
+			applied = correctWhiteBalance(work)
+		case StepContrastStretch:
+			applied = stretchContrast(work)
+		case StepCLAHE:
+			gray := toGray(work)
+			applyLumaChange(work, gray, equalizeLocalContrast(gray))
+		case StepSharpen:
+			gray := toGray(work)
+			applyLumaChange(work, gray, unsharpMask(gray))
+		}
+		if applied {
+			result.Applied = append(result.Applied, step)
+		}
+	}
+
+	switch output {
+	case OutputColor:
+		result.Image = work
+	case OutputGray:
+		result.Image = toGray(work)
+	case OutputBinary:
+		result.Image = binarize(toGray(work), opts.Binarization)
+	}
+
+	// The encoded file describes the original only
+	afterOpts := opts.Analysis
+	afterOpts.ImageData = nil
+	result.After = a.AnalyzeWithOptions(result.Image, afterOpts)
+	return result, nil
+}
+
+// deskew rotates img clockwise by the detected text skew on a canvas large enough to
+// hold the whole rotated image, filling the corners with the mean border colour. It
+// returns img unchanged and false when no confident skew was found.
+func deskew(img *image.RGBA) (*image.RGBA, float64, bool) {
+	level := newRegionLevel(buildPyramid(img, regionMaxDim).top(), img.Bounds())
+	skew, ok := estimateSkew(level.gray, level.document)
+	if !ok || skew.confidence < minSkewConfidence || math.Abs(skew.angle) < minDeskewAngle {
+		return img, 0, false
+	}
+
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	sin, cos := math.Sincos(skew.angle * math.Pi / 180)
+	outW := math.Ceil(w*math.Abs(cos) + h*math.Abs(sin))
+	outH := math.Ceil(w*math.Abs(sin) + h*math.Abs(cos))
+
+	// Each output pixel is taken from the source rotated back counter-clockwise about
+	// the centres of both canvases (y points down)
+	cx, cy, ox, oy := w/2, h/2, outW/2, outH/2
+	rotation := homography{
+		cos, sin, cx - ox*cos - oy*sin,
+		-sin, cos, cy + ox*sin - oy*cos,
+		0, 0, 1,
+	}
+	fill := borderColor(img)
+	return warpPerspective(img, rotation, int(outW), int(outH), &fill), skew.angle, true
+}
+
+// borderColor returns the mean colour of the outermost pixels of img
+func borderColor(img *image.RGBA) color.RGBA {
+	rect := img.Bounds()
+	var sum [3]float64
+	n := 0.0
+	add := func(x, y int) {
+		i := img.PixOffset(x, y)
+		for c := 0; c < 3; c++ {
+			sum[c] += float64(img.Pix[i+c])
+		}
+		n++
+	}
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		add(x, rect.Min.Y)
+		add(x, rect.Max.Y-1)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		add(rect.Min.X, y)
+		add(rect.Max.X-1, y)
+	}
+	return color.RGBA{uint8(sum[0]/n + 0.5), uint8(sum[1]/n + 0.5), uint8(sum[2]/n + 0.5), 255}
+}
+
+// correctWhiteBalance scales the channels so the white patch becomes neutral at the
+// level of its brightest channel. It returns false when no white patch was found or it
+// is already neutral.
+func correctWhiteBalance(img *image.RGBA) bool {
+	level := buildPyramid(img, regionMaxDim).top()
+	r, g, b, ok := whitePatch(level)
+	if !ok || castOf(r, g, b).strength() < minWhiteBalanceCast {
+		return false
+	}
+	target := max(r, g, b)
+	var lut [3][256]uint8
+	for c, v := range [3]float64{r, g, b} {
+		gain := math.Min(target/v, maxWhiteBalanceGain)
+		for i := range lut[c] {
+			lut[c][i] = uint8(math.Min(255, float64(i)*gain+0.5))
+		}
+	}
+	applyChannelLUTs(img, lut)
+	return true
+}
+
+// stretchContrast maps the 0.5th to 99.5th luma percentiles onto 0-255, scaling all
+// channels alike so hues are kept. It returns false when the image already spans the
+// range or is too flat to stretch.
+func stretchContrast(img *image.RGBA) bool {
+	gray := toGray(img)
+	var hist [256]int
+	for _, v := range gray.Pix {
+		hist[v]++
+	}
+	lo := percentileFromHistogram(hist[:], stretchPercentile)
+	hi := percentileFromHistogram(hist[:], 1-stretchPercentile)
+	if hi-lo < minStretchRange || (lo <= shadowClipLevel && hi >= highlightClipLevel) {
+		return false
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Max(0, math.Min(255, float64(i-lo)*255/float64(hi-lo)+0.5)))
+	}
+	applyChannelLUTs(img, [3][256]uint8{lut, lut, lut})
+	return true
+}
+
+// applyChannelLUTs replaces each colour channel value through its lookup table
+func applyChannelLUTs(img *image.RGBA, lut [3][256]uint8) {
+	rect := img.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(rect.Min.X, y):img.PixOffset(rect.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+1], row[i+2] = lut[0][row[i]], lut[1][row[i+1]], lut[2][row[i+2]]
+		}
+	}
+}
+
+// applyLumaChange adds the change from before to after to every colour channel, which
+// transfers a luma-only operation to a colour image without shifting hues much
+func applyLumaChange(img *image.RGBA, before, after *image.Gray) {
+	rect := img.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(rect.Min.X, y):img.PixOffset(rect.Max.X, y)]
+		old := before.Pix[before.PixOffset(rect.Min.X, y):]
+		updated := after.Pix[after.PixOffset(rect.Min.X, y):]
+		for x := 0; x < rect.Dx(); x++ {
+			delta := int(updated[x]) - int(old[x])
+			if delta == 0 {
+				continue
+			}
+			for c := 4 * x; c < 4*x+3; c++ {
+				row[c] = uint8(max(0, min(255, int(row[c])+delta)))
+			}
+		}
+	}
+}
+
+// equalizeLocalContrast applies contrast-limited adaptive histogram equalization: each
+// of claheTiles x claheTiles tiles gets an equalization curve from its clipped
+// histogram, and every pixel blends the curves of the four nearest tile centres
+func equalizeLocalContrast(gray *image.Gray) *image.Gray {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	tileW, tileH := float64(w)/claheTiles, float64(h)/claheTiles
+
+	var curves [claheTiles][claheTiles][256]uint8
+	for ty := 0; ty < claheTiles; ty++ {
+		for tx := 0; tx < claheTiles; tx++ {
+			x0, x1 := int(float64(tx)*tileW), int(float64(tx+1)*tileW)
+			y0, y1 := int(float64(ty)*tileH), int(float64(ty+1)*tileH)
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for _, v := range gray.Pix[gray.PixOffset(rect.Min.X+x0, rect.Min.Y+y):gray.PixOffset(rect.Min.X+x1, rect.Min.Y+y)] {
+					hist[v]++
+				}
+			}
+			area := (x1 - x0) * (y1 - y0)
+			if area == 0 {
+				for i := range curves[ty][tx] {
+					curves[ty][tx][i] = uint8(i)
+				}
+				continue
+			}
+
+			// Clip the histogram and spread the excess evenly over all bins
+			limit := max(1, int(claheClipLimit*float64(area)/256))
+			excess := 0
+			for i, n := range hist {
+				if n > limit {
+					excess += n - limit
+					hist[i] = limit
+				}
+			}
+			cdf := 0.0
+			for i, n := range hist {
+				cdf += float64(n) + float64(excess)/256
+				curves[ty][tx][i] = uint8(math.Min(255, cdf*255/float64(area)+0.5))
+			}
+		}
+	}
+
+	out := image.NewGray(rect)
+	for y := 0; y < h; y++ {
+		// Position between tile centres, clamped at the outer half tiles
+		fy := math.Max(0, math.Min(claheTiles-1, (float64(y)+0.5)/tileH-0.5))
+		ty0 := min(int(fy), claheTiles-2)
+		wy := fy - float64(ty0)
+		src := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):]
+		dst := out.Pix[out.PixOffset(rect.Min.X, rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			fx := math.Max(0, math.Min(claheTiles-1, (float64(x)+0.5)/tileW-0.5))
+			tx0 := min(int(fx), claheTiles-2)
+			wx := fx - float64(tx0)
+			v := src[x]
+			top := float64(curves[ty0][tx0][v])*(1-wx) + float64(curves[ty0][tx0+1][v])*wx
+			bottom := float64(curves[ty0+1][tx0][v])*(1-wx) + float64(curves[ty0+1][tx0+1][v])*wx
+			dst[x] = uint8(top*(1-wy) + bottom*wy + 0.5)
+		}
+	}
+	return out
+}
+
+// unsharpMask sharpens gray by adding back its difference from a Gaussian blur
+func unsharpMask(gray *image.Gray) *image.Gray {
+	blurred := gaussianBlur(gray, unsharpSigma)
+	out := image.NewGray(gray.Bounds())
+	for i, v := range gray.Pix {
+		diff := int(v) - int(blurred.Pix[i])
+		if abs(diff) <= unsharpThreshold {
+			out.Pix[i] = v
+			continue
+		}
+		out.Pix[i] = uint8(math.Max(0, math.Min(255, float64(v)+unsharpAmount*float64(diff)+0.5)))
+	}
+	return out
+}
+
+// gaussianBlur blurs gray with a separable Gaussian kernel, repeating edge pixels
+func gaussianBlur(gray *image.Gray, sigma float64) *image.Gray {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	tmp := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		row := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			v := 0.0
+			for k, weight := range kernel {
+				v += weight * float64(row[max(0, min(w-1, x+k-radius))])
+			}
+			tmp[y*w+x] = v
+		}
+	}
+	out := image.NewGray(rect)
+	for y := 0; y < h; y++ {
+		dst := out.Pix[out.PixOffset(rect.Min.X, rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			v := 0.0
+			for k, weight := range kernel {
+				v += weight * tmp[max(0, min(h-1, y+k-radius))*w+x]
+			}
+			dst[x] = uint8(v + 0.5)
+		}
+	}
+	return out
+}
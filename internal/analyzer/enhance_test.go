@@ -0,0 +1,189 @@
+package analyzer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// toRGBA copies img into a new RGBA image
+func toRGBA(img image.Image) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+// textPage returns a page of text with margins
+func textPage(w, h int, r *rand.Rand) *image.Gray {
+	page := newPage(w, h, 235)
+	drawText(page, image.Rect(w/8, h/8, w*7/8, h*7/8), 16, r)
+	return page
+}
+
+func TestDeskew(t *testing.T) {
+	page := textPage(1000, 800, rand.New(rand.NewSource(1)))
+	for _, angle := range []float64{-3.4, -1.1, 1.1, 3.4} {
+		t.Run(fmt.Sprintf("%.1f°", angle), func(t *testing.T) {
+			// Lines rotated counter-clockwise rise to the right and are turned back clockwise
+			out, correction, ok := deskew(toRGBA(rotateGray(page, angle, 235)))
+			if !ok {
+				t.Fatal("no skew corrected")
+			}
+			if math.Abs(correction-angle) > 0.2 {
+				t.Errorf("correction = %.2f°, want %.2f°", correction, angle)
+			}
+			gray := toGray(out)
+			if skew, ok := estimateSkew(gray, gray.Bounds()); !ok || math.Abs(skew.angle) > 0.2 {
+				t.Errorf("deskewed lines are at %.2f°, want 0°", skew.angle)
+			}
+			b := out.Bounds()
+			if b.Dx() < 1000 || b.Dy() < 800 {
+				t.Errorf("deskewed canvas %dx%d cuts off the 1000x800 page", b.Dx(), b.Dy())
+			}
+		})
+	}
+
+	t.Run("straight text", func(t *testing.T) {
+		if _, _, ok := deskew(toRGBA(page)); ok {
+			t.Error("straight text was deskewed")
+		}
+	})
+}
+
+func TestCorrectWhiteBalance(t *testing.T) {
+	tinted := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	fill := func(img *image.RGBA, r image.Rectangle, c [3]uint8) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				i := img.PixOffset(x, y)
+				img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c[0], c[1], c[2], 255
+			}
+		}
+	}
+	// Paper under warm light, with ink tinted alike
+	fill(tinted, tinted.Bounds(), [3]uint8{240, 215, 170})
+	fill(tinted, image.Rect(50, 50, 350, 80), [3]uint8{60, 54, 42})
+	if !correctWhiteBalance(tinted) {
+		t.Fatal("warm cast was not corrected")
+	}
+	p := tinted.Pix[tinted.PixOffset(10, 10):]
+	if spread := max(p[0], p[1], p[2]) - min(p[0], p[1], p[2]); spread > 4 {
+		t.Errorf("paper is (%d, %d, %d) after correction, want neutral", p[0], p[1], p[2])
+	}
+	if p[0] < 235 {
+		t.Errorf("paper darkened to %d, want the brightest channel kept", p[0])
+	}
+
+	neutral := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	fill(neutral, neutral.Bounds(), [3]uint8{230, 230, 230})
+	if correctWhiteBalance(neutral) {
+		t.Error("neutral paper was corrected")
+	}
+}
+
+func TestStretchContrast(t *testing.T) {
+	// A faded page: ink at 110 on paper at 170
+	faded := newPage(400, 300, 170)
+	fillRect(faded, image.Rect(50, 50, 350, 150), 110)
+	img := toRGBA(faded)
+	if !stretchContrast(img) {
+		t.Fatal("faded page was not stretched")
+	}
+	if ink, paper := img.Pix[img.PixOffset(100, 100)], img.Pix[img.PixOffset(10, 10)]; ink > 5 || paper < 250 {
+		t.Errorf("ink %d and paper %d after stretching, want about 0 and 255", ink, paper)
+	}
+
+	full := newPage(400, 300, 254)
+	fillRect(full, image.Rect(50, 50, 350, 150), 1)
+	if stretchContrast(toRGBA(full)) {
+		t.Error("page spanning the full range was stretched")
+	}
+}
+
+func TestEqualizeLocalContrast(t *testing.T) {
+	// Flat texture with a 32-level spread on the left, full-range texture on the right
+	r := rand.New(rand.NewSource(1))
+	page := image.NewGray(image.Rect(0, 0, 800, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 800; x++ {
+			v := r.Intn(256)
+			if x < 400 {
+				v = 80 + r.Intn(32)
+			}
+			page.Pix[page.PixOffset(x, y)] = uint8(v)
+		}
+	}
+
+	sigma := func(gray *image.Gray, rect image.Rectangle) float64 {
+		var sum, sq, n float64
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				v := float64(gray.Pix[gray.PixOffset(x, y)])
+				sum, sq, n = sum+v, sq+v*v, n+1
+			}
+		}
+		return math.Sqrt(varianceOf(sum, sq, n))
+	}
+	// The halves are measured away from the tiles that blend across the middle
+	flat, full := image.Rect(0, 0, 300, 600), image.Rect(500, 0, 800, 600)
+	out := equalizeLocalContrast(page)
+	if before, after := sigma(page, flat), sigma(out, flat); after < 2*before {
+		t.Errorf("flat texture spread went from %.1f to %.1f, want at least twice as much", before, after)
+	}
+	// The clip limit keeps a tile that already spans the range about as it is
+	if before, after := sigma(page, full), sigma(out, full); math.Abs(after-before) > 0.15*before {
+		t.Errorf("full-range texture spread went from %.1f to %.1f, want it kept", before, after)
+	}
+}
+
+func TestUnsharpMask(t *testing.T) {
+	// A soft vertical edge with faint noise on both sides
+	page := newPage(200, 100, 200)
+	fillRect(page, image.Rect(100, 0, 200, 100), 60)
+	soft := boxBlur(page, 1)
+	addNoise(soft, 0.7, rand.New(rand.NewSource(1)))
+	sharp := unsharpMask(soft)
+
+	step := func(gray *image.Gray) int {
+		return int(gray.Pix[gray.PixOffset(98, 50)]) - int(gray.Pix[gray.PixOffset(101, 50)])
+	}
+	if step(sharp) <= step(soft) {
+		t.Errorf("edge step %d after sharpening, want more than %d", step(sharp), step(soft))
+	}
+	// Noise away from the edge stays within the threshold and is left alone
+	for _, x := range []int{10, 190} {
+		if a, b := soft.Pix[soft.PixOffset(x, 50)], sharp.Pix[sharp.PixOffset(x, 50)]; a != b {
+			t.Errorf("flat pixel at x=%d changed from %d to %d", x, a, b)
+		}
+	}
+}
+
+func TestEnhanceValidatesBothAnalyses(t *testing.T) {
+	a := newTestAnalyzer(t)
+	skewed := rotateGray(textPage(1600, 1200, rand.New(rand.NewSource(1))), 8, 235)
+
+	result, err := a.Enhance(skewed, EnhanceOptions{Analysis: AnalysisOptions{IsOCR: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SkewCorrection < 7.8 || result.SkewCorrection > 8.2 {
+		t.Errorf("skew correction = %.2f°, want 8°", result.SkewCorrection)
+	}
+	has := func(r AnalysisResult, code IssueCode) bool {
+		for _, issue := range r.Issues {
+			if issue.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(result.Before, IssueSkewed) || len(result.Before.Errors) == 0 {
+		t.Errorf("original reported issues %v, want %s", result.Before.Issues, IssueSkewed)
+	}
+	if has(result.After, IssueSkewed) {
+		t.Errorf("enhanced image reported issues %v, want no %s", result.After.Issues, IssueSkewed)
+	}
+}
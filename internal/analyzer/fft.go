@@ -0,0 +1,99 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fft performs an in-place iterative radix-2 Cooley-Tukey transform.
+// len(data) must be a power of two.
+func fft(data []complex128) {
+	n := len(data)
+	if n < 2 {
+		return
+	}
+
+	// Bit-reversal permutation
+	shift := 64 - uint(bits.TrailingZeros(uint(n)))
+	for i := 0; i < n; i++ {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if i < j {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := data[start+k], data[start+k+size/2]*w
+				data[start+k] = even + odd
+				data[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
+
+// powerSpectrum returns the centred power spectrum of a square, Hann-windowed crop
+// of gray. The crop side is the largest power of two not exceeding maxSize that fits
+// inside rect; ok is false when rect is too small.
+func powerSpectrum(gray *image.Gray, rect image.Rectangle, maxSize int) (spectrum [][]float64, size int, ok bool) {
+	rect = rect.Intersect(gray.Bounds())
+	size = 1
+	for size*2 <= maxSize && size*2 <= rect.Dx() && size*2 <= rect.Dy() {
+		size *= 2
+	}
+	if size < 16 {
+		return nil, 0, false
+	}
+
+	ox := rect.Min.X + (rect.Dx()-size)/2
+	oy := rect.Min.Y + (rect.Dy()-size)/2
+
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+	}
+
+	// Remove the mean so the DC term does not dominate the spectrum
+	var mean float64
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			mean += float64(gray.GrayAt(ox+x, oy+y).Y)
+		}
+	}
+	mean /= float64(size * size)
+
+	rows := make([][]complex128, size)
+	for y := range rows {
+		rows[y] = make([]complex128, size)
+		for x := range rows[y] {
+			v := (float64(gray.GrayAt(ox+x, oy+y).Y) - mean) * window[x] * window[y]
+			rows[y][x] = complex(v, 0)
+		}
+		fft(rows[y])
+	}
+
+	column := make([]complex128, size)
+	spectrum = make([][]float64, size)
+	for y := range spectrum {
+		spectrum[y] = make([]float64, size)
+	}
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			column[y] = rows[y][x]
+		}
+		fft(column)
+		for y := 0; y < size; y++ {
+			// Shift so that zero frequency sits at the centre
+			sy, sx := (y+size/2)%size, (x+size/2)%size
+			re, im := real(column[y]), imag(column[y])
+			spectrum[sy][sx] = re*re + im*im
+		}
+	}
+	return spectrum, size, true
+}
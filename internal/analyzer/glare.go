@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// glareMinValue is the HSV value (0-255) from which a pixel counts as near-saturated
+	glareMinValue = 245
+	// glareMaxSaturation keeps coloured highlights out: specular reflections are near white
+	glareMaxSaturation = 0.12
+	// minGlareRegionFraction is the smallest hotspot reported, as a share of the frame
+	minGlareRegionFraction = 0.001
+	// maxGlareRegionFraction is the largest: a near-white area covering more of the frame
+	// is the background of a scan or an overexposed shot, not a reflection
+	maxGlareRegionFraction = 0.25
+)
+
+// glareAnalysis holds the hotspots found on the region level, in native coordinates.
+// fraction is the share of the frame covered by hotspot pixels inside the document area.
+type glareAnalysis struct {
+	regions  []image.Rectangle
+	overlaps bool
+	fraction float64
+}
+
+// detectGlare finds connected regions of near-saturated, low-saturation pixels. level
+// is a downscaled copy of the image and scale maps its pixels back to native ones;
+// document is the document area in level coordinates. Only the hotspot pixels inside it
+// count toward the glare fraction, so a reflection on the table around a card does not.
+func (a *imageAnalyzer) detectGlare(level *image.RGBA, scale float64, origin image.Point, document image.Rectangle) glareAnalysis {
+	rect := level.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	mask := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := level.Pix[level.PixOffset(rect.Min.X+x, rect.Min.Y+y):]
+			r, g, b := int(p[0]), int(p[1]), int(p[2])
+			maxC := max(r, g, b)
+			if maxC < glareMinValue {
+				continue
+			}
+			mask[y*w+x] = float64(maxC-min(r, g, b))/float64(maxC) <= glareMaxSaturation
+		}
+	}
+
+	total := float64(w * h)
+	minArea := int(math.Ceil(minGlareRegionFraction * total))
+	labels, components := labelComponentMap(mask, w, h, minArea)
+	var analysis glareAnalysis
+	var kept []bool
+	for _, c := range components {
+		if float64(c.area) > maxGlareRegionFraction*total {
+			continue
+		}
+		analysis.regions = append(analysis.regions, scaleRect(c.bounds, scale, origin))
+		for int(c.label) >= len(kept) {
+			kept = append(kept, false)
+		}
+		kept[c.label] = true
+	}
+
+	inside := document.Sub(rect.Min).Intersect(image.Rect(0, 0, w, h))
+	area := 0
+	for y := inside.Min.Y; y < inside.Max.Y; y++ {
+		for x := inside.Min.X; x < inside.Max.X; x++ {
+			if l := int(labels[y*w+x]); l < len(kept) && kept[l] {
+				area++
+			}
+		}
+	}
+	analysis.overlaps = area > 0
+	analysis.fraction = float64(area) / total
+	return analysis
+}
+
+// applyGlareAnalysis records the glare hotspots and flags glare over the document that
+// exceeds the profile's limit
+func (a *imageAnalyzer) applyGlareAnalysis(level *regionLevel, profile QualityProfile, result *AnalysisResult) {
+	glare := a.detectGlare(level.rgba, level.scale, level.origin, level.document)
+
+	result.GlareRegionCount = len(glare.regions)
+	result.GlareAreaFraction = glare.fraction
+	for _, r := range glare.regions {
+		result.GlareRegions = append(result.GlareRegions, regionFromRect(r))
+	}
+	result.GlareOverlapsDocument = glare.overlaps
+	result.Glare = glare.overlaps && glare.fraction > profile.MaxGlareFraction
+}
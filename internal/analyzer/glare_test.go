@@ -0,0 +1,51 @@
+package analyzer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestGlareCountsDocumentAreaOnly(t *testing.T) {
+	a := newTestAnalyzer(t).(*imageAnalyzer)
+	profile := DefaultProfile(true)
+	document := image.Rect(100, 75, 300, 225)
+
+	// scene is a gray card on a dark table with white hotspots on it
+	scene := func(hotspots ...image.Rectangle) *regionLevel {
+		rgba := image.NewRGBA(image.Rect(0, 0, 400, 300))
+		draw.Draw(rgba, rgba.Bounds(), image.NewUniform(color.RGBA{90, 80, 70, 255}), image.Point{}, draw.Src)
+		draw.Draw(rgba, document, image.NewUniform(color.RGBA{200, 200, 195, 255}), image.Point{}, draw.Src)
+		for _, r := range hotspots {
+			draw.Draw(rgba, r, image.NewUniform(color.White), image.Point{}, draw.Src)
+		}
+		return &regionLevel{rgba: rgba, gray: toGray(rgba), scale: 1, document: document, hasDocument: true}
+	}
+
+	tests := []struct {
+		name     string
+		level    *regionLevel
+		regions  int
+		overlaps bool
+		glare    bool
+	}{
+		{"no hotspots", scene(), 0, false, false},
+		{"reflection on the table", scene(image.Rect(320, 20, 380, 80)), 1, false, false},
+		{"small highlight on the card and a reflection on the table",
+			scene(image.Rect(150, 100, 162, 112), image.Rect(320, 20, 380, 80)), 2, true, false},
+		{"large highlight on the card", scene(image.Rect(150, 100, 180, 130)), 1, true, true},
+		{"highlight across the card's edge", scene(image.Rect(280, 100, 320, 140)), 1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result AnalysisResult
+			a.applyGlareAnalysis(tt.level, profile, &result)
+			if result.GlareRegionCount != tt.regions || result.GlareOverlapsDocument != tt.overlaps || result.Glare != tt.glare {
+				t.Errorf("regions %d, overlaps %v, glare %v (fraction %.4f); want %d, %v, %v",
+					result.GlareRegionCount, result.GlareOverlapsDocument, result.Glare, result.GlareAreaFraction,
+					tt.regions, tt.overlaps, tt.glare)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// newTestAnalyzer returns an analyzer whose worker pool is closed with the test
+func newTestAnalyzer(t testing.TB) ImageAnalyzer {
+	a, err := NewImageAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.(*imageAnalyzer).workerPool.Close() })
+	return a
+}
+
+// newPage returns a gray page of the given paper tone
+func newPage(w, h int, paper uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = paper
+	}
+	return img
+}
+
+// drawText fills rect with lines of glyph-like marks: words of cells holding a few
+// 2-pixel strokes, the way printed text looks to the analyzer
+func drawText(img *image.Gray, rect image.Rectangle, glyph int, r *rand.Rand) {
+	stroke := max(1, glyph/8)
+	for y := rect.Min.Y; y+glyph <= rect.Max.Y; y += glyph * 2 {
+		for x := rect.Min.X; x+glyph <= rect.Max.X; {
+			letters := 2 + r.Intn(8)
+			for i := 0; i < letters && x+glyph <= rect.Max.X; i++ {
+				cell := image.Rect(x, y, x+glyph*3/4, y+glyph)
+				fillRect(img, image.Rect(cell.Min.X, cell.Min.Y, cell.Min.X+stroke, cell.Max.Y), 30)
+				for k := 0; k < 2+r.Intn(2); k++ {
+					if r.Intn(2) == 0 {
+						sy := cell.Min.Y + r.Intn(glyph-stroke)
+						fillRect(img, image.Rect(cell.Min.X, sy, cell.Max.X, sy+stroke), 30)
+					} else {
+						sx := cell.Min.X + r.Intn(cell.Dx()-stroke)
+						fillRect(img, image.Rect(sx, cell.Min.Y+glyph/3, sx+stroke, cell.Max.Y), 30)
+					}
+				}
+				x += glyph
+			}
+			x += glyph
+		}
+	}
+}
+
+func fillRect(img *image.Gray, rect image.Rectangle, v uint8) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.Pix[img.PixOffset(x, y)] = v
+		}
+	}
+}
+
+// boxBlur blurs img with three passes of a separable box filter, close to a Gaussian
+// of sigma ≈ radius
+func boxBlur(img *image.Gray, radius int) *image.Gray {
+	out := img
+	for pass := 0; pass < 3; pass++ {
+		out = boxBlurAxis(boxBlurAxis(out, radius, 1, 0), radius, 0, 1)
+	}
+	return out
+}
+
+func boxBlurAxis(img *image.Gray, radius, dx, dy int) *image.Gray {
+	b := img.Bounds()
+	out := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var sum, n int
+			for k := -radius; k <= radius; k++ {
+				p := image.Pt(x+k*dx, y+k*dy)
+				if p.In(b) {
+					sum += int(img.Pix[img.PixOffset(p.X, p.Y)])
+					n++
+				}
+			}
+			out.Pix[out.PixOffset(x, y)] = uint8(sum / n)
+		}
+	}
+	return out
+}
+
+// addNoise adds Gaussian noise of the given sigma
+func addNoise(img *image.Gray, sigma float64, r *rand.Rand) {
+	for i, v := range img.Pix {
+		img.Pix[i] = uint8(math.Max(0, math.Min(255, math.Round(float64(v)+r.NormFloat64()*sigma))))
+	}
+}
+
+// rotateGray turns img counter-clockwise by deg degrees about its centre, with
+// bilinear sampling, filling the uncovered corners with bg
+func rotateGray(img *image.Gray, deg float64, bg uint8) *image.Gray {
+	b := img.Bounds()
+	out := image.NewGray(b)
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	cx, cy := float64(b.Dx()-1)/2, float64(b.Dy()-1)/2
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx, sy := cx+cos*dx-sin*dy, cy+sin*dx+cos*dy
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < 0 || y0 < 0 || x0+1 >= b.Dx() || y0+1 >= b.Dy() {
+				out.Pix[out.PixOffset(x, y)] = bg
+				continue
+			}
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			at := func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }
+			v := (at(x0, y0)*(1-fx)+at(x0+1, y0)*fx)*(1-fy) + (at(x0, y0+1)*(1-fx)+at(x0+1, y0+1)*fx)*fy
+			out.Pix[out.PixOffset(x, y)] = uint8(v + 0.5)
+		}
+	}
+	return out
+}
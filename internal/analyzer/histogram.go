@@ -0,0 +1,96 @@
+package analyzer
+
+const (
+	// shadowClipLevel and highlightClipLevel bound the values counted as clipped; a
+	// couple of levels of slack absorbs JPEG ringing around crushed and blown areas
+	shadowClipLevel    = 2
+	highlightClipLevel = 253
+)
+
+// Histograms holds 256-bin histograms of luma and each RGB channel
+type Histograms struct {
+	Luma  []int `json:"luma"`
+	Red   []int `json:"red"`
+	Green []int `json:"green"`
+	Blue  []int `json:"blue"`
+}
+
+// ToneStats summarizes one histogram
+type ToneStats struct {
+	// Percentage of pixels at or below shadowClipLevel / at or above highlightClipLevel
+	ShadowClipPercent    float64 `json:"shadow_clip_percent"`
+	HighlightClipPercent float64 `json:"highlight_clip_percent"`
+	P1                   int     `json:"p1"`
+	P50                  int     `json:"p50"`
+	P99                  int     `json:"p99"`
+	// DynamicRange is the spread between the 1st and 99th percentiles
+	DynamicRange int `json:"dynamic_range"`
+}
+
+// histogramSet holds the luma, R, G and B histograms gathered during the metrics pass
+type histogramSet [4][256]int
+
+// add merges another set of counts into h
+func (h *histogramSet) add(other *histogramSet) {
+	for c := range h {
+		for v, n := range other[c] {
+			h[c][v] += n
+		}
+	}
+}
+
+// toneStats summarizes the histogram of one channel (0 = luma, 1-3 = R, G, B)
+func (h *histogramSet) toneStats(channel int) ToneStats {
+	hist := h[channel][:]
+	total := 0
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 {
+		return ToneStats{}
+	}
+
+	shadows, highlights := 0, 0
+	for v := 0; v <= shadowClipLevel; v++ {
+		shadows += hist[v]
+	}
+	for v := highlightClipLevel; v < 256; v++ {
+		highlights += hist[v]
+	}
+	stats := ToneStats{
+		ShadowClipPercent:    float64(shadows) / float64(total) * 100,
+		HighlightClipPercent: float64(highlights) / float64(total) * 100,
+		P1:                   percentileFromHistogram(hist, 0.01),
+		P50:                  percentileFromHistogram(hist, 0.5),
+		P99:                  percentileFromHistogram(hist, 0.99),
+	}
+	stats.DynamicRange = stats.P99 - stats.P1
+	return stats
+}
+
+// histograms copies the counts into the response form
+func (h *histogramSet) histograms() *Histograms {
+	return &Histograms{
+		Luma:  append([]int(nil), h[0][:]...),
+		Red:   append([]int(nil), h[1][:]...),
+		Green: append([]int(nil), h[2][:]...),
+		Blue:  append([]int(nil), h[3][:]...),
+	}
+}
+
+// applyToneAnalysis records the tonal statistics and flags clipping beyond the
+// profile's limits
+func (a *imageAnalyzer) applyToneAnalysis(hist *histogramSet, opts AnalysisOptions, profile QualityProfile, result *AnalysisResult) {
+	result.Tone = hist.toneStats(0)
+	for c := range result.ChannelTone {
+		result.ChannelTone[c] = hist.toneStats(c + 1)
+	}
+	if opts.IncludeHistograms {
+		result.Histograms = hist.histograms()
+	}
+
+	result.ClippedHighlights = profile.MaxHighlightClipPercent > 0 &&
+		result.Tone.HighlightClipPercent > profile.MaxHighlightClipPercent
+	result.CrushedShadows = profile.MaxShadowClipPercent > 0 &&
+		result.Tone.ShadowClipPercent > profile.MaxShadowClipPercent
+}
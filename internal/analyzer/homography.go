@@ -0,0 +1,78 @@
+package analyzer
+
+import "math"
+
+// homography is a 3x3 projective transform in row-major order
+type homography [9]float64
+
+// solveHomography returns the transform mapping each from point onto the matching to
+// point. ok is false when three of the points are collinear.
+func solveHomography(from, to [4]Point) (h homography, ok bool) {
+	// Collinear to points still give a solvable system, but a transform that flattens
+	// the quad onto a line
+	if hasCollinearTriple(from) || hasCollinearTriple(to) {
+		return homography{}, false
+	}
+	// Eight equations in the first eight entries, with h[8] fixed to 1
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		x, y, u, v := from[i].X, from[i].Y, to[i].X, to[i].Y
+		m[2*i] = [9]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u}
+		m[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v}
+	}
+	for c := 0; c < 8; c++ {
+		pivot := c
+		for r := c + 1; r < 8; r++ {
+			if math.Abs(m[r][c]) > math.Abs(m[pivot][c]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][c]) < 1e-12 {
+			return homography{}, false
+		}
+		m[c], m[pivot] = m[pivot], m[c]
+		for r := 0; r < 8; r++ {
+			if r == c {
+				continue
+			}
+			f := m[r][c] / m[c][c]
+			for k := c; k < 9; k++ {
+				m[r][k] -= f * m[c][k]
+			}
+		}
+	}
+	for i := 0; i < 8; i++ {
+		h[i] = m[i][8] / m[i][i]
+	}
+	h[8] = 1
+	return h, true
+}
+
+// hasCollinearTriple reports whether three of the points lie on a line, or so close to
+// one that the triangle they span is less than a thousandth as high as it is long
+func hasCollinearTriple(p [4]Point) bool {
+	for skip := 0; skip < 4; skip++ {
+		var t []Point
+		for i := range p {
+			if i != skip {
+				t = append(t, p[i])
+			}
+		}
+		doubleArea := math.Abs((t[1].X-t[0].X)*(t[2].Y-t[0].Y) - (t[2].X-t[0].X)*(t[1].Y-t[0].Y))
+		longest := math.Max(math.Hypot(t[1].X-t[0].X, t[1].Y-t[0].Y), math.Max(
+			math.Hypot(t[2].X-t[0].X, t[2].Y-t[0].Y), math.Hypot(t[2].X-t[1].X, t[2].Y-t[1].Y)))
+		if doubleArea < 1e-3*longest*longest {
+			return true
+		}
+	}
+	return false
+}
+
+// apply maps a point through the transform
+func (h homography) apply(p Point) Point {
+	w := h[6]*p.X + h[7]*p.Y + h[8]
+	return Point{
+		X: (h[0]*p.X + h[1]*p.Y + h[2]) / w,
+		Y: (h[3]*p.X + h[4]*p.Y + h[5]) / w,
+	}
+}
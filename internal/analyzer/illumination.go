@@ -0,0 +1,182 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// illuminationCellSize is the side, in region-level pixels, of the cells the
+	// background brightness is sampled on
+	illuminationCellSize = 32
+	// illuminationPercentile picks the paper rather than the ink in each cell
+	illuminationPercentile = 0.9
+	// illuminationZones is the number of zones per side compared for the brightness ratio
+	illuminationZones = 3
+	// shadowLevel is the share of the brightest zone below which a cell is in shadow
+	shadowLevel = 0.8
+	// minShadowCells is the share of cells a shadow must cover to be reported
+	minShadowCells = 0.05
+	// minIlluminationGradient is the brightness change across the document, relative to
+	// its mean, from which a gradient direction is reported
+	minIlluminationGradient = 0.1
+)
+
+// illuminationField is the low-frequency background brightness of an area, sampled
+// on a grid of cells
+type illuminationField struct {
+	rect       image.Rectangle
+	cols, rows int
+	values     []float64
+}
+
+// cellRect returns the pixel bounds of the cell at column c and row r
+func (f *illuminationField) cellRect(c, r int) image.Rectangle {
+	w, h := f.rect.Dx(), f.rect.Dy()
+	return image.Rect(
+		f.rect.Min.X+c*w/f.cols, f.rect.Min.Y+r*h/f.rows,
+		f.rect.Min.X+(c+1)*w/f.cols, f.rect.Min.Y+(r+1)*h/f.rows,
+	)
+}
+
+// estimateIllumination samples the background brightness of rect as a high percentile
+// of each cell, so text and other dark content is skipped, then smooths it over the
+// neighbouring cells
+func estimateIllumination(gray *image.Gray, rect image.Rectangle) *illuminationField {
+	rect = rect.Intersect(gray.Bounds())
+	cols, rows := rect.Dx()/illuminationCellSize, rect.Dy()/illuminationCellSize
+	if cols < illuminationZones || rows < illuminationZones {
+		return nil
+	}
+
+	f := &illuminationField{rect: rect, cols: cols, rows: rows}
+	raw := make([]float64, cols*rows)
+	var hist [256]int
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			hist = [256]int{}
+			cell := f.cellRect(c, r)
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				row := gray.Pix[gray.PixOffset(cell.Min.X, y):gray.PixOffset(cell.Max.X, y)]
+				for _, v := range row {
+					hist[v]++
+				}
+			}
+			raw[r*cols+c] = float64(percentileFromHistogram(hist[:], illuminationPercentile))
+		}
+	}
+
+	f.values = make([]float64, cols*rows)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			sum, n := 0.0, 0
+			for dr := -1; dr <= 1; dr++ {
+				for dc := -1; dc <= 1; dc++ {
+					if rr, cc := r+dr, c+dc; rr >= 0 && rr < rows && cc >= 0 && cc < cols {
+						sum += raw[rr*cols+cc]
+						n++
+					}
+				}
+			}
+			f.values[r*cols+c] = sum / float64(n)
+		}
+	}
+	return f
+}
+
+// zoneExtremes returns the mean brightness of the darkest and brightest of the
+// illuminationZones x illuminationZones zones
+func (f *illuminationField) zoneExtremes() (darkest, brightest float64) {
+	var sums [illuminationZones * illuminationZones]float64
+	var counts [illuminationZones * illuminationZones]int
+	for r := 0; r < f.rows; r++ {
+		for c := 0; c < f.cols; c++ {
+			z := (r*illuminationZones/f.rows)*illuminationZones + c*illuminationZones/f.cols
+			sums[z] += f.values[r*f.cols+c]
+			counts[z]++
+		}
+	}
+	darkest = math.Inf(1)
+	for z := range sums {
+		mean := sums[z] / float64(counts[z])
+		darkest = math.Min(darkest, mean)
+		brightest = math.Max(brightest, mean)
+	}
+	return darkest, brightest
+}
+
+// gradient fits a plane to the field and returns the direction in which the background
+// gets brighter, in degrees counter-clockwise from horizontal (0-360), and the
+// brightness change across the area relative to its mean
+func (f *illuminationField) gradient() (angle, strength float64) {
+	var sum, sumU, sumV, sumUU, sumVV, n float64
+	for r := 0; r < f.rows; r++ {
+		for c := 0; c < f.cols; c++ {
+			v := f.values[r*f.cols+c]
+			u, w := (float64(c)+0.5)/float64(f.cols)-0.5, (float64(r)+0.5)/float64(f.rows)-0.5
+			sum += v
+			sumU += u * v
+			sumV += w * v
+			sumUU += u * u
+			sumVV += w * w
+			n++
+		}
+	}
+	mean := sum / n
+	if mean == 0 {
+		return 0, 0
+	}
+	// The coordinates are centred and the grid is regular, so the slopes decouple
+	slopeX, slopeY := sumU/sumUU, sumV/sumVV
+	angle = math.Atan2(-slopeY, slopeX) * 180 / math.Pi
+	if angle < 0 {
+		angle += 360
+	}
+	return angle, math.Hypot(slopeX, slopeY) / mean
+}
+
+// shadowBounds returns the pixel bounds of the largest connected group of cells darker
+// than shadowLevel times the brightest zone, if it is large enough to matter
+func (f *illuminationField) shadowBounds(brightest float64) (image.Rectangle, bool) {
+	mask := make([]bool, len(f.values))
+	for i, v := range f.values {
+		mask[i] = v < shadowLevel*brightest
+	}
+	minCells := int(math.Ceil(minShadowCells * float64(len(mask))))
+	var largest *component
+	components := labelComponents(mask, f.cols, f.rows, minCells)
+	for i := range components {
+		if largest == nil || components[i].area > largest.area {
+			largest = &components[i]
+		}
+	}
+	if largest == nil {
+		return image.Rectangle{}, false
+	}
+	b := largest.bounds
+	return f.cellRect(b.Min.X, b.Min.Y).Union(f.cellRect(b.Max.X-1, b.Max.Y-1)), true
+}
+
+// applyIlluminationAnalysis measures how evenly the document area of the region level
+// is lit and flags lighting that falls below the profile's brightness ratio
+func (a *imageAnalyzer) applyIlluminationAnalysis(level *regionLevel, profile QualityProfile, result *AnalysisResult) {
+	field := estimateIllumination(level.gray, level.document)
+	if field == nil {
+		return
+	}
+
+	darkest, brightest := field.zoneExtremes()
+	if brightest == 0 {
+		return
+	}
+	result.IlluminationRatio = darkest / brightest
+	result.UnevenLighting = result.IlluminationRatio < profile.MinIlluminationRatio
+
+	if angle, strength := field.gradient(); strength >= minIlluminationGradient {
+		result.IlluminationGradientAngle = &angle
+	}
+	if shadow, ok := field.shadowBounds(brightest); ok {
+		region := regionFromRect(level.toNative(shadow))
+		result.ShadowRegion = &region
+	}
+}
@@ -3,7 +3,6 @@ package analyzer
 import (
 	"fmt"
 	"image"
-	"image/draw"
 	"math"
 	"runtime"
 	"sync"
@@ -73,6 +72,7 @@ func (wp *WorkerPool) Close() {
 
 type AnalysisResult struct {
 	Timestamp      string     `json:"timestamp"`
+	Profile        string     `json:"profile"`
 	Overexposed    bool       `json:"overexposed"`
 	Oversaturated  bool       `json:"oversaturated"`
 	IncorrectWB    bool       `json:"incorrect_white_balance"`
@@ -82,18 +82,152 @@ type AnalysisResult struct {
 	AvgSaturation  float64    `json:"average_saturation"`
 	ChannelBalance [3]float64 `json:"channel_balance"`
 
+	// Sharpness metrics; BlurMetric is the one that decided Blurry
+	BlurMetric SharpnessMetric  `json:"blur_metric"`
+	Sharpness  SharpnessMetrics `json:"sharpness_metrics"`
+
+	// Noise: estimated sigma (0-255 units) for luma and per R, G, B channel
+	Noisy      bool       `json:"noisy"`
+	NoiseLevel float64    `json:"noise_level"`
+	NoiseSigma [3]float64 `json:"noise_sigma"`
+
+	// Compression: JPEGQuality is only set when the encoded JPEG file was available
+	JPEGQuality       *int    `json:"jpeg_quality,omitempty"`
+	Blockiness        float64 `json:"blockiness"`
+	HeavilyCompressed bool    `json:"heavily_compressed"`
+
+	// Regional sharpness
+	BlurVerdict      string      `json:"blur_verdict"`
+	SharpAreaPercent float64     `json:"sharp_area_percent"`
+	BlurriestRegion  *Region     `json:"blurriest_region,omitempty"`
+	SharpnessMap     [][]float64 `json:"sharpness_map,omitempty"`
+
+	// Blur type (motion vs defocus), set when the image is blurry or partially blurry
+	BlurType         string   `json:"blur_type,omitempty"`
+	BlurAnisotropy   float64  `json:"blur_anisotropy,omitempty"`
+	MotionBlurAngle  *float64 `json:"motion_blur_angle,omitempty"`
+	MotionBlurLength *float64 `json:"motion_blur_length,omitempty"`
+
+	// White balance: colour temperature (Kelvin) of the estimated illuminant and its
+	// cast direction (neutral, warm, cool, green or magenta) and log-chromaticity strength
+	ColorTemperature  float64 `json:"color_temperature"`
+	ColorCast         string  `json:"color_cast"`
+	ColorCastStrength float64 `json:"color_cast_strength"`
+
+	// Colour of the document area: the Hasler–Süsstrunk colourfulness, the share of pixels
+	// whose chroma stands out from the document's mean, and a COLOR_ORIGINAL,
+	// GRAYSCALE_PHOTO or MONOCHROME_COPY verdict. NotColorOriginal is set when the profile
+	// requires a colour original and the verdict is another.
+	Colorfulness     float64 `json:"colorfulness"`
+	ColorPixelRatio  float64 `json:"color_pixel_ratio"`
+	ColorVerdict     string  `json:"color_verdict"`
+	NotColorOriginal bool    `json:"not_color_original"`
+
+	// Tonal distribution from 256-bin histograms of luma and R, G, B; Histograms is
+	// only returned when requested
+	Tone              ToneStats    `json:"tone"`
+	ChannelTone       [3]ToneStats `json:"channel_tone"`
+	Histograms        *Histograms  `json:"histograms,omitempty"`
+	ClippedHighlights bool         `json:"clipped_highlights"`
+	CrushedShadows    bool         `json:"crushed_shadows"`
+
+	// Contrast: RMS and Michelson (1st to 99th percentile) over the whole image,
+	// EdgeContrast around the strongest edges and TextContrast between the Otsu-split
+	// text and background of the document area, all in 0-1 units
+	RMSContrast       float64 `json:"rms_contrast"`
+	MichelsonContrast float64 `json:"michelson_contrast"`
+	EdgeContrast      float64 `json:"edge_contrast"`
+	TextContrast      float64 `json:"text_contrast"`
+	TextLuma          float64 `json:"text_luma"`
+	BackgroundLuma    float64 `json:"background_luma"`
+	LowContrast       bool    `json:"low_contrast"`
+
+	// Ink: share of the document area that Sauvola binarization marks as foreground
+	InkRatio float64 `json:"ink_ratio"`
+
+	// Blank page: BLANK, NEAR_BLANK or CONTENT from the ink ratio, edge density and
+	// detail sigma of the inner document area, with a 0.5-1 confidence
+	BlankVerdict    string  `json:"blank_verdict"`
+	BlankConfidence float64 `json:"blank_confidence"`
+	EdgeDensity     float64 `json:"edge_density"`
+	DetailSigma     float64 `json:"detail_sigma"`
+
+	// Orientation: clockwise rotation (0, 90, 180 or 270) that turns the text upright,
+	// with a 0-1 confidence. AutoRotated is set when the image was turned before the
+	// other checks ran, and all coordinates then refer to the turned image.
+	Orientation           int     `json:"orientation"`
+	OrientationConfidence float64 `json:"orientation_confidence"`
+	AutoRotated           bool    `json:"auto_rotated"`
+
+	// Screen recapture: MoireScore is the 0-1 strength of isolated periodic peaks in the
+	// spectrum, BandingScore that of periodic brightness bands, and ScreenBezel is set when
+	// a dark frame lines the document. ScreenRecapture is set when their combined 0-1
+	// RecaptureLikelihood exceeds the profile's limit.
+	MoireScore          float64 `json:"moire_score"`
+	BandingScore        float64 `json:"banding_score"`
+	ScreenBezel         bool    `json:"screen_bezel"`
+	RecaptureLikelihood float64 `json:"recapture_likelihood"`
+	ScreenRecapture     bool    `json:"screen_recapture"`
+
+	// Text: blocks of text lines in native pixel coordinates, the number of lines, the
+	// share of the image their boxes cover and their median x-height in native pixels.
+	// TextTooSmall is set for OCR images when the x-height is below the profile minimum.
+	TextBlocks    []Region `json:"text_blocks,omitempty"`
+	TextLineCount int      `json:"text_line_count"`
+	TextCoverage  float64  `json:"text_coverage"`
+	XHeight       float64  `json:"x_height"`
+	TextTooSmall  bool     `json:"text_too_small"`
+
+	// Document boundary: the largest convex quadrilateral of uniform tone, with corners
+	// clockwise from the top-left one in native pixel coordinates. DocumentRegion is its
+	// bounding box, or the spread of edges in the image when no boundary was found.
+	DocumentCorners      []Point `json:"document_corners,omitempty"`
+	DocumentAreaFraction float64 `json:"document_area_fraction"`
+	DocumentCornerCutOff bool    `json:"document_corner_cut_off"`
+	DocumentRegion       *Region `json:"document_region,omitempty"`
+
+	// Perspective of a complete document outline; PerspectiveDistorted is set when the
+	// estimated camera tilt exceeds the profile's limit
+	Perspective          *Perspective `json:"perspective,omitempty"`
+	PerspectiveDistorted bool         `json:"perspective_distorted"`
+
+	// Effective resolution of a complete document outline in pixels per inch, set when
+	// the profile declares the document's physical size
+	EffectiveDPI *float64 `json:"effective_dpi,omitempty"`
+
+	// Glare: near-white hotspots in native pixel coordinates. GlareAreaFraction is the
+	// share of the frame the hotspots cover inside the document area, and Glare is set
+	// when it exceeds what the profile allows.
+	Glare                 bool     `json:"glare"`
+	GlareRegionCount      int      `json:"glare_region_count"`
+	GlareAreaFraction     float64  `json:"glare_area_fraction"`
+	GlareRegions          []Region `json:"glare_regions,omitempty"`
+	GlareOverlapsDocument bool     `json:"glare_overlaps_document"`
+
+	// Illumination over the document area: IlluminationRatio is the darkest zone's
+	// background brightness over the brightest one's (1 for even light, or when no
+	// document was found)
+	IlluminationRatio         float64  `json:"illumination_ratio"`
+	IlluminationGradientAngle *float64 `json:"illumination_gradient_angle,omitempty"`
+	ShadowRegion              *Region  `json:"shadow_region,omitempty"`
+	UnevenLighting            bool     `json:"uneven_lighting"`
+
 	// Enhanced quality checks (when isOCR=true)
-	Resolution        string   `json:"resolution,omitempty"`
-	IsLowResolution   bool     `json:"is_low_resolution,omitempty"`
-	Brightness        float64  `json:"brightness,omitempty"`
-	IsTooDark         bool     `json:"is_too_dark,omitempty"`
-	IsTooBright       bool     `json:"is_too_bright,omitempty"`
-	SkewAngle         *float64 `json:"skew_angle,omitempty"`
-	IsSkewed          bool     `json:"is_skewed,omitempty"`
-	NumContours       int      `json:"num_contours,omitempty"`
-	HasDocumentEdges  bool     `json:"has_document_edges,omitempty"`
-	QRDetected        bool     `json:"qr_detected,omitempty"`
-	ProcessingTimeSec float64  `json:"processing_time_sec,omitempty"`
+	Resolution        string    `json:"resolution,omitempty"`
+	IsLowResolution   bool      `json:"is_low_resolution,omitempty"`
+	Brightness        float64   `json:"brightness,omitempty"`
+	IsTooDark         bool      `json:"is_too_dark,omitempty"`
+	IsTooBright       bool      `json:"is_too_bright,omitempty"`
+	SkewAngle         *float64  `json:"skew_angle,omitempty"`
+	SkewConfidence    float64   `json:"skew_confidence,omitempty"`
+	IsSkewed          bool      `json:"is_skewed,omitempty"`
+	NumContours       int       `json:"num_contours,omitempty"`
+	HasDocumentEdges  bool      `json:"has_document_edges,omitempty"`
+	QRDetected        bool      `json:"qr_detected,omitempty"`
+	QRCodes           []QRCode  `json:"qr_codes,omitempty"`
+	QRExpectedMatch   *bool     `json:"qr_expected_match,omitempty"`
+	Barcodes          []Barcode `json:"barcodes,omitempty"`
+	ProcessingTimeSec float64   `json:"processing_time_sec,omitempty"`
 
 	// OCR related fields
 	WER          float64 `json:"word_error_rate,omitempty"`
@@ -103,13 +237,17 @@ type AnalysisResult struct {
 	ExpectedText string  `json:"expected_text,omitempty"`
 
 	// Quality validation errors
-	Errors []string `json:"errors,omitempty"`
+	Errors []string       `json:"errors,omitempty"`
+	Issues []QualityIssue `json:"issues,omitempty"`
 }
 
 // ImageAnalyzer provides image analysis capabilities
 type ImageAnalyzer interface {
 	Analyze(img image.Image, isOCR bool) AnalysisResult
 	AnalyzeWithOCR(img image.Image, expectedText string) AnalysisResult
+	AnalyzeWithOptions(img image.Image, opts AnalysisOptions) AnalysisResult
+	Rectify(img image.Image, opts RectifyOptions) (RectifyResult, error)
+	Enhance(img image.Image, opts EnhanceOptions) (EnhanceResult, error)
 }
 
 type imageAnalyzer struct {
@@ -140,51 +278,178 @@ func NewImageAnalyzer() (ImageAnalyzer, error) {
 }
 
 func (a *imageAnalyzer) Analyze(img image.Image, isOCR bool) AnalysisResult {
+	return a.analyze(img, AnalysisOptions{IsOCR: isOCR, Mode: ModeAccurate})
+}
+
+// AnalyzeWithOptions performs image analysis as configured by opts.
+// OCR requests are validated the same way as AnalyzeWithOCR.
+func (a *imageAnalyzer) AnalyzeWithOptions(img image.Image, opts AnalysisOptions) AnalysisResult {
+	result := a.analyze(img, opts)
+	if opts.IsOCR {
+		a.validateQualityConditions(&result)
+	}
+	return result
+}
+
+func (a *imageAnalyzer) analyze(img image.Image, opts AnalysisOptions) AnalysisResult {
 	startTime := time.Now()
+
+	settings := opts.Mode.settings()
+	// One pyramid serves every stage, each on the level its detail needs; region
+	// analyses share the statistics level when that is smaller
+	regionDim := regionMaxDim
+	if settings.statsMaxDim > 0 {
+		regionDim = min(regionDim, settings.statsMaxDim)
+	}
+	pyramid := buildPyramid(img, regionDim)
+
+	// A sideways or upside-down page is turned upright first, so the skew, edge and text
+	// checks see it the way it is read
+	var level *regionLevel
+	var text *textLevel
+	var orientation orientationEstimate
+	oriented, autoRotated := false, false
+	if opts.AutoRotate {
+		level = newRegionLevel(pyramid.atMost(regionDim), img.Bounds())
+		text = newTextLevel(pyramid.atMost(textMaxDim), img.Bounds(), level)
+		orientation, oriented = estimateOrientation(text)
+		if oriented && orientation.rotation != 0 && orientation.confidence >= minOrientationConfidence {
+			pyramid, autoRotated = pyramid.rotate(orientation.rotation), true
+			img, level, text = pyramid.levels[0], nil, nil
+		}
+	}
+
 	bounds := img.Bounds()
+	isOCR := opts.IsOCR
 
 	// Get grayscale image from pool
 	gray := a.grayPool.Get().(*image.Gray)
 	defer a.grayPool.Put(gray)
+	*gray = *toGray(pyramid.levels[0])
+	gray.Rect = bounds
 
-	// Reset and resize the grayscale image
-	*gray = image.Gray{
-		Pix:    make([]uint8, bounds.Dx()*bounds.Dy()),
-		Stride: bounds.Dx(),
-		Rect:   bounds,
+	// Global statistics run on a downscaled pyramid level outside accurate mode
+	statsImg, statsGray := pyramid.levels[0], gray
+	if settings.statsMaxDim > 0 {
+		statsImg = pyramid.atMost(settings.statsMaxDim)
+		statsGray = toGray(statsImg)
 	}
-	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
-
-	metrics := a.calculateMetrics(img, bounds)
-	variance := a.computeLaplacianVariance(gray)
 
-	overexposedThreshold := 0.8
-	oversaturatedThreshold := 0.7
-	// Updated blurry threshold to 500 as per requirements
-	blurryThreshold := 350.0
+	metrics := a.calculateMetrics(statsImg, statsImg.Bounds())
+	noise := a.estimateNoise(pyramid.levels[0])
+	sharpness := a.computeSharpnessMetrics(gray, settings, noise.luma)
 
-	if isOCR {
-		overexposedThreshold = 0.75
-		oversaturatedThreshold = 0.65
-		// Keep the same threshold for OCR mode
-		blurryThreshold = 350.0
+	profile := DefaultProfile(isOCR)
+	if opts.Profile != nil {
+		profile = *opts.Profile
 	}
 
 	result := AnalysisResult{
 		Timestamp:      time.Now().UTC().Format(time.RFC3339),
-		Overexposed:    metrics.avgLuminance > overexposedThreshold || metrics.avgLuminance < 0.15,
-		Oversaturated:  metrics.avgSaturation > oversaturatedThreshold,
-		IncorrectWB:    a.hasWhiteBalanceIssue(metrics.avgR, metrics.avgG, metrics.avgB),
-		Blurry:         variance < blurryThreshold,
-		LaplacianVar:   variance,
+		Profile:        profile.Name,
+		Overexposed:    metrics.avgLuminance > profile.OverexposedThreshold || metrics.avgLuminance < 0.15,
+		Oversaturated:  metrics.avgSaturation > profile.OversaturatedThreshold,
+		Blurry:         sharpness.Value(profile.BlurMetric) < profile.blurThreshold(noise.luma),
+		LaplacianVar:   sharpness.LaplacianVariance,
 		AvgLuminance:   metrics.avgLuminance,
 		AvgSaturation:  metrics.avgSaturation,
 		ChannelBalance: [3]float64{metrics.avgR, metrics.avgG, metrics.avgB},
+		BlurMetric:     profile.BlurMetric,
+		Sharpness:      sharpness,
+		NoiseLevel:     noise.luma,
+		NoiseSigma:     noise.channels,
+		Noisy:          noise.luma > profile.MaxNoiseSigma,
+	}
+
+	// Clipping from the histograms gathered in the metrics pass
+	a.applyToneAnalysis(&metrics.hist, opts, profile, &result)
+
+	// Compression artifacts from recompressed (forwarded) images
+	a.applyCompressionAnalysis(gray, opts.ImageData, profile, &result)
+
+	// Region analyses run on a level no larger than regionMaxDim
+	if level == nil {
+		level = newRegionLevel(pyramid.atMost(regionDim), bounds)
+	}
+	if level.hasDocument {
+		docRegion := regionFromRect(level.toNative(level.document))
+		result.DocumentRegion = &docRegion
+	}
+	if level.quad != nil {
+		result.DocumentCorners = make([]Point, len(level.quad.corners))
+		for i, c := range level.quad.corners {
+			result.DocumentCorners[i] = level.pointToNative(c)
+		}
+		result.DocumentAreaFraction = level.quad.fraction
+		result.DocumentCornerCutOff = level.quad.cutOff
+		// Side lengths and angles are only meaningful with all four corners in view
+		if !level.quad.cutOff {
+			var corners [4]Point
+			copy(corners[:], result.DocumentCorners)
+			perspective := measurePerspective(corners, bounds.Dx(), bounds.Dy())
+			result.Perspective = &perspective
+			result.PerspectiveDistorted = perspective.CameraTilt > profile.MaxCameraTilt
+			// A photo of a whole desk can leave a small document with few pixels
+			if profile.DocumentSize != nil {
+				dpi := effectiveDPI(corners, *profile.DocumentSize)
+				result.EffectiveDPI = &dpi
+			}
+		}
+	}
+
+	// A colourful subject must not be mistaken for a tinted illuminant
+	a.applyWhiteBalanceAnalysis(level.rgba, metrics, profile, &result)
+	// Photos of black-and-white copies pass for faded colour originals
+	a.applyColorfulnessAnalysis(level, profile, &result)
+
+	// Reflections and shadows spoil text locally without moving the global averages
+	a.applyGlareAnalysis(level, profile, &result)
+	result.IlluminationRatio = 1
+	if level.hasDocument {
+		// Without a document, dark areas are as likely to be content as shadow
+		a.applyIlluminationAnalysis(level, profile, &result)
+	}
+
+	// Faded prints keep their brightness but lose the gap between ink and paper
+	a.applyContrastAnalysis(gray, level, &metrics.hist, profile, &result)
+	bin := binarize(level.gray, BinarizeOptions{})
+	result.InkRatio = inkRatio(bin, level.document)
+	// Blank backs of pages and empty tables carry neither ink nor edges nor detail
+	a.applyBlankAnalysis(level, bin, &result)
+	// Text is read on a finer copy of the document, where small print keeps its shape
+	if text == nil && (!settings.textOnDemand || isOCR) {
+		text = newTextLevel(pyramid.atMost(textMaxDim), bounds, level)
+	}
+	if text != nil {
+		a.applyTextAnalysis(text, &result)
+		// Text lines give the page orientation, unless it was judged before turning the page
+		if !opts.AutoRotate {
+			orientation, oriented = estimateOrientation(text)
+		}
+	}
+	if oriented {
+		result.Orientation, result.OrientationConfidence = orientation.rotation, orientation.confidence
+	}
+	result.AutoRotated = autoRotated
+
+	// Documents photographed off a screen carry the screen's pixel grid and refresh
+	a.applyRecaptureAnalysis(gray, level, profile, &result)
+
+	// Per-tile sharpness catches images that are only partly out of focus
+	a.applyRegionalSharpness(gray, opts, settings, profile.laplacianThreshold(noise.luma), &result)
+	// Motion and defocus blur need different guidance
+	a.applyMotionBlurAnalysis(gray, &result)
+	// QR codes and barcodes are scanned at native resolution, where their modules are largest
+	if !settings.qrOnDemand || opts.ExpectedQRPayload != "" {
+		a.applyQRAnalysis(gray, opts, &result)
+	}
+	if !settings.skipBarcodes {
+		a.applyBarcodeAnalysis(gray, &result)
 	}
 
 	// Enhanced quality checks when isOCR is true
 	if isOCR {
-		a.performEnhancedQualityChecks(img, gray, &result)
+		a.performEnhancedQualityChecks(img, statsGray, level, profile, &result)
 	} else {
 		// For non-OCR analysis, validate basic quality conditions
 		a.validateBasicQualityConditions(&result)
@@ -197,6 +462,7 @@ func (a *imageAnalyzer) Analyze(img image.Image, isOCR bool) AnalysisResult {
 type metrics struct {
 	avgLuminance, avgSaturation float64
 	avgR, avgG, avgB            float64
+	hist                        histogramSet
 }
 
 func (a *imageAnalyzer) calculateMetrics(img image.Image, bounds image.Rectangle) metrics {
@@ -211,14 +477,21 @@ func (a *imageAnalyzer) calculateMetrics(img image.Image, bounds image.Rectangle
 	numRows := bounds.Dy()
 	results := make(chan result, numRows)
 
+	// Row histograms are merged under a lock rather than sent with the results, which
+	// would buffer a full histogram set per row
+	var hist histogramSet
+	var histMu sync.Mutex
+
 	// Process rows using worker pool instead of unbounded goroutines
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		y := y // Capture loop variable
 		a.workerPool.Submit(func() {
 			var lum, sat, r, g, b float64
+			var rowHist histogramSet
 			for x := bounds.Min.X; x < bounds.Max.X; x++ {
 				rVal, gVal, bVal, _ := img.At(x, y).RGBA()
-				rf, gf, bf := float64(rVal>>8), float64(gVal>>8), float64(bVal>>8)
+				r8, g8, b8 := rVal>>8, gVal>>8, bVal>>8
+				rf, gf, bf := float64(r8), float64(g8), float64(b8)
 
 				_, s, v := a.rgbToHSV(rf, gf, bf)
 				sat += s
@@ -227,7 +500,15 @@ func (a *imageAnalyzer) calculateMetrics(img image.Image, bounds image.Rectangle
 				r += rf
 				g += gf
 				b += bf
+
+				rowHist[0][(299*r8+587*g8+114*b8+500)/1000]++
+				rowHist[1][r8]++
+				rowHist[2][g8]++
+				rowHist[3][b8]++
 			}
+			histMu.Lock()
+			hist.add(&rowHist)
+			histMu.Unlock()
 			results <- result{lum, sat, r, g, b}
 		})
 	}
@@ -251,6 +532,7 @@ func (a *imageAnalyzer) calculateMetrics(img image.Image, bounds image.Rectangle
 		avgR:          totalR / pixelCount,
 		avgG:          totalG / pixelCount,
 		avgB:          totalB / pixelCount,
+		hist:          hist,
 	}
 }
 
@@ -286,28 +568,32 @@ func (a *imageAnalyzer) rgbToHSV(r, g, b float64) (h, s, v float64) {
 }
 
 func (a *imageAnalyzer) computeLaplacianVariance(gray *image.Gray) float64 {
-	bounds := gray.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
-
-	var sum, sumSq float64
-	kernel := [3][3]int{{0, 1, 0}, {1, -4, 1}, {0, 1, 0}}
+	var sum, sumSq, n float64
+	a.accumulateLaplacian(gray, gray.Bounds(), &sum, &sumSq, &n)
+	return varianceOf(sum, sumSq, n)
+}
 
-	for y := 1; y < height-1; y++ {
-		for x := 1; x < width-1; x++ {
-			var val int
-			for ky := -1; ky <= 1; ky++ {
-				for kx := -1; kx <= 1; kx++ {
-					pixel := int(gray.GrayAt(x+kx, y+ky).Y)
-					val += pixel * kernel[ky+1][kx+1]
-				}
-			}
+// accumulateLaplacian adds the 4-neighbour Laplacian responses of the interior of rect to the running sums
+func (a *imageAnalyzer) accumulateLaplacian(gray *image.Gray, rect image.Rectangle, sum, sumSq, n *float64) {
+	rect = rect.Intersect(gray.Bounds())
+	stride := gray.Stride
+
+	for y := rect.Min.Y + 1; y < rect.Max.Y-1; y++ {
+		row := gray.PixOffset(rect.Min.X, y)
+		for x := 1; x < rect.Dx()-1; x++ {
+			i := row + x
+			val := int(gray.Pix[i-stride]) + int(gray.Pix[i+stride]) +
+				int(gray.Pix[i-1]) + int(gray.Pix[i+1]) - 4*int(gray.Pix[i])
 			fVal := float64(val)
-			sum += fVal
-			sumSq += fVal * fVal
+			*sum += fVal
+			*sumSq += fVal * fVal
+			*n++
 		}
 	}
+}
 
-	n := float64((width - 2) * (height - 2))
+// varianceOf returns the variance of a sample described by its running sums
+func varianceOf(sum, sumSq, n float64) float64 {
 	if n == 0 {
 		return 0
 	}
@@ -315,58 +601,51 @@ func (a *imageAnalyzer) computeLaplacianVariance(gray *image.Gray) float64 {
 	return (sumSq / n) - (mean * mean)
 }
 
-func (a *imageAnalyzer) hasWhiteBalanceIssue(avgR, avgG, avgB float64) bool {
-	avg := (avgR + avgG + avgB) / 3
-	maxDeviation := 0.15 * avg // 15% tolerance
-	return math.Abs(avgR-avg) > maxDeviation ||
-		math.Abs(avgG-avg) > maxDeviation ||
-		math.Abs(avgB-avg) > maxDeviation
-}
-
 // AnalyzeWithOCR performs image analysis with OCR quality checks but without actual OCR processing
 func (a *imageAnalyzer) AnalyzeWithOCR(img image.Image, expectedText string) AnalysisResult {
-	// Perform standard image analysis with OCR quality checks
-	result := a.Analyze(img, true)
-	// Validate quality check conditions and populate errors
-	a.validateQualityConditions(&result)
-
-	return result
+	// Perform standard image analysis with OCR quality checks and validate the conditions
+	return a.AnalyzeWithOptions(img, AnalysisOptions{IsOCR: true, ExpectedText: expectedText, Mode: ModeAccurate})
 }
 
-// performEnhancedQualityChecks performs comprehensive image quality analysis
-func (a *imageAnalyzer) performEnhancedQualityChecks(img image.Image, gray *image.Gray, result *AnalysisResult) {
+// performEnhancedQualityChecks performs comprehensive image quality analysis.
+// statsGray is the (possibly downscaled) grayscale level used for global statistics.
+func (a *imageAnalyzer) performEnhancedQualityChecks(img image.Image, statsGray *image.Gray, level *regionLevel, profile QualityProfile, result *AnalysisResult) {
 	bounds := img.Bounds()
 	width, height := bounds.Dx(), bounds.Dy()
 
-	// Resolution check
+	// Resolution check: legibility is judged by the x-height of the text when there is
+	// text. A document of known size must reach the profile's DPI, and the pixel size of
+	// the image is only judged when neither applies.
 	result.Resolution = fmt.Sprintf("%dx%d", width, height)
-	// Updated threshold: width < 800 or height < 1000 or total pixels < 800,000
-	result.IsLowResolution = width < 600 || height < 600 || (width*height < 360000)
+	if result.TextLineCount > 0 {
+		result.TextTooSmall = result.XHeight < profile.MinXHeight
+	}
+	if result.EffectiveDPI != nil {
+		result.IsLowResolution = *result.EffectiveDPI < profile.MinDPI
+	} else if result.TextLineCount == 0 {
+		result.IsLowResolution = width < 600 || height < 600
+	}
 
 	// Brightness analysis
-	brightness := a.calculateBrightness(gray)
+	brightness := a.calculateBrightness(statsGray)
 	result.Brightness = brightness
 	// Updated thresholds: too dark < 80, too bright > 220
 	result.IsTooDark = brightness <= 100
 	result.IsTooBright = brightness >= 240
 
-	// Skew detection
-	skewAngle := a.detectSkew(gray)
-	if skewAngle != nil {
-		result.SkewAngle = skewAngle
-		// Threshold remains at 5 degrees as per requirements
-		result.IsSkewed = math.Abs(*skewAngle) > 15
-	} else {
-		result.IsSkewed = true // Unable to detect skew, assume skewed
+	// Skew of the text lines in the document area; an image without text is not skewed
+	if skew, ok := estimateSkew(level.gray, level.document); ok {
+		result.SkewAngle = &skew.angle
+		result.SkewConfidence = skew.confidence
+		result.IsSkewed = skew.confidence >= minSkewConfidence && math.Abs(skew.angle) > profile.MaxSkewAngle
 	}
 
-	// Edge detection and contour analysis
-	numContours := a.detectContours(gray)
+	// Edge detection and contour analysis, on the statistics level like the other
+	// whole-image counts
+	numContours := a.detectContours(statsGray)
 	result.NumContours = numContours
-	result.HasDocumentEdges = numContours >= 1
-
-	// QR code detection
-	result.QRDetected = a.detectQRCode(img)
+	// The whole paper is visible when its boundary was found with no corner cut off
+	result.HasDocumentEdges = len(result.DocumentCorners) == 4 && !result.DocumentCornerCutOff
 }
 
 // calculateBrightness calculates the average brightness of a grayscale image
@@ -384,84 +663,6 @@ func (a *imageAnalyzer) calculateBrightness(gray *image.Gray) float64 {
 	return sum / pixelCount
 }
 
-// detectSkew detects the skew angle of the document in the image
-func (a *imageAnalyzer) detectSkew(gray *image.Gray) *float64 {
-	bounds := gray.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-
-	// Simple threshold to create binary image
-	threshold := uint8(128)
-	coords := make([][2]int, 0)
-
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			if gray.GrayAt(x, y).Y > threshold {
-				coords = append(coords, [2]int{x, y})
-			}
-		}
-	}
-
-	if len(coords) == 0 {
-		return nil
-	}
-
-	// Simple skew detection using line fitting
-	// This is a simplified version - in practice you'd use more sophisticated methods
-	angle := a.calculateSkewAngle(coords, width, height)
-
-	// Normalize angle
-	if angle < -45 {
-		angle = -(90 + angle)
-	} else {
-		angle = -angle
-	}
-
-	// Handle near-vertical cases
-	if math.Abs(angle-90) < 0.5 || math.Abs(angle-89.5) < 0.5 ||
-		math.Abs(angle-90.5) < 0.5 || math.Abs(angle-89) < 0.5 ||
-		math.Abs(angle-91) < 0.5 {
-		angle = 0.0
-	}
-
-	return &angle
-}
-
-// calculateSkewAngle calculates skew angle from coordinates using simple linear regression
-func (a *imageAnalyzer) calculateSkewAngle(coords [][2]int, width, height int) float64 {
-	if len(coords) < 2 {
-		return 0.0
-	}
-
-	// Sample a subset of coordinates for performance
-	step := len(coords) / 1000
-	if step < 1 {
-		step = 1
-	}
-
-	var sumX, sumY, sumXY, sumX2 float64
-	n := 0
-
-	for i := 0; i < len(coords); i += step {
-		x := float64(coords[i][0])
-		y := float64(coords[i][1])
-		sumX += x
-		sumY += y
-		sumXY += x * y
-		sumX2 += x * x
-		n++
-	}
-
-	if n < 2 || sumX2 == 0 {
-		return 0.0
-	}
-
-	// Linear regression to find slope
-	slope := (float64(n)*sumXY - sumX*sumY) / (float64(n)*sumX2 - sumX*sumX)
-	angle := math.Atan(slope) * 180 / math.Pi
-
-	return angle
-}
-
 // detectContours detects contours in the image using simple edge detection
 func (a *imageAnalyzer) detectContours(gray *image.Gray) int {
 	bounds := gray.Bounds()
@@ -525,137 +726,88 @@ func (a *imageAnalyzer) floodFill(edges, visited [][]bool, startX, startY, width
 	}
 }
 
-// detectQRCode detects QR codes in the image
-func (a *imageAnalyzer) detectQRCode(img image.Image) bool {
-	// Simple QR code detection using pattern matching
-	// This is a simplified implementation since gozxing setup is complex
-	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-
-	// Convert to grayscale for pattern detection
-	gray := image.NewGray(bounds)
-	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
-
-	// Look for QR code finder patterns (simplified detection)
-	// QR codes have distinctive square patterns in corners
-	return a.hasQRPattern(gray, width, height)
-}
-
-// hasQRPattern performs simplified QR code pattern detection
-func (a *imageAnalyzer) hasQRPattern(gray *image.Gray, width, height int) bool {
-	// Look for square patterns that might indicate QR code finder patterns
-	minSize := 7          // Minimum size for QR finder pattern
-	maxSize := width / 10 // Maximum reasonable size
-
-	if maxSize < minSize {
-		return false
+// addQRIssues reports a missing or unreadable expected QR code, or one with another payload
+func (a *imageAnalyzer) addQRIssues(result *AnalysisResult, issues *issueList) {
+	if result.QRExpectedMatch == nil || *result.QRExpectedMatch {
+		return
 	}
-
-	// Check corners for finder patterns
-	corners := [][2]int{
-		{0, 0},                // Top-left
-		{width - maxSize, 0},  // Top-right
-		{0, height - maxSize}, // Bottom-left
-	}
-
-	foundPatterns := 0
-	for _, corner := range corners {
-		if a.checkFinderPattern(gray, corner[0], corner[1], minSize, maxSize) {
-			foundPatterns++
+	for _, code := range result.QRCodes {
+		if code.Decoded {
+			issues.add(IssueQRMismatch, "The QR code does not match this application. Make sure you photograph the right document.")
+			return
 		}
 	}
-
-	// If we find at least 2 finder patterns, likely a QR code
-	return foundPatterns >= 2
+	issues.add(IssueQRUnreadable, "The QR code could not be read. Make sure the whole code is in view, in focus and free of glare.")
 }
 
-// checkFinderPattern checks for QR code finder pattern at given location
-func (a *imageAnalyzer) checkFinderPattern(gray *image.Gray, startX, startY, minSize, maxSize int) bool {
-	bounds := gray.Bounds()
-
-	for size := minSize; size <= maxSize; size++ {
-		if startX+size >= bounds.Max.X || startY+size >= bounds.Max.Y {
-			continue
-		}
-
-		// Check for alternating dark-light-dark pattern
-		centerX, centerY := startX+size/2, startY+size/2
-
-		// Sample points in a cross pattern
-		if a.isQRFinderPattern(gray, centerX, centerY, size/3) {
-			return true
+// addBarcodeIssues reports barcodes whose bars were found but could not be read
+func (a *imageAnalyzer) addBarcodeIssues(result *AnalysisResult, issues *issueList) {
+	for _, barcode := range result.Barcodes {
+		if !barcode.Decoded {
+			issues.add(IssueBarcodeUnreadable, "A barcode could not be read. Hold the camera closer and keep the barcode in focus and free of glare.")
+			return
 		}
 	}
-
-	return false
 }
 
-// isQRFinderPattern checks if the pattern at given center looks like QR finder pattern
-func (a *imageAnalyzer) isQRFinderPattern(gray *image.Gray, centerX, centerY, radius int) bool {
-	bounds := gray.Bounds()
-
-	if centerX-radius < bounds.Min.X || centerX+radius >= bounds.Max.X ||
-		centerY-radius < bounds.Min.Y || centerY+radius >= bounds.Max.Y {
-		return false
-	}
-
-	// Check if center is dark
-	centerPixel := gray.GrayAt(centerX, centerY).Y
-	if centerPixel > 128 { // Not dark enough
-		return false
-	}
-
-	// Check if corners are lighter (simplified check)
-	corners := [][2]int{
-		{centerX - radius, centerY - radius},
-		{centerX + radius, centerY - radius},
-		{centerX - radius, centerY + radius},
-		{centerX + radius, centerY + radius},
+// addColorOriginalIssue reports a document that is not the required colour original,
+// with guidance for a copy or a photo without colour
+func (a *imageAnalyzer) addColorOriginalIssue(result *AnalysisResult, issues *issueList) {
+	if result.ColorVerdict == ColorVerdictMonochrome {
+		issues.add(IssueNotColorOriginal, "The document appears to be a black-and-white copy. Photograph the original colour document.")
+		return
 	}
+	issues.add(IssueNotColorOriginal, "The photo has no colour. Turn off black-and-white camera filters and photograph the original colour document.")
+}
 
-	lightCorners := 0
-	for _, corner := range corners {
-		if gray.GrayAt(corner[0], corner[1]).Y > 128 {
-			lightCorners++
-		}
+// addBlurIssues reports blur, using motion or defocus guidance when the blur type is known
+func (a *imageAnalyzer) addBlurIssues(result *AnalysisResult, issues *issueList) {
+	switch {
+	case !result.Blurry && result.BlurVerdict != BlurVerdictPartiallyBlurry:
+		return
+	case result.BlurType == BlurTypeMotion:
+		issues.add(IssueMotionBlur, "Image is blurred by camera movement. Hold the phone still while clicking.")
+	case result.Blurry && result.BlurType == BlurTypeDefocus:
+		issues.add(IssueDefocusBlur, "Image is out of focus. Tap on the document to focus before clicking.")
+	case result.Blurry:
+		issues.add(IssueBlurry, "Image is blurry. Please hold the camera steady and try again.")
+	default:
+		issues.add(IssuePartiallyBlurry, "Part of the image is out of focus. Tap on the document to focus and try again.")
 	}
-
-	// If most corners are light and center is dark, might be finder pattern
-	return lightCorners >= 2
 }
 
 // validateQualityConditions checks all quality conditions and populates the errors array
 // validateBasicQualityConditions validates basic image quality for non-OCR analysis
 func (a *imageAnalyzer) validateBasicQualityConditions(result *AnalysisResult) {
-	var errors []string
+	var issues issueList
 
-	// 1. Blurriness (Laplacian Variance)
-	if result.LaplacianVar <= 350 {
-		errors = append(errors, "Image is blurry. Please hold the camera steady and try again.")
-	}
+	// 1. Blurriness (profile sharpness metric)
+	a.addBlurIssues(result, &issues)
 
 	// 2. Overexposure / Oversaturation
 	if result.Overexposed {
-		errors = append(errors, "Image has too much light. Move to a less bright area.")
+		issues.add(IssueOverexposed, "Image has too much light. Move to a less bright area.")
 	}
 	if result.Oversaturated {
-		errors = append(errors, "Colors are too strong. Use normal light while clicking.")
+		issues.add(IssueOversaturated, "Colors are too strong. Use normal light while clicking.")
 	}
 
 	// 3. White Balance
 	if result.IncorrectWB {
-		errors = append(errors, "Colors in the photo don't look natural. Use normal lighting.")
+		issues.add(IssueIncorrectWhiteBalance, "Colors in the photo don't look natural. Use normal lighting.")
 	}
 
 	// 4. Average Luminance & Saturation
 	if result.AvgLuminance <= 0.2 {
-		errors = append(errors, "Image is very dull. Use more light.")
+		issues.add(IssueLowLuminance, "Image is very dull. Use more light.")
 	} else if result.AvgLuminance >= 0.9 {
-		errors = append(errors, "Image is too bright. Take it in normal light.")
+		issues.add(IssueHighLuminance, "Image is too bright. Take it in normal light.")
 	}
 
-	if result.AvgSaturation <= 0.05 {
-		errors = append(errors, "Image looks faded. Use proper lighting.")
+	if result.NotColorOriginal {
+		a.addColorOriginalIssue(result, &issues)
+	} else if result.AvgSaturation <= 0.05 {
+		issues.add(IssueFaded, "Image looks faded. Use proper lighting.")
 	}
 
 	// 5. Channel Balance
@@ -663,62 +815,112 @@ func (a *imageAnalyzer) validateBasicQualityConditions(result *AnalysisResult) {
 	if math.Abs(channels[0]-channels[1]) >= 50 ||
 		math.Abs(channels[0]-channels[2]) >= 50 ||
 		math.Abs(channels[1]-channels[2]) >= 50 {
-		errors = append(errors, "Colors look odd. Don't use filters or colored lights.")
+		issues.add(IssueChannelImbalance, "Colors look odd. Don't use filters or colored lights.")
+	}
+
+	// 6. Noise
+	if result.Noisy {
+		issues.add(IssueNoisy, "Image is grainy. Use more light and avoid digital zoom.")
+	}
+
+	// 7. Compression
+	if result.HeavilyCompressed {
+		issues.add(IssueHeavilyCompressed, "Image is heavily compressed. Send the original photo, not a forwarded copy or screenshot.")
 	}
 
-	// Set the errors in the result if any were found
-	if len(errors) > 0 {
-		result.Errors = errors
+	// 8. Glare
+	if result.Glare {
+		issues.add(IssueGlare, "Light is reflecting off the document. Tilt the card slightly to avoid reflections.")
 	}
+
+	// 9. Illumination
+	if result.UnevenLighting {
+		issues.add(IssueUnevenLighting, "Part of the document is in shadow. Make sure light falls evenly and your shadow is not on the paper.")
+	}
+
+	// 10. Clipping
+	if result.ClippedHighlights {
+		issues.add(IssueClippedHighlights, "Bright parts of the image are washed out. Avoid direct light or flash on the document.")
+	}
+	if result.CrushedShadows {
+		issues.add(IssueCrushedShadows, "Dark parts of the image have lost detail. Use more light.")
+	}
+
+	// 11. Perspective
+	if result.PerspectiveDistorted {
+		issues.add(IssuePerspectiveDistorted, "Photo is taken at an angle. Hold the phone parallel to the document, directly above it.")
+	}
+
+	// 12. Expected QR code
+	a.addQRIssues(result, &issues)
+
+	// 13. Barcodes
+	a.addBarcodeIssues(result, &issues)
+
+	// 14. Blank page
+	if result.BlankVerdict == BlankVerdictBlank {
+		issues.add(IssueBlankPage, "The page appears to be blank. Photograph the side of the document with the content.")
+	}
+
+	// 15. Screen recapture
+	if result.ScreenRecapture {
+		issues.add(IssueScreenRecapture, "The document appears to be photographed from a screen. Photograph the original document.")
+	}
+
+	// Set the issues and their messages in the result if any were found
+	issues.apply(result)
 }
 
 // validateQualityConditions validates comprehensive image quality for OCR analysis
 func (a *imageAnalyzer) validateQualityConditions(result *AnalysisResult) {
-	var errors []string
+	var issues issueList
 
 	// 1. Resolution & Low Resolution
-	// Check if width × height < 800,000 pixels, or width < 800 or height < 1000
-	if result.IsLowResolution {
-		errors = append(errors, "Image is too small or unclear. Please take a clearer photo.")
+	// Check if the x-height of the text is below the profile minimum, if the document's
+	// effective DPI is below the profile minimum or, without either, if width or height < 600
+	if result.TextTooSmall {
+		issues.add(IssueTextTooSmall, "Text is too small to read. Move the camera closer to the document.")
 	}
-
-	// 2. Blurriness (Laplacian Variance)
-	// Check if laplacian_variance < 500
-	if result.LaplacianVar <= 350 {
-		errors = append(errors, "Image is blurry. Please hold the camera steady and try again.")
+	if result.IsLowResolution && result.EffectiveDPI != nil {
+		issues.add(IssueLowResolution, "Document is too small in the photo. Move the camera closer so the document fills the frame.")
+	} else if result.IsLowResolution {
+		issues.add(IssueLowResolution, "Image is too small or unclear. Please take a clearer photo.")
 	}
 
+	// 2. Blurriness (profile sharpness metric)
+	a.addBlurIssues(result, &issues)
+
 	// 3. Brightness
 	// Check if brightness < 80 (too dark) or > 220 (too bright)
 	if result.IsTooDark {
-		errors = append(errors, "Image is too dark. Take the photo in more light.")
+		issues.add(IssueTooDark, "Image is too dark. Take the photo in more light.")
 	}
 	if result.IsTooBright {
-		errors = append(errors, "Image is too bright. Avoid strong sunlight or flash.")
+		issues.add(IssueTooBright, "Image is too bright. Avoid strong sunlight or flash.")
 	}
 
 	// 4. Overexposure / Oversaturation
 	if result.Overexposed {
-		errors = append(errors, "Image has too much light. Move to a less bright area.")
+		issues.add(IssueOverexposed, "Image has too much light. Move to a less bright area.")
 	}
 	if result.Oversaturated {
-		errors = append(errors, "Colors are too strong. Use normal light while clicking.")
+		issues.add(IssueOversaturated, "Colors are too strong. Use normal light while clicking.")
 	}
 
 	// 5. White Balance
 	if result.IncorrectWB {
-		errors = append(errors, "Colors in the photo don’t look natural. Use normal lighting.")
+		issues.add(IssueIncorrectWhiteBalance, "Colors in the photo don’t look natural. Use normal lighting.")
 	}
 
 	// 6. Skew
-	// Check if abs(skew_angle) > 5°
+	// Check if abs(skew_angle) exceeds the profile maximum
 	if result.IsSkewed {
-		errors = append(errors, "Image is tilted. Hold the phone straight while clicking.")
+		issues.add(IssueSkewed, "Image is tilted. Hold the phone straight while clicking.")
 	}
 
 	// 7. Document Edges
 	if !result.HasDocumentEdges {
-		errors = append(errors, "Full paper is not visible. Make sure all corners are inside the photo.")
+		issues.add(IssueMissingDocumentEdges, "Full paper is not visible. Make sure all corners are inside the photo.")
 	}
 
 	// 8. Contour Count
@@ -732,14 +934,17 @@ func (a *imageAnalyzer) validateQualityConditions(result *AnalysisResult) {
 	// 9. Average Luminance & Saturation
 	// Check if average_luminance < 0.2 or > 0.9
 	if result.AvgLuminance <= 0.2 {
-		errors = append(errors, "Image is very dull. Use more light.")
+		issues.add(IssueLowLuminance, "Image is very dull. Use more light.")
 	} else if result.AvgLuminance >= 0.9 {
-		errors = append(errors, "Image is too bright. Take it in normal light.")
+		issues.add(IssueHighLuminance, "Image is too bright. Take it in normal light.")
 	}
 
-	// Check if average_saturation < 0.05 (potentially grayscale or faded)
-	if result.AvgSaturation <= 0.05 {
-		errors = append(errors, "Image looks faded. Use proper lighting.")
+	// Check if the document must be a colour original or, otherwise, if
+	// average_saturation < 0.05 (potentially grayscale or faded)
+	if result.NotColorOriginal {
+		a.addColorOriginalIssue(result, &issues)
+	} else if result.AvgSaturation <= 0.05 {
+		issues.add(IssueFaded, "Image looks faded. Use proper lighting.")
 	}
 
 	// 10. Channel Balance
@@ -748,11 +953,63 @@ func (a *imageAnalyzer) validateQualityConditions(result *AnalysisResult) {
 	if math.Abs(channels[0]-channels[1]) >= 50 ||
 		math.Abs(channels[0]-channels[2]) >= 50 ||
 		math.Abs(channels[1]-channels[2]) >= 50 {
-		errors = append(errors, "Colors look odd. Don’t use filters or colored lights.")
+		issues.add(IssueChannelImbalance, "Colors look odd. Don’t use filters or colored lights.")
+	}
+
+	// 11. Noise
+	if result.Noisy {
+		issues.add(IssueNoisy, "Image is grainy. Use more light and avoid digital zoom.")
 	}
 
-	// Set the errors in the result if any were found
-	if len(errors) > 0 {
-		result.Errors = errors
+	// 12. Compression
+	if result.HeavilyCompressed {
+		issues.add(IssueHeavilyCompressed, "Image is heavily compressed. Send the original photo, not a forwarded copy or screenshot.")
 	}
+
+	// 13. Glare
+	if result.Glare {
+		issues.add(IssueGlare, "Light is reflecting off the document. Tilt the card slightly to avoid reflections.")
+	}
+
+	// 14. Illumination
+	if result.UnevenLighting {
+		issues.add(IssueUnevenLighting, "Part of the document is in shadow. Make sure light falls evenly and your shadow is not on the paper.")
+	}
+
+	// 15. Clipping
+	if result.ClippedHighlights {
+		issues.add(IssueClippedHighlights, "Bright parts of the image are washed out. Avoid direct light or flash on the document.")
+	}
+	if result.CrushedShadows {
+		issues.add(IssueCrushedShadows, "Dark parts of the image have lost detail. Use more light.")
+	}
+
+	// 16. Contrast
+	if result.LowContrast {
+		issues.add(IssueLowContrast, "Text is too faint. Use more light, or scan the original instead of a faded copy.")
+	}
+
+	// 17. Perspective
+	if result.PerspectiveDistorted {
+		issues.add(IssuePerspectiveDistorted, "Photo is taken at an angle. Hold the phone parallel to the document, directly above it.")
+	}
+
+	// 18. Expected QR code
+	a.addQRIssues(result, &issues)
+
+	// 19. Barcodes
+	a.addBarcodeIssues(result, &issues)
+
+	// 20. Blank page
+	if result.BlankVerdict == BlankVerdictBlank {
+		issues.add(IssueBlankPage, "The page appears to be blank. Photograph the side of the document with the content.")
+	}
+
+	// 21. Screen recapture
+	if result.ScreenRecapture {
+		issues.add(IssueScreenRecapture, "The document appears to be photographed from a screen. Photograph the original document.")
+	}
+
+	// Set the issues and their messages in the result if any were found
+	issues.apply(result)
 }
@@ -0,0 +1,64 @@
+package analyzer
+
+// IssueCode identifies a quality problem in a machine-readable way
+type IssueCode string
+
+const (
+	IssueLowResolution         IssueCode = "LOW_RESOLUTION"
+	IssueBlurry                IssueCode = "BLURRY"
+	IssuePartiallyBlurry       IssueCode = "PARTIALLY_BLURRY"
+	IssueMotionBlur            IssueCode = "MOTION_BLUR"
+	IssueDefocusBlur           IssueCode = "DEFOCUS_BLUR"
+	IssueTooDark               IssueCode = "TOO_DARK"
+	IssueTooBright             IssueCode = "TOO_BRIGHT"
+	IssueOverexposed           IssueCode = "OVEREXPOSED"
+	IssueOversaturated         IssueCode = "OVERSATURATED"
+	IssueIncorrectWhiteBalance IssueCode = "INCORRECT_WHITE_BALANCE"
+	IssueSkewed                IssueCode = "SKEWED"
+	IssueMissingDocumentEdges  IssueCode = "MISSING_DOCUMENT_EDGES"
+	IssueLowLuminance          IssueCode = "LOW_LUMINANCE"
+	IssueHighLuminance         IssueCode = "HIGH_LUMINANCE"
+	IssueFaded                 IssueCode = "FADED"
+	IssueChannelImbalance      IssueCode = "CHANNEL_IMBALANCE"
+	IssueNoisy                 IssueCode = "NOISY"
+	IssueHeavilyCompressed     IssueCode = "HEAVILY_COMPRESSED"
+	IssueGlare                 IssueCode = "GLARE"
+	IssueUnevenLighting        IssueCode = "UNEVEN_LIGHTING"
+	IssueClippedHighlights     IssueCode = "CLIPPED_HIGHLIGHTS"
+	IssueCrushedShadows        IssueCode = "CRUSHED_SHADOWS"
+	IssueLowContrast           IssueCode = "LOW_CONTRAST"
+	IssuePerspectiveDistorted  IssueCode = "PERSPECTIVE_DISTORTED"
+	IssueQRUnreadable          IssueCode = "QR_UNREADABLE"
+	IssueQRMismatch            IssueCode = "QR_MISMATCH"
+	IssueBarcodeUnreadable     IssueCode = "BARCODE_UNREADABLE"
+	IssueBlankPage             IssueCode = "BLANK_PAGE"
+	IssueTextTooSmall          IssueCode = "TEXT_TOO_SMALL"
+	IssueScreenRecapture       IssueCode = "SCREEN_RECAPTURE"
+	IssueNotColorOriginal      IssueCode = "NOT_COLOR_ORIGINAL"
+)
+
+// QualityIssue is a quality problem together with the guidance shown to the user
+type QualityIssue struct {
+	Code    IssueCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// issueList collects quality issues while validating a result
+type issueList []QualityIssue
+
+// add records an issue with its user-facing message
+func (l *issueList) add(code IssueCode, message string) {
+	*l = append(*l, QualityIssue{Code: code, Message: message})
+}
+
+// apply stores the issues in the result, mirroring their messages in Errors
+func (l issueList) apply(result *AnalysisResult) {
+	if len(l) == 0 {
+		return
+	}
+	result.Issues = l
+	result.Errors = make([]string, len(l))
+	for i, issue := range l {
+		result.Errors[i] = issue.Message
+	}
+}
@@ -0,0 +1,196 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+// Blur types reported in AnalysisResult.BlurType
+const (
+	BlurTypeMotion  = "motion"
+	BlurTypeDefocus = "defocus"
+)
+
+const (
+	// minMotionAnisotropy is the gradient anisotropy below which blur is always treated
+	// as defocus; defocus attenuates all directions equally
+	minMotionAnisotropy = 0.15
+	// minStreakRatio is how much deeper the streak must be along the motion direction than
+	// across it. Defocus produces the same ring in every direction, motion only along one.
+	minStreakRatio = 1.3
+	// maxMotionBlurLength is the longest blur streak, in pixels, the estimator searches for
+	maxMotionBlurLength = 64
+	// motionWindowSize bounds the window used for the blur length autocorrelation
+	motionWindowSize = 1024
+	// motionSampleTarget is the approximate number of pixels sampled for gradient statistics
+	motionSampleTarget = 250000
+)
+
+// motionBlurEstimate describes the directional character of the blur in an image
+type motionBlurEstimate struct {
+	// anisotropy is 0 for isotropic gradients and approaches 1 when one direction dominates
+	anisotropy float64
+	// angle is the motion direction in degrees counter-clockwise from horizontal, in [0, 180)
+	angle float64
+	// length is the estimated streak length in pixels, 0 when it could not be measured
+	length float64
+	// streakStrength is the depth of the negative autocorrelation peak at length, in [0, 1]
+	streakStrength float64
+	// crossStrength is the same measurement perpendicular to the motion direction
+	crossStrength float64
+}
+
+// estimateMotionBlur analyzes gradient orientation statistics inside rect. Motion blur
+// suppresses gradients along the direction of movement, so the structure tensor becomes
+// anisotropic and its weak eigenvector points along the motion. The streak length is the
+// lag of the strongest negative autocorrelation of the derivative along that direction.
+func (a *imageAnalyzer) estimateMotionBlur(gray *image.Gray, rect image.Rectangle) motionBlurEstimate {
+	rect = rect.Intersect(gray.Bounds()).Inset(1)
+	if rect.Dx() < 3 || rect.Dy() < 3 {
+		return motionBlurEstimate{}
+	}
+
+	step := int(math.Sqrt(float64(rect.Dx()*rect.Dy()) / motionSampleTarget))
+	if step < 1 {
+		step = 1
+	}
+
+	// Structure tensor accumulated over sampled central differences
+	var jxx, jyy, jxy float64
+	stride := gray.Stride
+	for y := rect.Min.Y; y < rect.Max.Y; y += step {
+		for x := rect.Min.X; x < rect.Max.X; x += step {
+			i := gray.PixOffset(x, y)
+			gx := float64(int(gray.Pix[i+1]) - int(gray.Pix[i-1]))
+			gy := float64(int(gray.Pix[i+stride]) - int(gray.Pix[i-stride]))
+			jxx += gx * gx
+			jyy += gy * gy
+			jxy += gx * gy
+		}
+	}
+
+	trace := jxx + jyy
+	if trace == 0 {
+		return motionBlurEstimate{}
+	}
+	diff := math.Sqrt((jxx-jyy)*(jxx-jyy) + 4*jxy*jxy)
+
+	// Dominant gradient orientation in image coordinates (y pointing down);
+	// the motion runs perpendicular to it
+	gradientAngle := 0.5 * math.Atan2(2*jxy, jxx-jyy)
+	motionAngle := gradientAngle + math.Pi/2
+
+	estimate := motionBlurEstimate{
+		anisotropy: diff / trace,
+		angle:      normalizeAngle(-motionAngle * 180 / math.Pi),
+	}
+	estimate.length, estimate.streakStrength = a.estimateBlurLength(gray, rect, motionAngle)
+	_, estimate.crossStrength = a.estimateBlurLength(gray, rect, gradientAngle)
+	return estimate
+}
+
+// estimateBlurLength finds the blur streak length along the given direction (radians,
+// image coordinates). A box blur of length L turns the directional derivative into the
+// difference of two copies shifted by L, which shows up as a negative autocorrelation peak at lag L.
+func (a *imageAnalyzer) estimateBlurLength(gray *image.Gray, rect image.Rectangle, angle float64) (length, strength float64) {
+	// Work on a central window to bound memory and time
+	if rect.Dx() > motionWindowSize || rect.Dy() > motionWindowSize {
+		c := image.Pt((rect.Min.X+rect.Max.X)/2, (rect.Min.Y+rect.Max.Y)/2)
+		half := motionWindowSize / 2
+		rect = image.Rect(c.X-half, c.Y-half, c.X+half, c.Y+half).Intersect(rect)
+	}
+	w, h := rect.Dx(), rect.Dy()
+	cos, sin := math.Cos(angle), math.Sin(angle)
+
+	deriv := make([]float32, w*h)
+	stride := gray.Stride
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := gray.PixOffset(rect.Min.X+x, rect.Min.Y+y)
+			gx := float64(int(gray.Pix[i+1]) - int(gray.Pix[i-1]))
+			gy := float64(int(gray.Pix[i+stride]) - int(gray.Pix[i-stride]))
+			deriv[y*w+x] = float32(gx*cos + gy*sin)
+		}
+	}
+
+	var energy float64
+	for _, d := range deriv {
+		energy += float64(d) * float64(d)
+	}
+	if energy == 0 {
+		return 0, 0
+	}
+
+	bestLag, bestCorr := 0, 0.0
+	for lag := 3; lag <= maxMotionBlurLength; lag++ {
+		dx := int(math.Round(float64(lag) * cos))
+		dy := int(math.Round(float64(lag) * sin))
+		if abs(dx) >= w || abs(dy) >= h {
+			break
+		}
+
+		var corr float64
+		for y := max(0, -dy); y < min(h, h-dy); y++ {
+			row, shifted := y*w, (y+dy)*w+dx
+			for x := max(0, -dx); x < min(w, w-dx); x++ {
+				corr += float64(deriv[row+x]) * float64(deriv[shifted+x])
+			}
+		}
+		corr /= energy
+		if corr < bestCorr {
+			bestLag, bestCorr = lag, corr
+		}
+	}
+	return float64(bestLag), -bestCorr
+}
+
+// applyMotionBlurAnalysis classifies the blur of a blurry or partially blurry image as
+// motion or defocus and records the motion direction and streak length
+func (a *imageAnalyzer) applyMotionBlurAnalysis(gray *image.Gray, result *AnalysisResult) {
+	rect := gray.Bounds()
+	switch result.BlurVerdict {
+	case BlurVerdictBlurry:
+	case BlurVerdictPartiallyBlurry:
+		if result.BlurriestRegion != nil {
+			r := result.BlurriestRegion
+			rect = image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+		}
+	default:
+		return
+	}
+
+	estimate := a.estimateMotionBlur(gray, rect)
+	result.BlurAnisotropy = estimate.anisotropy
+	if !estimate.isMotion() {
+		result.BlurType = BlurTypeDefocus
+		return
+	}
+
+	result.BlurType = BlurTypeMotion
+	angle, length := estimate.angle, estimate.length
+	result.MotionBlurAngle = &angle
+	result.MotionBlurLength = &length
+}
+
+// isMotion reports whether the blur is directional enough to come from camera movement
+func (e motionBlurEstimate) isMotion() bool {
+	return e.length > 0 &&
+		e.anisotropy >= minMotionAnisotropy &&
+		e.streakStrength >= minStreakRatio*e.crossStrength
+}
+
+// normalizeAngle maps an angle in degrees into [0, 180)
+func normalizeAngle(deg float64) float64 {
+	deg = math.Mod(deg, 180)
+	if deg < 0 {
+		deg += 180
+	}
+	return deg
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package analyzer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+const (
+	// noiseWindowSize bounds the central window the noise level is estimated on
+	noiseWindowSize = 1024
+	// noiseBlockSize is the side of the blocks flatness is judged on
+	noiseBlockSize = 8
+	// flatBlockPercentile selects the flattest share of blocks, by gradient energy,
+	// whose high-pass residuals are dominated by noise rather than image structure
+	flatBlockPercentile = 0.3
+	// noiseResidualScale is the standard deviation of the residual mask response to unit
+	// Gaussian noise: sqrt(1+4+1+4+16+4+1+4+1)
+	noiseResidualScale = 6.0
+	// madToSigma converts a median absolute deviation into a Gaussian standard deviation
+	madToSigma = 1 / 0.6745
+)
+
+// noiseEstimate is the estimated sensor noise standard deviation in 0-255 units
+type noiseEstimate struct {
+	luma     float64
+	channels [3]float64
+}
+
+// estimateNoise estimates the noise sigma per channel from the median absolute deviation
+// of high-pass residuals in the flattest part of a central window. The residual mask
+// [1 -2 1; -2 4 -2; 1 -2 1] cancels smooth gradients, so in flat regions only noise remains.
+func (a *imageAnalyzer) estimateNoise(img image.Image) noiseEstimate {
+	bounds := img.Bounds()
+	window := bounds
+	if bounds.Dx() > noiseWindowSize || bounds.Dy() > noiseWindowSize {
+		c := image.Pt((bounds.Min.X+bounds.Max.X)/2, (bounds.Min.Y+bounds.Max.Y)/2)
+		half := noiseWindowSize / 2
+		window = image.Rect(c.X-half, c.Y-half, c.X+half, c.Y+half).Intersect(bounds)
+	}
+	w, h := window.Dx(), window.Dy()
+	if w < 3 || h < 3 {
+		return noiseEstimate{}
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, window.Min, draw.Src)
+
+	// Planes for luma and R, G, B
+	var planes [4][]int
+	for c := range planes {
+		planes[c] = make([]int, w*h)
+	}
+	for i := 0; i < w*h; i++ {
+		p := rgba.Pix[i*4 : i*4+3]
+		planes[0][i] = (299*int(p[0]) + 587*int(p[1]) + 114*int(p[2]) + 500) / 1000
+		planes[1][i], planes[2][i], planes[3][i] = int(p[0]), int(p[1]), int(p[2])
+	}
+	luma := planes[0]
+
+	// Blocks with the least gradient energy are flat enough to measure noise on. Selecting
+	// whole blocks rather than single pixels avoids favouring pixels where the noise
+	// happened to be small.
+	blocksX, blocksY := (w-2)/noiseBlockSize, (h-2)/noiseBlockSize
+	if blocksX == 0 || blocksY == 0 {
+		return noiseEstimate{}
+	}
+	scores := make([]int, blocksX*blocksY)
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			score := 0
+			for y := 1 + by*noiseBlockSize; y < 1+(by+1)*noiseBlockSize; y++ {
+				for x := 1 + bx*noiseBlockSize; x < 1+(bx+1)*noiseBlockSize; x++ {
+					i := y*w + x
+					score += abs(luma[i+1]-luma[i-1]) + abs(luma[i+w]-luma[i-w])
+				}
+			}
+			scores[by*blocksX+bx] = score
+		}
+	}
+	sorted := append([]int(nil), scores...)
+	sort.Ints(sorted)
+	flatLimit := sorted[int(flatBlockPercentile*float64(len(sorted)-1))]
+
+	// Residual histograms for luma and R, G, B over the flat blocks
+	const maxResidual = 16 * 255
+	var hists [4][]int
+	for c := range hists {
+		hists[c] = make([]int, maxResidual+1)
+	}
+	for b, score := range scores {
+		if score > flatLimit {
+			continue
+		}
+		bx, by := b%blocksX, b/blocksX
+		for y := 1 + by*noiseBlockSize; y < 1+(by+1)*noiseBlockSize; y++ {
+			for x := 1 + bx*noiseBlockSize; x < 1+(bx+1)*noiseBlockSize; x++ {
+				i := y*w + x
+				for c, plane := range planes {
+					hists[c][highPassResidual(plane, i, w)]++
+				}
+			}
+		}
+	}
+
+	sigma := func(hist []int) float64 {
+		return float64(percentileFromHistogram(hist, 0.5)) * madToSigma / noiseResidualScale
+	}
+	return noiseEstimate{
+		luma:     sigma(hists[0]),
+		channels: [3]float64{sigma(hists[1]), sigma(hists[2]), sigma(hists[3])},
+	}
+}
+
+// highPassResidual returns the absolute response of the noise mask at index i of a plane with width w
+func highPassResidual(plane []int, i, w int) int {
+	r := plane[i-w-1] - 2*plane[i-w] + plane[i-w+1] -
+		2*plane[i-1] + 4*plane[i] - 2*plane[i+1] +
+		plane[i+w-1] - 2*plane[i+w] + plane[i+w+1]
+	return abs(r)
+}
+
+// percentileFromHistogram returns the smallest bin at which the cumulative share of
+// samples reaches q
+func percentileFromHistogram(hist []int, q float64) int {
+	total := 0
+	for _, count := range hist {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	target := int(math.Ceil(q * float64(total)))
+	cumulative := 0
+	for bin, count := range hist {
+		cumulative += count
+		if cumulative >= target {
+			return bin
+		}
+	}
+	return len(hist) - 1
+}
+
+// noiseFloor returns how much pure Gaussian noise of the given sigma raises a sharpness
+// metric, so blur thresholds can be lifted for noisy images
+func noiseFloor(metric SharpnessMetric, sigma float64) float64 {
+	switch metric {
+	case MetricLaplacianVariance:
+		// Sum of squared 4-neighbour Laplacian coefficients: 1+1+1+1+16
+		return 20 * sigma * sigma
+	case MetricTenengrad:
+		// Each Sobel component has coefficient energy 12
+		return 24 * sigma * sigma
+	case MetricBrenner:
+		return 2 * sigma * sigma
+	case MetricModifiedLaplacian:
+		// Two absolute second differences, each with standard deviation sqrt(6)*sigma
+		return 2 * math.Sqrt(6) * sigma * math.Sqrt(2/math.Pi)
+	default:
+		// The spectral ratio takes the noise out of the spectrum itself
+		return 0
+	}
+}
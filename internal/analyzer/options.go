@@ -0,0 +1,89 @@
+package analyzer
+
+import "fmt"
+
+// AnalysisMode selects the speed/accuracy trade-off of an analysis run
+type AnalysisMode string
+
+const (
+	// ModeFast computes global statistics on a small pyramid level and samples few sharpness tiles
+	ModeFast AnalysisMode = "fast"
+	// ModeBalanced computes global statistics on a medium pyramid level and samples more sharpness tiles
+	ModeBalanced AnalysisMode = "balanced"
+	// ModeAccurate analyzes every pixel at native resolution
+	ModeAccurate AnalysisMode = "accurate"
+)
+
+// modeSettings describes how much of the image a mode looks at
+type modeSettings struct {
+	// statsMaxDim is the longest side of the pyramid level used for global statistics (0 = native)
+	statsMaxDim int
+	// sharpnessTiles is the number of tiles per side sampled for sharpness (0 = full frame)
+	sharpnessTiles int
+	// sharpnessTileSize is the side length in native pixels of each sampled sharpness tile
+	sharpnessTileSize int
+	// qrOnDemand scans for QR codes only when a payload is expected
+	qrOnDemand bool
+	// skipBarcodes leaves out the barcode scan
+	skipBarcodes bool
+	// textOnDemand reads text only for OCR requests and to turn the page upright
+	textOnDemand bool
+}
+
+// ParseAnalysisMode converts a request value into an AnalysisMode, defaulting to ModeAccurate
+func ParseAnalysisMode(value string) (AnalysisMode, error) {
+	switch AnalysisMode(value) {
+	case "":
+		return ModeAccurate, nil
+	case ModeFast, ModeBalanced, ModeAccurate:
+		return AnalysisMode(value), nil
+	default:
+		return "", fmt.Errorf("unsupported analysis mode %q (expected fast, balanced or accurate)", value)
+	}
+}
+
+// settings returns the sampling parameters for the mode
+func (m AnalysisMode) settings() modeSettings {
+	switch m {
+	case ModeFast:
+		return modeSettings{statsMaxDim: 512, sharpnessTiles: 4, sharpnessTileSize: 128, qrOnDemand: true, skipBarcodes: true, textOnDemand: true}
+	case ModeBalanced:
+		return modeSettings{statsMaxDim: 1024, sharpnessTiles: 5, sharpnessTileSize: 192}
+	default:
+		return modeSettings{}
+	}
+}
+
+// AnalysisOptions configures a single analysis run
+type AnalysisOptions struct {
+	IsOCR        bool
+	ExpectedText string
+	// ExpectedQRPayload is the value a QR code on the document must carry, such as an
+	// application ID; empty skips the check
+	ExpectedQRPayload string
+	Mode              AnalysisMode
+	// AutoRotate turns a sideways or upside-down page upright before it is analyzed
+	AutoRotate bool
+	// Profile overrides the default standard/OCR profile when set
+	Profile *QualityProfile
+	// ImageData is the encoded file img was decoded from, used for format-level checks
+	// such as JPEG quantization tables; optional
+	ImageData []byte
+
+	// SharpnessGridRows and SharpnessGridCols size the regional sharpness grid (0 = DefaultSharpnessGrid)
+	SharpnessGridRows int
+	SharpnessGridCols int
+	// IncludeHeatmap returns the per-tile sharpness matrix in the result
+	IncludeHeatmap bool
+	// IncludeHistograms returns the luma and RGB histograms in the result
+	IncludeHistograms bool
+}
+
+// Validate checks that the options are within supported ranges
+func (o AnalysisOptions) Validate() error {
+	if o.SharpnessGridRows < 0 || o.SharpnessGridRows > MaxSharpnessGrid ||
+		o.SharpnessGridCols < 0 || o.SharpnessGridCols > MaxSharpnessGrid {
+		return fmt.Errorf("sharpness grid must be between 1x1 and %dx%d", MaxSharpnessGrid, MaxSharpnessGrid)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package analyzer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// modeCorpusImage generates one image of the synthetic corpus the analysis modes are
+// compared on
+type modeCorpusImage struct {
+	name     string
+	generate func() *image.RGBA
+}
+
+// modeCorpus returns text documents on white and tinted paper and smooth photographic
+// content, each sharp and blurred vertically, in four sizes: 24 images. Images are
+// generated on demand, as the corpus would not fit in memory at once.
+func modeCorpus() []modeCorpusImage {
+	var corpus []modeCorpusImage
+	for i, size := range [][2]int{{4000, 3000}, {3000, 4000}, {1920, 1080}, {1200, 1600}} {
+		w, h := size[0], size[1]
+		for j, paper := range []color.RGBA{{245, 245, 240, 255}, {230, 215, 190, 255}} {
+			seed := int64(10*i + j)
+			corpus = append(corpus,
+				modeCorpusImage{fmt.Sprintf("document %dx%d paper %d", w, h, j), func() *image.RGBA {
+					return corpusDocument(w, h, paper, seed)
+				}},
+				modeCorpusImage{fmt.Sprintf("blurred document %dx%d paper %d", w, h, j), func() *image.RGBA {
+					return verticalBlur(corpusDocument(w, h, paper, seed), 3)
+				}})
+		}
+		seed := int64(10*i + 9)
+		corpus = append(corpus,
+			modeCorpusImage{fmt.Sprintf("photo %dx%d", w, h), func() *image.RGBA {
+				return corpusPhoto(w, h, seed)
+			}},
+			modeCorpusImage{fmt.Sprintf("blurred photo %dx%d", w, h), func() *image.RGBA {
+				return verticalBlur(corpusPhoto(w, h, seed), 4)
+			}})
+	}
+	return corpus
+}
+
+// corpusDocument draws lines of word-sized ink patches on grainy paper
+func corpusDocument(w, h int, paper color.RGBA, seed int64) *image.RGBA {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		n := uint8(r.Intn(6))
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = paper.R-n, paper.G-n, paper.B-n, 255
+	}
+	for ly := h / 10; ly < h*9/10; ly += h / 30 {
+		for lx := w / 10; lx < w*9/10; {
+			ww := 5 + r.Intn(w/40+1)
+			for y := ly; y < ly+h/60; y++ {
+				for x := lx; x < lx+ww && x < w; x++ {
+					if r.Intn(3) > 0 {
+						o := img.PixOffset(x, y)
+						img.Pix[o], img.Pix[o+1], img.Pix[o+2] = 20, 20, 30
+					}
+				}
+			}
+			lx += ww + w/80
+		}
+	}
+	return img
+}
+
+// corpusPhoto draws smooth colour gradients and waves with grain
+func corpusPhoto(w, h int, seed int64) *image.RGBA {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	fx, fy := r.Float64()*0.02, r.Float64()*0.02
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 0.5 + 0.5*math.Sin(float64(x)*fx)*math.Cos(float64(y)*fy)
+			n := r.Float64() * 20
+			o := img.PixOffset(x, y)
+			img.Pix[o] = uint8(v*200 + n)
+			img.Pix[o+1] = uint8(float64(x) / float64(w) * 180)
+			img.Pix[o+2] = uint8(float64(y)/float64(h)*220 + n)
+			img.Pix[o+3] = 255
+		}
+	}
+	return img
+}
+
+// verticalBlur averages each pixel with radius pixels above and below it, like camera
+// shake
+func verticalBlur(src *image.RGBA, radius int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	for x := 0; x < b.Dx(); x++ {
+		for y := 0; y < b.Dy(); y++ {
+			var sum [3]int
+			n := 0
+			for yy := max(0, y-radius); yy <= min(b.Dy()-1, y+radius); yy++ {
+				i := src.PixOffset(x, yy)
+				sum[0] += int(src.Pix[i])
+				sum[1] += int(src.Pix[i+1])
+				sum[2] += int(src.Pix[i+2])
+				n++
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(sum[0]/n), uint8(sum[1]/n), uint8(sum[2]/n), 255
+		}
+	}
+	return dst
+}
+
+// modeDelta accumulates the mean and maximum absolute difference of one value
+type modeDelta struct {
+	sum, max float64
+	n        int
+}
+
+func (d *modeDelta) add(got, want float64) {
+	v := math.Abs(got - want)
+	d.sum += v
+	d.max = math.Max(d.max, v)
+	d.n++
+}
+
+func (d *modeDelta) report(b *testing.B, name string) {
+	b.ReportMetric(d.sum/float64(d.n), name+"-mean")
+	b.ReportMetric(d.max, name+"-max")
+}
+
+// BenchmarkAnalysisModes times OCR analysis per image in each mode and reports how far
+// the fast and balanced results are from accurate ones on the synthetic corpus. The
+// README's accuracy table comes from
+//
+//	go test -run '^$' -bench AnalysisModes -benchtime 1x ./internal/analyzer
+func BenchmarkAnalysisModes(b *testing.B) {
+	a := newTestAnalyzer(b)
+	corpus := modeCorpus()
+	references := make([]*AnalysisResult, len(corpus))
+
+	for _, mode := range []AnalysisMode{ModeFast, ModeBalanced, ModeAccurate} {
+		b.Run(string(mode), func(b *testing.B) {
+			var lum, sat, channels, brightness, laplacian modeDelta
+			var agree, images int
+			var elapsed time.Duration
+			for i := 0; i < b.N; i++ {
+				for k, c := range corpus {
+					b.StopTimer()
+					img := c.generate()
+					if references[k] == nil {
+						ref := a.AnalyzeWithOptions(img, AnalysisOptions{IsOCR: true, Mode: ModeAccurate})
+						references[k] = &ref
+					}
+					ref := references[k]
+					b.StartTimer()
+
+					start := time.Now()
+					got := a.AnalyzeWithOptions(img, AnalysisOptions{IsOCR: true, Mode: mode})
+					elapsed += time.Since(start)
+					images++
+
+					lum.add(got.AvgLuminance, ref.AvgLuminance)
+					sat.add(got.AvgSaturation, ref.AvgSaturation)
+					for ch := range got.ChannelBalance {
+						channels.add(got.ChannelBalance[ch], ref.ChannelBalance[ch])
+					}
+					brightness.add(got.Brightness, ref.Brightness)
+					laplacian.add(got.LaplacianVar/ref.LaplacianVar, 1)
+					if got.Blurry == ref.Blurry {
+						agree++
+					}
+				}
+			}
+			b.ReportMetric(float64(elapsed.Milliseconds())/float64(images), "ms/image")
+			lum.report(b, "luminance")
+			sat.report(b, "saturation")
+			channels.report(b, "channel")
+			brightness.report(b, "brightness")
+			laplacian.report(b, "laplacian")
+			b.ReportMetric(float64(agree)/float64(images), "blurry-agreement")
+		})
+	}
+}
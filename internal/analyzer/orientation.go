@@ -0,0 +1,225 @@
+package analyzer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+const (
+	// minOrientationLines is the number of text lines needed to judge the orientation
+	minOrientationLines = 3
+	// orientationBandShare is the share of a line's densest row that rows of the x-height
+	// band reach; the ascenders and descenders above and below it are sparser
+	orientationBandShare = 0.4
+	// minOrientationConfidence is the confidence an orientation needs before the image
+	// is turned upright
+	minOrientationConfidence = 0.3
+	// orientationFullAscent is the ascender excess at which the direction of the text
+	// lines is certain; printed Latin text shows 0.4-0.8
+	orientationFullAscent = 0.3
+)
+
+// orientationEstimate is the clockwise rotation in degrees (0, 90, 180 or 270) that
+// turns the page upright, with a 0-1 confidence in it
+type orientationEstimate struct {
+	rotation   int
+	confidence float64
+}
+
+// lineCues holds the orientation cues of the text lines of an upright sample
+type lineCues struct {
+	// ascent is the share of ink above the x-height band minus the share below it,
+	// positive for upright Latin text
+	ascent float64
+	lines  int
+}
+
+// estimateOrientation judges the rotation of the text in the document ink of a text
+// level. ok is false when the ink holds too few text lines.
+func estimateOrientation(text *textLevel) (orientationEstimate, bool) {
+	ink := text.ink
+
+	// Lines run along the rows of an upright or upside-down page and along the columns
+	// of a sideways one, which turning the ink clockwise brings back to the rows. The
+	// projection profile is sharpest across the lines.
+	upright, ok := estimateSkew(ink, ink.Rect)
+	if !ok {
+		return orientationEstimate{}, false
+	}
+	turned := turnGrayClockwise(ink)
+	sideways, _ := estimateSkew(turned, turned.Rect)
+	sample, skew, turn := ink, upright, 0
+	if sideways.confidence > upright.confidence {
+		sample, skew, turn = turned, sideways, 90
+	}
+	cues := measureLineCues(sample, skew.angle)
+	if skew.confidence <= 0 || cues.lines < minOrientationLines {
+		return orientationEstimate{}, false
+	}
+
+	// Latin text carries more ascenders and capitals above the x-height band than
+	// descenders below it
+	rotation := turn
+	if cues.ascent < 0 {
+		rotation += 180
+	}
+	axis := 1 - math.Min(upright.confidence, sideways.confidence)/math.Max(upright.confidence, sideways.confidence)
+	direction := math.Min(1, math.Abs(cues.ascent)/orientationFullAscent)
+	return orientationEstimate{rotation: rotation, confidence: axis * direction}, true
+}
+
+// measureLineCues projects the ink of gray along text lines at angle degrees
+// (counter-clockwise) and reads the orientation cues of the lines from the profile
+func measureLineCues(gray *image.Gray, angle float64) lineCues {
+	box := image.Rectangle{}
+	for y := gray.Rect.Min.Y; y < gray.Rect.Max.Y; y++ {
+		for x := gray.Rect.Min.X; x < gray.Rect.Max.X; x++ {
+			if gray.Pix[gray.PixOffset(x, y)] == 0 {
+				box = box.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	// The sample axes follow the lines (u) and cross them downwards (v)
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	bw, bh := float64(box.Dx()), float64(box.Dy())
+	length := int(bw*cos + bh*math.Abs(sin))
+	depth := int(bh*cos + bw*math.Abs(sin))
+	cx, cy := float64(box.Min.X+box.Max.X)/2, float64(box.Min.Y+box.Max.Y)/2
+	profile := make([]float64, depth)
+	for v := range profile {
+		for u := 0; u < length; u++ {
+			du, dv := float64(u)-float64(length)/2, float64(v)-float64(depth)/2
+			p := image.Point{X: int(cx + du*cos + dv*sin), Y: int(cy - du*sin + dv*cos)}
+			if p.In(box) && gray.Pix[gray.PixOffset(p.X, p.Y)] == 0 {
+				profile[v]++
+			}
+		}
+	}
+	var cues lineCues
+	var above, below float64
+	for _, line := range splitLines(profile) {
+		peak := 0.0
+		for v := line[0]; v < line[1]; v++ {
+			peak = math.Max(peak, profile[v])
+		}
+		bandTop, bandBottom := line[1], line[0]
+		for v := line[0]; v < line[1]; v++ {
+			if profile[v] >= orientationBandShare*peak {
+				bandTop, bandBottom = min(bandTop, v), max(bandBottom, v+1)
+			}
+		}
+		if bandBottom-bandTop < 2 {
+			continue
+		}
+		cues.lines++
+		for v := line[0]; v < bandTop; v++ {
+			above += profile[v]
+		}
+		for v := bandBottom; v < line[1]; v++ {
+			below += profile[v]
+		}
+	}
+	if above+below > 0 {
+		cues.ascent = (above - below) / (above + below)
+	}
+	return cues
+}
+
+// splitLines returns the [start, end) runs of a row profile that hold ink. Runs whose
+// dense rows fall apart into separate bands, such as lines touched by the descenders
+// of the line above, are split at the sparsest row between the bands.
+func splitLines(profile []float64) [][2]int {
+	var lines [][2]int
+	for v := 0; v < len(profile); {
+		if profile[v] == 0 {
+			v++
+			continue
+		}
+		start := v
+		for v < len(profile) && profile[v] > 0 {
+			v++
+		}
+		lines = append(lines, splitBands(profile, start, v)...)
+	}
+	return lines
+}
+
+// splitBands splits the run [start, end) of a profile between its dense bands
+func splitBands(profile []float64, start, end int) [][2]int {
+	peak := 0.0
+	for v := start; v < end; v++ {
+		peak = math.Max(peak, profile[v])
+	}
+	var bands [][2]int
+	for v := start; v < end; v++ {
+		if profile[v] < orientationBandShare*peak {
+			continue
+		}
+		if n := len(bands); n > 0 && bands[n-1][1] == v {
+			bands[n-1][1] = v + 1
+		} else {
+			bands = append(bands, [2]int{v, v + 1})
+		}
+	}
+	lines := make([][2]int, 0, len(bands))
+	for i := range bands {
+		if i+1 < len(bands) {
+			cut := bands[i][1]
+			for v := bands[i][1]; v < bands[i+1][0]; v++ {
+				if profile[v] < profile[cut] {
+					cut = v
+				}
+			}
+			lines = append(lines, [2]int{start, cut})
+			start = cut
+			continue
+		}
+		lines = append(lines, [2]int{start, end})
+	}
+	return lines
+}
+
+// turnGrayClockwise returns gray turned clockwise by 90 degrees
+func turnGrayClockwise(gray *image.Gray) *image.Gray {
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	out := image.NewGray(image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		row := gray.Pix[gray.PixOffset(gray.Rect.Min.X, gray.Rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			out.Pix[x*out.Stride+h-1-y] = row[x]
+		}
+	}
+	return out
+}
+
+// rotateClockwise returns img turned clockwise by a multiple of 90 degrees
+func rotateClockwise(img image.Image, rotation int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+	rotation = ((rotation % 360) + 360) % 360
+	if rotation == 0 {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, h, w))
+	if rotation == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch rotation {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			default:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// addAscenders raises a third of the strokes standing on the baselines of drawText's
+// lines in rect by half the glyph height, the way b, d, h and l rise above the x-height;
+// drawText's marks alone look the same either way up
+func addAscenders(img *image.Gray, rect image.Rectangle, glyph int, r *rand.Rand) {
+	stroke := max(1, glyph/8)
+	for y := rect.Min.Y; y+glyph <= rect.Max.Y; y += glyph * 2 {
+		base := y + glyph - 1
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if img.Pix[img.PixOffset(x, base)] < 128 && img.Pix[img.PixOffset(x-1, base)] >= 128 && r.Intn(3) == 0 {
+				fillRect(img, image.Rect(x, y-glyph/2, x+stroke, y), 30)
+			}
+		}
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	a := newTestAnalyzer(t)
+	// Text in the top-left of a square page, so a quarter turn keeps it in the frame and
+	// the text blocks show which way up the analyzed page was. Each line is indented on
+	// its own, as the letters of proportional type do not line up in columns.
+	page := newPage(1400, 1400, 235)
+	text := image.Rect(100, 100, 900, 800)
+	r := rand.New(rand.NewSource(1))
+	for y := text.Min.Y; y+16 <= text.Max.Y; y += 32 {
+		line := image.Rect(text.Min.X+r.Intn(16), y, text.Max.X, y+16)
+		drawText(page, line, 16, r)
+		addAscenders(page, line, 16, r)
+	}
+
+	for _, rotation := range []int{0, 90, 180, 270} {
+		// rotateGray turns counter-clockwise, so the page needs the same clockwise turn
+		img := page
+		if rotation != 0 {
+			img = rotateGray(page, float64(rotation), 235)
+		}
+
+		result := a.AnalyzeWithOptions(img, AnalysisOptions{})
+		if result.Orientation != rotation || result.OrientationConfidence < minOrientationConfidence {
+			t.Errorf("turned %d°: orientation %d (confidence %.2f), want %d", rotation, result.Orientation, result.OrientationConfidence, rotation)
+		}
+		if result.AutoRotated {
+			t.Errorf("turned %d°: rotated without auto_rotate", rotation)
+		}
+
+		result = a.AnalyzeWithOptions(img, AnalysisOptions{AutoRotate: true})
+		if result.Orientation != rotation || result.AutoRotated != (rotation != 0) {
+			t.Errorf("turned %d°: orientation %d, auto-rotated %v", rotation, result.Orientation, result.AutoRotated)
+		}
+		if len(result.TextBlocks) == 0 {
+			t.Fatalf("turned %d°: no text blocks", rotation)
+		}
+		for _, b := range result.TextBlocks {
+			centre := image.Pt(b.X+b.Width/2, b.Y+b.Height/2)
+			if !centre.In(text) {
+				t.Errorf("turned %d°: text block %+v outside the text of the upright page %v", rotation, b, text)
+			}
+		}
+	}
+}
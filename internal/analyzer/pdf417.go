@@ -0,0 +1,857 @@
+package analyzer
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+const (
+	// pdf417Start is the start pattern, 17 modules wide; pdf417Stop is the first 17 of the
+	// stop pattern's 18 modules
+	pdf417Start = 0x1fea8
+	pdf417Stop  = 0x1fd14
+	// pdf417Modules is the width in modules of one codeword
+	pdf417Modules = 17
+	// pdf417Prime is the size of the field the error correction codewords are computed in
+	pdf417Prime = 929
+	// pdf417MaxWidthError is the largest relative difference between a codeword's width
+	// and 17 modules before the scan line is resynchronized
+	pdf417MaxWidthError = 0.25
+	// pdf417MinStartedShare is the share of scan lines that must cross the start or stop
+	// pattern for the bars to count as a PDF417 symbol
+	pdf417MinStartedShare = 0.3
+)
+
+// Mode latches and shifts of the PDF417 data codewords
+const (
+	pdf417TextLatch    = 900
+	pdf417ByteLatch    = 901
+	pdf417NumericLatch = 902
+	pdf417ByteShift    = 913
+	pdf417MacroOptions = 922
+	pdf417MacroField   = 923
+	pdf417ByteLatch6   = 924
+	pdf417ECIUser      = 925
+	pdf417ECIGeneral   = 926
+	pdf417ECICharset   = 927
+	pdf417MacroBegin   = 928
+)
+
+// Characters of the mixed and punctuation sub-modes of text compaction, by value
+const (
+	pdf417MixedChars = "0123456789&\r\t,:#-.$/+%*=^"
+	pdf417PunctChars = ";<>@[\\]_`~!\r\t,:\n-.$/\"|*()?{}'"
+)
+
+var (
+	errPDF417NotFound   = errors.New("no PDF417 start or stop pattern found")
+	errPDF417Unreadable = errors.New("PDF417 codewords could not be read")
+	errPDF417Checksum   = errors.New("PDF417 error correction failed")
+	errPDF417Reserved   = errors.New("PDF417 data holds a reserved codeword")
+)
+
+var (
+	pdf417LookupOnce sync.Once
+	// pdf417Lookup maps a 17-module pattern to its cluster index (0-2) times 1000 plus
+	// its codeword value
+	pdf417Lookup map[uint32]int
+)
+
+// pdf417Pattern returns the cluster index and value of a codeword pattern
+func pdf417Pattern(pattern uint32) (cluster, value int, ok bool) {
+	pdf417LookupOnce.Do(func() {
+		pdf417Lookup = make(map[uint32]int, 3*pdf417Prime)
+		for c := range pdf417Codewords {
+			for v, p := range pdf417Codewords[c] {
+				pdf417Lookup[p] = c*1000 + v
+			}
+		}
+	})
+	entry, ok := pdf417Lookup[pattern]
+	return entry / 1000, entry % 1000, ok
+}
+
+// decodePDF417 reads a PDF417 symbol from an image with its bars upright. found reports
+// whether the start or stop pattern was seen, so a symbol that cannot be decoded is still
+// recognized as PDF417.
+func decodePDF417(gray *image.Gray) (payload string, found bool, err error) {
+	lines := binaryLines(gray)
+	payload, found, err = decodePDF417Lines(lines)
+	if err == nil {
+		return payload, true, nil
+	}
+
+	// Upside down, the lines are read right to left from the last one
+	flipped := make([][]bool, len(lines))
+	for i, line := range lines {
+		f := make([]bool, len(line))
+		for x, v := range line {
+			f[len(line)-1-x] = v
+		}
+		flipped[len(lines)-1-i] = f
+	}
+	flippedPayload, flippedFound, flippedErr := decodePDF417Lines(flipped)
+	if flippedErr == nil {
+		return flippedPayload, true, nil
+	}
+	if flippedFound && !found {
+		err = flippedErr
+	}
+	return "", found || flippedFound, err
+}
+
+// binaryLines splits every row of gray into dark (true) and light pixels at the Otsu
+// threshold
+func binaryLines(gray *image.Gray) [][]bool {
+	rect := gray.Bounds()
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+	threshold := uint8(otsuThreshold(hist[:]))
+
+	lines := make([][]bool, rect.Dy())
+	for y := range lines {
+		row := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):gray.PixOffset(rect.Max.X, rect.Min.Y+y)]
+		line := make([]bool, len(row))
+		for x, v := range row {
+			line[x] = v <= threshold
+		}
+		lines[y] = line
+	}
+	return lines
+}
+
+// pdf417Line is the codewords read along one scan line: the left row indicator, the data
+// columns and, when the stop pattern was reached, the right row indicator. Unreadable
+// codewords are -1; clusters holds the cluster each codeword was found in.
+type pdf417Line struct {
+	codewords []int
+	clusters  []int
+	complete  bool
+}
+
+// decodePDF417Lines assembles the codeword matrix from all scan lines by majority vote,
+// corrects errors and decodes the data codewords
+func decodePDF417Lines(lines [][]bool) (string, bool, error) {
+	var scans []pdf417Line
+	started := 0
+	for _, line := range lines {
+		scan, ok := readPDF417Line(line)
+		if ok {
+			started++
+		}
+		if len(scan.codewords) > 0 {
+			scans = append(scans, scan)
+		}
+	}
+	found := started >= 3 && float64(started) >= pdf417MinStartedShare*float64(len(lines))
+	if !found {
+		return "", false, errPDF417NotFound
+	}
+
+	// The number of data columns from lines that reached the stop pattern
+	columnVotes := make(map[int]int)
+	for _, s := range scans {
+		if s.complete && len(s.codewords) > 2 {
+			columnVotes[len(s.codewords)-2]++
+		}
+	}
+	columns := majority(columnVotes)
+	if columns < 1 {
+		return "", true, errPDF417Unreadable
+	}
+
+	// Votes per row and column; rows are numbered from the row indicators and clusters
+	type cell map[int]int
+	matrix := make(map[int][]cell)
+	ecVotes := make(map[int]int)
+	for _, s := range scans {
+		indicator, cluster, right := s.codewords[0], s.clusters[0], false
+		if indicator < 0 && s.complete && len(s.codewords) == columns+2 {
+			indicator, cluster, right = s.codewords[columns+1], s.clusters[columns+1], true
+		}
+		if indicator < 0 {
+			continue
+		}
+		row := 3*(indicator/30) + cluster
+		for col := 0; col < columns && col+1 < len(s.codewords); col++ {
+			v := s.codewords[col+1]
+			if v < 0 {
+				continue
+			}
+			// A slightly tilted line drifts into the rows above or below; the cluster of
+			// each codeword tells which
+			r := row + (s.clusters[col+1]-cluster+4)%3 - 1
+			if r < 0 {
+				continue
+			}
+			if matrix[r] == nil {
+				matrix[r] = make([]cell, columns)
+				for i := range matrix[r] {
+					matrix[r][i] = make(cell)
+				}
+			}
+			matrix[r][col][v]++
+		}
+		// The error correction level is in the left indicator of cluster 3 rows and the
+		// right indicator of cluster 6 rows
+		if (cluster == 1 && !right) || (cluster == 2 && right) {
+			ecVotes[(indicator%30)/3]++
+		}
+	}
+	ecLevel := majority(ecVotes)
+	if ecLevel < 0 || ecLevel > 8 || len(matrix[0]) == 0 {
+		return "", true, errPDF417Unreadable
+	}
+	ecCount := 2 << ecLevel
+
+	// The first codeword counts the data codewords including itself
+	dataCount := majority(matrix[0][0])
+	if dataCount < 1 || (dataCount+ecCount)%columns != 0 {
+		return "", true, errPDF417Unreadable
+	}
+	codewords := make([]int, dataCount+ecCount)
+	var erasures []int
+	for i := range codewords {
+		if row := matrix[i/columns]; row != nil {
+			codewords[i] = majority(row[i%columns])
+		}
+		if codewords[i] < 0 || matrix[i/columns] == nil {
+			codewords[i] = 0
+			erasures = append(erasures, i)
+		}
+	}
+	if err := correctPDF417(codewords, ecCount, erasures); err != nil {
+		return "", true, err
+	}
+	if codewords[0] != dataCount {
+		return "", true, errPDF417Checksum
+	}
+	payload, err := decodePDF417Data(codewords[1:dataCount])
+	return payload, true, err
+}
+
+// majority returns the most voted key, or -1 without votes
+func majority(votes map[int]int) int {
+	best, bestVotes := -1, 0
+	for k, n := range votes {
+		if n > bestVotes || (n == bestVotes && k < best) {
+			best, bestVotes = k, n
+		}
+	}
+	return best
+}
+
+// readPDF417Line reads the codewords after the start pattern on one scan line. started
+// reports whether a start or stop pattern was seen.
+func readPDF417Line(line []bool) (scan pdf417Line, started bool) {
+	// Run lengths, starting with a dark run
+	var runs []int
+	for x := 0; x < len(line); {
+		end := x
+		for end < len(line) && line[end] == line[x] {
+			end++
+		}
+		if len(runs) > 0 || line[x] {
+			runs = append(runs, end-x)
+		}
+		x = end
+	}
+
+	start := -1
+	for i := 0; i+8 <= len(runs); i += 2 {
+		if pattern, ok := runsToPattern(runs[i : i+8]); ok {
+			if pattern == pdf417Start {
+				start = i
+				break
+			}
+			if pattern == pdf417Stop {
+				started = true
+			}
+		}
+	}
+	if start < 0 {
+		return scan, started
+	}
+
+	module := float64(sum(runs[start:start+8])) / pdf417Modules
+	known := 0
+	for i := start + 8; i+8 <= len(runs); {
+		width := sum(runs[i : i+8])
+		pattern, ok := runsToPattern(runs[i : i+8])
+		if ok && pattern == pdf417Stop {
+			scan.complete = true
+			break
+		}
+		if math.Abs(float64(width)/(module*pdf417Modules)-1) > pdf417MaxWidthError {
+			// A blank stretch, such as a codeword wiped out by glare, runs on from the space
+			// that ends the codeword before it
+			if pattern, blank, ok := splitBlank(runs[i:i+8], module); ok {
+				value, cluster := -1, -1
+				if c, v, found := pdf417Pattern(pattern); found {
+					value, cluster = v, c
+					known++
+				}
+				scan.codewords = append(scan.codewords, value)
+				scan.clusters = append(scan.clusters, cluster)
+				for k := 0; k < blank; k++ {
+					scan.codewords = append(scan.codewords, -1)
+					scan.clusters = append(scan.clusters, -1)
+				}
+				i += 8
+				continue
+			}
+			// A split or merged run: skip to the dark run nearest the expected codeword end
+			scan.codewords = append(scan.codewords, -1)
+			scan.clusters = append(scan.clusters, -1)
+			target, pos := module*pdf417Modules, 0
+			next, best := i+2, math.Inf(1)
+			for j := i; j+1 < len(runs) && float64(pos) < 2*target; j += 2 {
+				pos += runs[j] + runs[j+1]
+				if d := math.Abs(float64(pos) - target); d < best {
+					next, best = j+2, d
+				}
+			}
+			i = next
+			continue
+		}
+
+		value, cluster := -1, -1
+		if ok {
+			if c, v, found := pdf417Pattern(pattern); found {
+				value, cluster = v, c
+				known++
+			}
+		}
+		scan.codewords = append(scan.codewords, value)
+		scan.clusters = append(scan.clusters, cluster)
+		// Follow the module width as it drifts with perspective
+		module = 0.9*module + 0.1*float64(width)/pdf417Modules
+		i += 8
+	}
+	if known == 0 {
+		scan.codewords, scan.clusters = nil, nil
+	}
+	return scan, true
+}
+
+// splitBlank reads a codeword whose closing space runs on into a blank stretch: the
+// space is cut to fill 17 modules and the rest is counted in whole codewords
+func splitBlank(runs []int, module float64) (pattern uint32, blank int, ok bool) {
+	target := module * pdf417Modules
+	last := math.Round(target) - float64(sum(runs[:7]))
+	if last < module/2 {
+		return 0, 0, false
+	}
+	rest := (float64(runs[7]) - last) / target
+	blank = int(math.Round(rest))
+	if blank < 1 || math.Abs(rest-float64(blank)) > pdf417MaxWidthError {
+		return 0, 0, false
+	}
+	cut := append(append(make([]int, 0, 8), runs[:7]...), int(last))
+	pattern, ok = runsToPattern(cut)
+	return pattern, blank, ok
+}
+
+// runsToPattern scales eight run lengths to 17 modules of one to six each and returns
+// them as bits, dark runs as ones
+func runsToPattern(runs []int) (uint32, bool) {
+	total := float64(sum(runs))
+	var modules [8]int
+	var remainders [8]float64
+	count := 0
+	for i, r := range runs {
+		exact := float64(r) * pdf417Modules / total
+		modules[i] = max(1, int(math.Round(exact)))
+		remainders[i] = exact - float64(modules[i])
+		count += modules[i]
+	}
+	// Rounding can leave the sum off by a module or two; adjust the runs rounded furthest
+	for count != pdf417Modules {
+		best, step := -1, 1
+		if count > pdf417Modules {
+			step = -1
+		}
+		for i := range modules {
+			if modules[i]+step < 1 {
+				continue
+			}
+			if best < 0 || float64(step)*remainders[i] > float64(step)*remainders[best] {
+				best = i
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		modules[best] += step
+		remainders[best] -= float64(step)
+		count += step
+	}
+
+	var pattern uint32
+	for i, m := range modules {
+		if m > 6 && i != 0 {
+			return 0, false
+		}
+		for k := 0; k < m; k++ {
+			pattern <<= 1
+			if i%2 == 0 {
+				pattern |= 1
+			}
+		}
+	}
+	return pattern, true
+}
+
+// sum adds up values
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// correctPDF417 corrects wrong codewords in place with the Reed-Solomon code of PDF417,
+// whose generator has the roots 3^1..3^ecCount in GF(929). Erasures are the positions of
+// codewords that could not be read; twice the wrong codewords plus the erasures may
+// number up to ecCount.
+func correctPDF417(codewords []int, ecCount int, erasures []int) error {
+	if len(erasures) > ecCount {
+		return errPDF417Checksum
+	}
+	received := gfPoly(codewords)
+	syndromes := make([]int, ecCount)
+	clean := true
+	for i := ecCount; i > 0; i-- {
+		syndromes[ecCount-i] = received.eval(gfExp(i))
+		if syndromes[ecCount-i] != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return nil
+	}
+
+	// The erasure locator has a root at the inverse location of each erasure; the
+	// syndromes it multiplies leave the unknown errors to the Euclidean algorithm
+	erasureLocator := gfPoly{1}
+	for _, position := range erasures {
+		location := gfExp(len(codewords) - 1 - position)
+		erasureLocator = erasureLocator.mul(gfPoly{gfSub(0, location), 1})
+	}
+	modified := erasureLocator.mul(gfPoly(syndromes).trim())
+	if modified.degree() >= ecCount {
+		modified = modified[len(modified)-ecCount:]
+	}
+	modified = modified.trim()
+
+	sigma, omega, err := pdf417Euclid(gfMonomial(ecCount, 1), modified, (ecCount+len(erasures)+1)/2)
+	if err != nil {
+		return err
+	}
+	sigma = sigma.mul(erasureLocator)
+
+	// Chien search for the roots of the error locator
+	var locations []int
+	for i := 1; i < pdf417Prime && len(locations) < sigma.degree(); i++ {
+		if sigma.eval(i) == 0 {
+			locations = append(locations, gfInverse(i))
+		}
+	}
+	if len(locations) != sigma.degree() {
+		return errPDF417Checksum
+	}
+
+	// Forney's formula with the formal derivative of the locator
+	degree := sigma.degree()
+	derivative := make(gfPoly, degree)
+	for i := 1; i <= degree; i++ {
+		derivative[degree-i] = gfMul(i, sigma.coefficient(i))
+	}
+	derivative = derivative.trim()
+	for _, location := range locations {
+		inverse := gfInverse(location)
+		if derivative.eval(inverse) == 0 {
+			return errPDF417Checksum
+		}
+		magnitude := gfMul(gfSub(0, omega.eval(inverse)), gfInverse(derivative.eval(inverse)))
+		position := len(codewords) - 1 - gfLog(location)
+		if position < 0 {
+			return errPDF417Checksum
+		}
+		codewords[position] = gfSub(codewords[position], magnitude)
+	}
+	// More damage than the code can carry can still yield a locator; its corrections
+	// leave the syndromes non-zero
+	for i := 1; i <= ecCount; i++ {
+		if received.eval(gfExp(i)) != 0 {
+			return errPDF417Checksum
+		}
+	}
+	return nil
+}
+
+// pdf417Euclid runs the extended Euclidean algorithm on x^ecCount and the syndrome
+// polynomial until the remainder's degree drops below stop, and returns the error
+// locator and evaluator
+func pdf417Euclid(a, b gfPoly, stop int) (sigma, omega gfPoly, err error) {
+	if a.degree() < b.degree() {
+		a, b = b, a
+	}
+	rLast, r := a, b
+	tLast, t := gfPoly{0}, gfPoly{1}
+	for r.degree() >= stop {
+		rLastLast, tLastLast := rLast, tLast
+		rLast, tLast = r, t
+		if rLast.isZero() {
+			return nil, nil, errPDF417Checksum
+		}
+		r = rLastLast
+		q := gfPoly{0}
+		inverse := gfInverse(rLast.coefficient(rLast.degree()))
+		for r.degree() >= rLast.degree() && !r.isZero() {
+			shift := r.degree() - rLast.degree()
+			scale := gfMul(r.coefficient(r.degree()), inverse)
+			q = q.add(gfMonomial(shift, scale))
+			r = r.sub(rLast.mulMonomial(shift, scale))
+		}
+		t = q.mul(tLast).sub(tLastLast).neg()
+	}
+
+	atZero := t.coefficient(0)
+	if atZero == 0 {
+		return nil, nil, errPDF417Checksum
+	}
+	inverse := gfInverse(atZero)
+	return t.scale(inverse), r.scale(inverse), nil
+}
+
+var (
+	gfOnce               sync.Once
+	gfExpTable, gfLogTbl [pdf417Prime]int
+)
+
+// gfTables fills the exponent and logarithm tables of GF(929) with generator 3
+func gfTables() {
+	gfOnce.Do(func() {
+		x := 1
+		for i := 0; i < pdf417Prime; i++ {
+			gfExpTable[i] = x
+			x = x * 3 % pdf417Prime
+		}
+		for i := 0; i < pdf417Prime-1; i++ {
+			gfLogTbl[gfExpTable[i]] = i
+		}
+	})
+}
+
+func gfExp(i int) int {
+	gfTables()
+	return gfExpTable[i%(pdf417Prime-1)]
+}
+
+func gfLog(v int) int {
+	gfTables()
+	return gfLogTbl[v]
+}
+
+func gfInverse(v int) int {
+	return gfExp(pdf417Prime - 1 - gfLog(v))
+}
+
+func gfMul(a, b int) int { return a * b % pdf417Prime }
+func gfAdd(a, b int) int { return (a + b) % pdf417Prime }
+func gfSub(a, b int) int { return (pdf417Prime + a - b) % pdf417Prime }
+
+// gfPoly is a polynomial over GF(929) with its highest-degree coefficient first
+type gfPoly []int
+
+func gfMonomial(degree, coefficient int) gfPoly {
+	if coefficient == 0 {
+		return gfPoly{0}
+	}
+	p := make(gfPoly, degree+1)
+	p[0] = coefficient
+	return p
+}
+
+// trim drops leading zero coefficients
+func (p gfPoly) trim() gfPoly {
+	for len(p) > 1 && p[0] == 0 {
+		p = p[1:]
+	}
+	return p
+}
+
+func (p gfPoly) degree() int           { return len(p) - 1 }
+func (p gfPoly) isZero() bool          { return p[0] == 0 }
+func (p gfPoly) coefficient(d int) int { return p[len(p)-1-d] }
+
+func (p gfPoly) eval(x int) int {
+	result := 0
+	for _, c := range p {
+		result = gfAdd(gfMul(result, x), c)
+	}
+	return result
+}
+
+func (p gfPoly) add(q gfPoly) gfPoly {
+	if len(p) < len(q) {
+		p, q = q, p
+	}
+	out := append(gfPoly(nil), p...)
+	offset := len(p) - len(q)
+	for i, c := range q {
+		out[offset+i] = gfAdd(out[offset+i], c)
+	}
+	return out.trim()
+}
+
+func (p gfPoly) neg() gfPoly {
+	out := make(gfPoly, len(p))
+	for i, c := range p {
+		out[i] = gfSub(0, c)
+	}
+	return out
+}
+
+func (p gfPoly) sub(q gfPoly) gfPoly { return p.add(q.neg()) }
+
+func (p gfPoly) scale(s int) gfPoly {
+	out := make(gfPoly, len(p))
+	for i, c := range p {
+		out[i] = gfMul(c, s)
+	}
+	return out.trim()
+}
+
+func (p gfPoly) mulMonomial(degree, s int) gfPoly {
+	if s == 0 {
+		return gfPoly{0}
+	}
+	out := make(gfPoly, len(p)+degree)
+	for i, c := range p {
+		out[i] = gfMul(c, s)
+	}
+	return out.trim()
+}
+
+func (p gfPoly) mul(q gfPoly) gfPoly {
+	if p.isZero() || q.isZero() {
+		return gfPoly{0}
+	}
+	out := make(gfPoly, len(p)+len(q)-1)
+	for i, a := range p {
+		for j, b := range q {
+			out[i+j] = gfAdd(out[i+j], gfMul(a, b))
+		}
+	}
+	return out.trim()
+}
+
+// decodePDF417Data decodes the data codewords after the length descriptor. Text starts
+// in text compaction; bytes are taken as ISO 8859-1.
+func decodePDF417Data(codewords []int) (string, error) {
+	var out []byte
+	mode := pdf417TextLatch
+	for i := 0; i < len(codewords); {
+		switch cw := codewords[i]; cw {
+		case pdf417TextLatch, pdf417ByteLatch, pdf417ByteLatch6, pdf417NumericLatch:
+			mode = cw
+			i++
+			continue
+		case pdf417ByteShift:
+			if mode == pdf417TextLatch {
+				// Part of the text run, which keeps its sub-mode across the shift
+				break
+			}
+			if i+1 < len(codewords) {
+				out = append(out, byte(codewords[i+1]))
+			}
+			i += 2
+			continue
+		case pdf417ECICharset, pdf417ECIUser:
+			i += 2
+			continue
+		case pdf417ECIGeneral:
+			i += 3
+			continue
+		case pdf417MacroBegin, pdf417MacroOptions, pdf417MacroField:
+			// Macro PDF417 control blocks carry no payload
+			i = len(codewords)
+			continue
+		default:
+			if cw >= pdf417TextLatch {
+				// A reserved codeword would otherwise end a run before it starts
+				return "", errPDF417Reserved
+			}
+		}
+
+		end := i
+		for end < len(codewords) && (codewords[end] < pdf417TextLatch || (mode == pdf417TextLatch && codewords[end] == pdf417ByteShift)) {
+			end++
+		}
+		var err error
+		switch mode {
+		case pdf417TextLatch:
+			out = pdf417Text(codewords[i:end], out)
+		case pdf417ByteLatch, pdf417ByteLatch6:
+			out = pdf417Bytes(codewords[i:end], mode == pdf417ByteLatch6, out)
+		case pdf417NumericLatch:
+			out, err = pdf417Numeric(codewords[i:end], out)
+		}
+		if err != nil {
+			return "", err
+		}
+		i = end
+	}
+
+	var text strings.Builder
+	for _, b := range out {
+		text.WriteRune(rune(b))
+	}
+	return text.String(), nil
+}
+
+// Text compaction sub-modes
+const (
+	pdf417Alpha = iota
+	pdf417Lower
+	pdf417Mixed
+	pdf417Punct
+	pdf417AlphaShift
+	pdf417PunctShift
+)
+
+// pdf417Text decodes text compaction codewords, two base-30 values each; a byte shift
+// inside the run carries one raw byte
+func pdf417Text(codewords []int, out []byte) []byte {
+	sub, prior := pdf417Alpha, pdf417Alpha
+	for i := 0; i < len(codewords); i++ {
+		if codewords[i] == pdf417ByteShift {
+			if i+1 < len(codewords) {
+				out = append(out, byte(codewords[i+1]))
+			}
+			i++
+			continue
+		}
+		for _, v := range [2]int{codewords[i] / 30, codewords[i] % 30} {
+			switch sub {
+			case pdf417Alpha:
+				switch {
+				case v < 26:
+					out = append(out, byte('A'+v))
+				case v == 26:
+					out = append(out, ' ')
+				case v == 27:
+					sub = pdf417Lower
+				case v == 28:
+					sub = pdf417Mixed
+				default:
+					prior, sub = sub, pdf417PunctShift
+				}
+			case pdf417AlphaShift:
+				if v < 26 {
+					out = append(out, byte('A'+v))
+				} else if v == 26 {
+					out = append(out, ' ')
+				}
+				sub = prior
+			case pdf417Lower:
+				switch {
+				case v < 26:
+					out = append(out, byte('a'+v))
+				case v == 26:
+					out = append(out, ' ')
+				case v == 27:
+					prior, sub = sub, pdf417AlphaShift
+				case v == 28:
+					sub = pdf417Mixed
+				default:
+					prior, sub = sub, pdf417PunctShift
+				}
+			case pdf417Mixed:
+				switch {
+				case v < 25:
+					out = append(out, pdf417MixedChars[v])
+				case v == 25:
+					sub = pdf417Punct
+				case v == 26:
+					out = append(out, ' ')
+				case v == 27:
+					sub = pdf417Lower
+				case v == 28:
+					sub = pdf417Alpha
+				default:
+					prior, sub = sub, pdf417PunctShift
+				}
+			case pdf417Punct:
+				if v < 29 {
+					out = append(out, pdf417PunctChars[v])
+				} else {
+					sub = pdf417Alpha
+				}
+			case pdf417PunctShift:
+				if v < 29 {
+					out = append(out, pdf417PunctChars[v])
+					sub = prior
+				} else {
+					sub = pdf417Alpha
+				}
+			}
+		}
+	}
+	return out
+}
+
+// pdf417Bytes decodes byte compaction: five codewords in base 900 carry six bytes, and
+// any remaining codewords one byte each. After latch 901 the last one to five codewords
+// are always single bytes.
+func pdf417Bytes(codewords []int, whole bool, out []byte) []byte {
+	groups := len(codewords) / 5
+	if !whole && len(codewords) > 0 {
+		groups = (len(codewords) - 1) / 5
+	}
+	for g := 0; g < groups; g++ {
+		var value uint64
+		for _, cw := range codewords[5*g : 5*g+5] {
+			value = value*900 + uint64(cw)
+		}
+		var bytes [6]byte
+		for k := 5; k >= 0; k-- {
+			bytes[k] = byte(value)
+			value >>= 8
+		}
+		out = append(out, bytes[:]...)
+	}
+	for _, cw := range codewords[5*groups:] {
+		out = append(out, byte(cw))
+	}
+	return out
+}
+
+// pdf417Numeric decodes numeric compaction: up to 15 codewords in base 900 hold a number
+// whose decimal digits after a leading 1 are the payload
+func pdf417Numeric(codewords []int, out []byte) ([]byte, error) {
+	for start := 0; start < len(codewords); start += 15 {
+		value := new(big.Int)
+		for _, cw := range codewords[start:min(start+15, len(codewords))] {
+			value.Mul(value, big.NewInt(900))
+			value.Add(value, big.NewInt(int64(cw)))
+		}
+		digits := value.String()
+		if digits[0] != '1' {
+			return nil, errPDF417Checksum
+		}
+		out = append(out, digits[1:]...)
+	}
+	return out, nil
+}
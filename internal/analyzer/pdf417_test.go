@@ -0,0 +1,285 @@
+package analyzer
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDecodePDF417Data(t *testing.T) {
+	// Numbers past 44 digits take a second group of up to 15 codewords
+	fifty := "12345678901234567890123456789012345678901234567890"
+
+	tests := []struct {
+		name      string
+		codewords []int
+		want      string
+		err       error
+	}{
+		{"text", []int{453, 178, 121, 239}, "PDF417", nil},
+		{"text sub-modes", []int{27, 56, 841, 870}, "Ab 1;", nil},
+		{"lower latch", []int{810, 59}, "ab", nil},
+		{"byte shift in text", []int{1, pdf417ByteShift, 233, 63}, "ABéCD", nil},
+		{"six-byte groups", []int{pdf417ByteLatch6, 121, 291, 257, 858, 233}, "Hello!", nil},
+		{"byte latch with a trailing byte", []int{pdf417ByteLatch, 121, 291, 257, 858, 244, 32}, "Hello, ", nil},
+		{"byte shift in numeric", []int{pdf417NumericLatch, 1, 471, 820, 285, 289, pdf417ByteShift, 'x'}, "000123456789x", nil},
+		{"numeric", []int{pdf417NumericLatch, 1, 471, 820, 285, 289}, "000123456789", nil},
+		{"numeric over one group", []int{pdf417NumericLatch,
+			491, 81, 137, 450, 302, 67, 15, 174, 492, 862, 667, 475, 869, 12, 434, 1, 842, 90}, fifty, nil},
+		{"text after numeric", []int{pdf417NumericLatch, 183, 238, 759, 234, 634, pdf417TextLatch, 453, 178, 121, 239}, "20240417001234PDF417", nil},
+		{"charset ECI", []int{pdf417ECICharset, 26, 453, 178, 121, 239}, "PDF417", nil},
+		{"general ECI", []int{pdf417ECIGeneral, 1, 2, 453, 178, 121, 239}, "PDF417", nil},
+		{"macro control block", []int{453, pdf417MacroBegin, 111, 100}, "PD", nil},
+		{"numeric without its leading one", []int{pdf417NumericLatch, 5}, "", errPDF417Checksum},
+		{"reserved codeword", []int{1, 2, 905, 3}, "", errPDF417Reserved},
+		{"reserved codeword in numeric", []int{pdf417NumericLatch, 1, 471, 918}, "", errPDF417Reserved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type result struct {
+				payload string
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				payload, err := decodePDF417Data(tt.codewords)
+				done <- result{payload, err}
+			}()
+			select {
+			case r := <-done:
+				if r.payload != tt.want || !errors.Is(r.err, tt.err) {
+					t.Errorf("got %q, %v; want %q, %v", r.payload, r.err, tt.want, tt.err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("decoding did not finish")
+			}
+		})
+	}
+}
+
+// pdf417ECCodewords returns the error correction codewords of data: the negated remainder
+// of data(x)·x^ecCount divided by the generator with the roots 3^1..3^ecCount
+func pdf417ECCodewords(data []int, ecCount int) []int {
+	generator := gfPoly{1}
+	for i := 1; i <= ecCount; i++ {
+		generator = generator.mul(gfPoly{1, gfSub(0, gfExp(i))})
+	}
+	remainder := make([]int, len(data)+ecCount)
+	copy(remainder, data)
+	for i := range data {
+		if c := remainder[i]; c != 0 {
+			for j, g := range generator {
+				remainder[i+j] = gfSub(remainder[i+j], gfMul(c, g))
+			}
+		}
+	}
+	ec := make([]int, ecCount)
+	for i, r := range remainder[len(data):] {
+		ec[i] = gfSub(0, r)
+	}
+	return ec
+}
+
+// pdf417Symbol lays out data in a symbol of the given columns: the length descriptor,
+// the data padded with text latches to fill the rows, and the error correction codewords
+func pdf417Symbol(data []int, ecLevel, columns int) []int {
+	ecCount := 2 << ecLevel
+	total := 1 + len(data) + ecCount
+	total += (columns - total%columns) % columns
+	codewords := make([]int, 0, total)
+	codewords = append(codewords, total-ecCount)
+	codewords = append(codewords, data...)
+	for len(codewords) < total-ecCount {
+		codewords = append(codewords, pdf417TextLatch)
+	}
+	return append(codewords, pdf417ECCodewords(codewords, ecCount)...)
+}
+
+// renderPDF417 draws a symbol module pixels wide with rows three modules tall and a quiet
+// zone of two modules; the codewords at the indices in erased are left blank
+func renderPDF417(codewords []int, ecLevel, columns, module int, erased map[int]bool) *image.Gray {
+	rows := len(codewords) / columns
+	width := (2 + 17 + 17 + 17*columns + 17 + 18 + 2) * module
+	img := newPage(width, (rows*3+4)*module, 255)
+	x := 2 * module
+	bits := func(pattern uint32, n, y int) {
+		for k := n - 1; k >= 0; k-- {
+			if pattern>>k&1 == 1 {
+				fillRect(img, image.Rect(x, y, x+module, y+3*module), 0)
+			}
+			x += module
+		}
+	}
+	for r := 0; r < rows; r++ {
+		y := (r*3 + 2) * module
+		cluster, base := r%3, 30*(r/3)
+		left := [3]int{base + (rows-1)/3, base + ecLevel*3 + (rows-1)%3, base + columns - 1}[cluster]
+		right := [3]int{base + columns - 1, base + (rows-1)/3, base + ecLevel*3 + (rows-1)%3}[cluster]
+
+		x = 2 * module
+		bits(pdf417Start, 17, y)
+		bits(pdf417Codewords[cluster][left], 17, y)
+		for c := 0; c < columns; c++ {
+			if i := r*columns + c; erased[i] {
+				x += 17 * module
+			} else {
+				bits(pdf417Codewords[cluster][codewords[i]], 17, y)
+			}
+		}
+		bits(pdf417Codewords[cluster][right], 17, y)
+		bits(pdf417Stop<<1|1, 18, y)
+	}
+	return img
+}
+
+// flipGray turns an image upside down
+func flipGray(img *image.Gray) *image.Gray {
+	b := img.Bounds()
+	out := image.NewGray(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Pix[out.PixOffset(b.Dx()-1-x, b.Dy()-1-y)] = img.Pix[img.PixOffset(x, y)]
+		}
+	}
+	return out
+}
+
+func TestCorrectPDF417(t *testing.T) {
+	data := []int{453, 178, 121, 239, pdf417NumericLatch, 183, 238, 759, 234, 634}
+	const ecCount = 8
+	codewords := pdf417Symbol(data, 2, 3)
+
+	tests := []struct {
+		name     string
+		wrong    []int
+		erasures []int
+		// intact erasures keep their values, as when a codeword was only partly unreadable
+		intact bool
+		ok     bool
+	}{
+		{"clean", nil, nil, false, true},
+		{"four wrong codewords", []int{0, 6, 13, 20}, nil, false, true},
+		{"eight erasures", nil, []int{1, 2, 4, 7, 10, 12, 14, 19}, false, true},
+		{"three wrong codewords and two erasures", []int{3, 9, 17}, []int{5, 11}, false, true},
+		{"two wrong codewords and four erasures", []int{3, 9}, []int{1, 5, 11, 16}, false, true},
+		{"intact erasures", []int{4}, []int{2, 8}, true, true},
+		{"five wrong codewords", []int{2, 5, 9, 15, 18}, nil, false, false},
+		{"nine erasures", nil, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, false, false},
+		{"three wrong codewords and three erasures", []int{3, 9, 17}, []int{5, 11, 14}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := append([]int(nil), codewords...)
+			for _, i := range tt.wrong {
+				received[i] = (received[i] + 100) % pdf417Prime
+			}
+			if !tt.intact {
+				for _, i := range tt.erasures {
+					received[i] = 0
+				}
+			}
+			err := correctPDF417(received, ecCount, tt.erasures)
+			switch {
+			case !tt.ok:
+				if err == nil {
+					t.Errorf("corrected damage past the error correction level to %v", received)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !slices.Equal(received, codewords):
+				t.Errorf("corrected to %v, want %v", received, codewords)
+			}
+		})
+	}
+}
+
+func TestDecodePDF417(t *testing.T) {
+	// "PDF417" in text compaction, then 20240417001234 in numeric compaction
+	data := []int{453, 178, 121, 239, pdf417NumericLatch, 183, 238, 759, 234, 634}
+	const payload = "PDF417" + "20240417001234"
+	const ecLevel, columns = 2, 3
+	codewords := pdf417Symbol(data, ecLevel, columns)
+	// Level 2 adds eight error correction codewords, which correct four wrong codewords
+	// or eight unreadable ones, each wrong one counting twice; the length descriptor at 0
+	// is left alone, as the layout is read from it
+	wrong := func(indices ...int) []int {
+		out := append([]int(nil), codewords...)
+		for _, i := range indices {
+			out[i] = (out[i] + 1 + i) % pdf417Prime
+		}
+		return out
+	}
+	erased := func(indices ...int) map[int]bool {
+		m := make(map[int]bool)
+		for _, i := range indices {
+			m[i] = true
+		}
+		return m
+	}
+
+	tests := []struct {
+		name      string
+		codewords []int
+		erased    map[int]bool
+		flip      bool
+		want      string
+		err       error
+	}{
+		{"clean", codewords, nil, false, payload, nil},
+		{"upside down", codewords, nil, true, payload, nil},
+		{"one wrong codeword", wrong(4), nil, false, payload, nil},
+		{"four wrong codewords", wrong(2, 5, 9, 15), nil, false, payload, nil},
+		{"four erased codewords", codewords, erased(1, 7, 12, 19), false, payload, nil},
+		{"eight erased codewords", codewords, erased(1, 2, 4, 7, 10, 12, 14, 19), false, payload, nil},
+		{"two wrong and four erased codewords", wrong(3, 16), erased(5, 8, 11, 20), false, payload, nil},
+		{"two wrong and four erased codewords upside down", wrong(3, 16), erased(5, 8, 11, 20), true, payload, nil},
+		{"five wrong codewords", wrong(2, 5, 9, 15, 18), nil, false, "", errPDF417Checksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := renderPDF417(tt.codewords, ecLevel, columns, 2, tt.erased)
+			if tt.flip {
+				img = flipGray(img)
+			}
+			got, found, err := decodePDF417(img)
+			if !found {
+				t.Fatal("symbol was not recognized as PDF417")
+			}
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("got %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestDetectPDF417(t *testing.T) {
+	data := []int{453, 178, 121, 239, pdf417NumericLatch, 183, 238, 759, 234, 634}
+	symbol := renderPDF417(pdf417Symbol(data, 2, 3), 2, 3, 3, nil)
+	for _, tt := range []struct {
+		name  string
+		angle float64
+	}{
+		{"upright", 0},
+		{"tilted", 8},
+		{"upside down", 180},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newPage(1000, 600, 255)
+			draw.Draw(page, symbol.Bounds().Add(image.Pt(200, 200)), symbol, image.Point{}, draw.Src)
+			img := page
+			if tt.angle != 0 {
+				img = rotateGray(page, tt.angle, 255)
+			}
+			barcodes := detectBarcodes(img)
+			if len(barcodes) != 1 {
+				t.Fatalf("found %d barcodes, want 1: %+v", len(barcodes), barcodes)
+			}
+			if b := barcodes[0]; b.Symbology != SymbologyPDF417 || !b.Decoded || b.Payload != "PDF41720240417001234" {
+				t.Errorf("read %s %q (decoded %v), want the PDF417 payload", b.Symbology, b.Payload, b.Decoded)
+			}
+		})
+	}
+}
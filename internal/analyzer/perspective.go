@@ -0,0 +1,78 @@
+package analyzer
+
+import "math"
+
+// assumedFocalLength is the focal length as a share of the image's longer side, about
+// a 26 mm equivalent lens as on most phone main cameras. The image does not say how it
+// was taken, so the camera tilt is an estimate under this assumption.
+const assumedFocalLength = 0.75
+
+// Perspective describes how far the document outline is from a rectangle seen head-on
+type Perspective struct {
+	// Shorter over longer of the top and bottom sides, and of the left and right sides
+	HorizontalSideRatio float64 `json:"horizontal_side_ratio"`
+	VerticalSideRatio   float64 `json:"vertical_side_ratio"`
+	// Interior angles in degrees, in the order of DocumentCorners
+	CornerAngles [4]float64 `json:"corner_angles"`
+	// CameraTilt is the angle in degrees between the camera axis and the document normal
+	CameraTilt float64 `json:"camera_tilt"`
+}
+
+// distance returns the length of the segment between two points
+func distance(a, b Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
+
+// measurePerspective measures an outline with corners clockwise from the top-left one
+// in an image of the given size
+func measurePerspective(corners [4]Point, width, height int) Perspective {
+	var p Perspective
+	top, right := distance(corners[0], corners[1]), distance(corners[1], corners[2])
+	bottom, left := distance(corners[2], corners[3]), distance(corners[3], corners[0])
+	p.HorizontalSideRatio = math.Min(top, bottom) / math.Max(top, bottom)
+	p.VerticalSideRatio = math.Min(left, right) / math.Max(left, right)
+
+	for i, c := range corners {
+		prev, next := corners[(i+3)%4], corners[(i+1)%4]
+		a1 := math.Atan2(prev.Y-c.Y, prev.X-c.X)
+		a2 := math.Atan2(next.Y-c.Y, next.X-c.X)
+		angle := math.Abs(a1-a2) * 180 / math.Pi
+		if angle > 180 {
+			angle = 360 - angle
+		}
+		p.CornerAngles[i] = angle
+	}
+
+	p.CameraTilt = cameraTilt(corners, width, height)
+	return p
+}
+
+// cameraTilt estimates the angle between the camera axis and the document normal from
+// the homography that maps a unit square onto the outline. With the camera matrix K,
+// the first two homography columns are K times scaled plane axes r1 and r2, and the
+// plane normal is r1 x r2 whatever the document's aspect ratio.
+func cameraTilt(corners [4]Point, width, height int) float64 {
+	square := [4]Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	h, ok := solveHomography(square, corners)
+	if !ok {
+		return 0
+	}
+
+	f := assumedFocalLength * float64(max(width, height))
+	cx, cy := float64(width)/2, float64(height)/2
+	axis := func(col int) [3]float64 {
+		x, y, z := h[col], h[3+col], h[6+col]
+		return [3]float64{(x - cx*z) / f, (y - cy*z) / f, z}
+	}
+	r1, r2 := axis(0), axis(1)
+	n := [3]float64{
+		r1[1]*r2[2] - r1[2]*r2[1],
+		r1[2]*r2[0] - r1[0]*r2[2],
+		r1[0]*r2[1] - r1[1]*r2[0],
+	}
+	norm := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if norm == 0 {
+		return 0
+	}
+	return math.Acos(math.Min(1, math.Abs(n[2])/norm)) * 180 / math.Pi
+}
@@ -0,0 +1,240 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// QualityProfile holds the thresholds an analysis is judged against
+type QualityProfile struct {
+	Name string `json:"name"`
+
+	// Exposure
+	OverexposedThreshold   float64 `json:"overexposed_threshold"`
+	OversaturatedThreshold float64 `json:"oversaturated_threshold"`
+
+	// Sharpness: BlurMetric decides Blurry, compared against BlurThreshold
+	BlurMetric    SharpnessMetric `json:"blur_metric"`
+	BlurThreshold float64         `json:"blur_threshold"`
+	// BlurNoiseCompensation raises the blur threshold by the amount the estimated noise
+	// inflates the blur metric, so noisy blurry images are not mistaken for sharp ones
+	BlurNoiseCompensation bool `json:"blur_noise_compensation"`
+
+	// White balance: cast strength above which a cast shared by the whole image is
+	// INCORRECT_WHITE_BALANCE
+	MaxColorCast float64 `json:"max_color_cast"`
+
+	// Skew: text line angle in degrees above which an OCR image is SKEWED
+	MaxSkewAngle float64 `json:"max_skew_angle"`
+
+	// Perspective: estimated camera tilt in degrees above which the document photo is
+	// PERSPECTIVE_DISTORTED
+	MaxCameraTilt float64 `json:"max_camera_tilt"`
+
+	// Noise: luma noise sigma (0-255 units) above which the image is NOISY
+	MaxNoiseSigma float64 `json:"max_noise_sigma"`
+
+	// Compression: estimated JPEG quality below MinJPEGQuality or 8x8 blockiness above
+	// MaxBlockiness marks the image HEAVILY_COMPRESSED
+	MinJPEGQuality int     `json:"min_jpeg_quality"`
+	MaxBlockiness  float64 `json:"max_blockiness"`
+
+	// Glare: share of the frame covered by hotspots over the document above which the
+	// image has GLARE
+	MaxGlareFraction float64 `json:"max_glare_fraction"`
+
+	// Illumination: darkest-to-brightest zone ratio below which the image has
+	// UNEVEN_LIGHTING
+	MinIlluminationRatio float64 `json:"min_illumination_ratio"`
+
+	// Clipping: percentage of luma values blown to white or crushed to black above which
+	// the image has CLIPPED_HIGHLIGHTS or CRUSHED_SHADOWS (0 disables the check). Document
+	// profiles leave highlights unchecked, as scanned paper is legitimately pure white.
+	MaxHighlightClipPercent float64 `json:"max_highlight_clip_percent"`
+	MaxShadowClipPercent    float64 `json:"max_shadow_clip_percent"`
+
+	// Contrast: text/background contrast (0-1) below which an OCR image has LOW_CONTRAST
+	MinTextContrast float64 `json:"min_text_contrast"`
+
+	// Text: median x-height in native pixels below which an OCR image has TEXT_TOO_SMALL
+	MinXHeight float64 `json:"min_x_height"`
+
+	// Resolution: physical size of the photographed document and the effective DPI of its
+	// outline below which an OCR image is LOW_RESOLUTION. Without a size, or when no
+	// complete outline is found, the pixel size of the image is judged instead.
+	DocumentSize *PaperSize `json:"document_size,omitempty"`
+	MinDPI       float64    `json:"min_dpi"`
+
+	// Recapture: likelihood (0-1) that the document was photographed off a screen above
+	// which the image is a SCREEN_RECAPTURE (0 disables the check)
+	MaxRecaptureLikelihood float64 `json:"max_recapture_likelihood"`
+
+	// Colour: the document must be a colour original, not a grayscale photo or a
+	// monochrome copy, or the image is NOT_COLOR_ORIGINAL
+	RequireColorOriginal bool `json:"require_color_original"`
+}
+
+// DefaultBlurThresholds are the per-metric values below which an image counts as blurry.
+// They were calibrated on synthetic text documents to flip at the same amount of defocus
+// as the Laplacian variance threshold of 350 (roughly a 3px disk blur).
+var DefaultBlurThresholds = map[SharpnessMetric]float64{
+	MetricLaplacianVariance: 350,
+	MetricTenengrad:         10000,
+	MetricBrenner:           300,
+	MetricModifiedLaplacian: 9,
+	MetricFFTHighFrequency:  0.015,
+}
+
+// Built-in profile names
+const (
+	ProfileStandard = "standard"
+	ProfileOCR      = "ocr"
+	ProfileDocument = "document"
+	ProfileIDCard   = "id_card"
+)
+
+// idCardSize is the ID-1 format of identity and payment cards
+var idCardSize = PaperSize{Name: "ID-1", WidthMM: 53.98, HeightMM: 85.6}
+
+var profiles = map[string]QualityProfile{
+	ProfileStandard: {
+		Name:                    ProfileStandard,
+		OverexposedThreshold:    0.8,
+		OversaturatedThreshold:  0.7,
+		BlurMetric:              MetricLaplacianVariance,
+		BlurThreshold:           DefaultBlurThresholds[MetricLaplacianVariance],
+		MaxColorCast:            0.2,
+		MaxSkewAngle:            5,
+		MaxCameraTilt:           30,
+		MaxNoiseSigma:           8,
+		MinJPEGQuality:          30,
+		MaxBlockiness:           2.2,
+		MaxGlareFraction:        0.005,
+		MinIlluminationRatio:    0.5,
+		MaxHighlightClipPercent: 5,
+		MaxShadowClipPercent:    5,
+		MinDPI:                  150,
+		MaxRecaptureLikelihood:  0.6,
+	},
+	ProfileOCR: {
+		Name:                    ProfileOCR,
+		OverexposedThreshold:    0.75,
+		OversaturatedThreshold:  0.65,
+		BlurMetric:              MetricLaplacianVariance,
+		BlurThreshold:           DefaultBlurThresholds[MetricLaplacianVariance],
+		BlurNoiseCompensation:   true,
+		MaxColorCast:            0.2,
+		MaxSkewAngle:            5,
+		MaxCameraTilt:           20,
+		MaxNoiseSigma:           6,
+		MinJPEGQuality:          50,
+		MaxBlockiness:           1.8,
+		MaxGlareFraction:        0.002,
+		MinIlluminationRatio:    0.65,
+		MaxHighlightClipPercent: 0,
+		MaxShadowClipPercent:    10,
+		MinTextContrast:         0.25,
+		MinXHeight:              10,
+		MinDPI:                  200,
+		MaxRecaptureLikelihood:  0.6,
+	},
+	// Documents are mostly blank paper, which drags content-dependent metrics down;
+	// the spectral ratio judges the detail that is present instead of how much there is
+	ProfileDocument: {
+		Name:                    ProfileDocument,
+		OverexposedThreshold:    0.75,
+		OversaturatedThreshold:  0.65,
+		BlurMetric:              MetricFFTHighFrequency,
+		BlurThreshold:           DefaultBlurThresholds[MetricFFTHighFrequency],
+		BlurNoiseCompensation:   true,
+		MaxColorCast:            0.2,
+		MaxSkewAngle:            5,
+		MaxCameraTilt:           20,
+		MaxNoiseSigma:           6,
+		MinJPEGQuality:          50,
+		MaxBlockiness:           1.8,
+		MaxGlareFraction:        0.002,
+		MinIlluminationRatio:    0.65,
+		MaxHighlightClipPercent: 0,
+		MaxShadowClipPercent:    10,
+		MinTextContrast:         0.25,
+		MinXHeight:              10,
+		MinDPI:                  200,
+		MaxRecaptureLikelihood:  0.6,
+	},
+	// Card print is small, so the card must be captured at a higher resolution than paper,
+	// and identity checks need the colour original rather than a copy
+	ProfileIDCard: {
+		Name:                    ProfileIDCard,
+		OverexposedThreshold:    0.75,
+		OversaturatedThreshold:  0.65,
+		BlurMetric:              MetricLaplacianVariance,
+		BlurThreshold:           DefaultBlurThresholds[MetricLaplacianVariance],
+		BlurNoiseCompensation:   true,
+		MaxColorCast:            0.2,
+		MaxSkewAngle:            5,
+		MaxCameraTilt:           20,
+		MaxNoiseSigma:           6,
+		MinJPEGQuality:          50,
+		MaxBlockiness:           1.8,
+		MaxGlareFraction:        0.002,
+		MinIlluminationRatio:    0.65,
+		MaxHighlightClipPercent: 0,
+		MaxShadowClipPercent:    10,
+		MinTextContrast:         0.25,
+		MinXHeight:              8,
+		DocumentSize:            &idCardSize,
+		MinDPI:                  300,
+		MaxRecaptureLikelihood:  0.5,
+		RequireColorOriginal:    true,
+	},
+}
+
+// DefaultProfile returns the profile used when a request does not name one
+func DefaultProfile(isOCR bool) QualityProfile {
+	if isOCR {
+		return profiles[ProfileOCR]
+	}
+	return profiles[ProfileStandard]
+}
+
+// LookupProfile returns the built-in profile with the given name
+func LookupProfile(name string) (QualityProfile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return QualityProfile{}, fmt.Errorf("unknown profile %q (expected one of %s)", name, strings.Join(ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the names of the built-in profiles in sorted order
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// blurThreshold returns the threshold for the profile's blur metric, lifted by the
+// noise floor when noise compensation is enabled
+func (p QualityProfile) blurThreshold(noiseSigma float64) float64 {
+	if p.BlurNoiseCompensation {
+		return p.BlurThreshold + noiseFloor(p.BlurMetric, noiseSigma)
+	}
+	return p.BlurThreshold
+}
+
+// laplacianThreshold returns the Laplacian variance threshold used for per-tile sharpness
+func (p QualityProfile) laplacianThreshold(noiseSigma float64) float64 {
+	threshold := DefaultBlurThresholds[MetricLaplacianVariance]
+	if p.BlurMetric == MetricLaplacianVariance {
+		threshold = p.BlurThreshold
+	}
+	if p.BlurNoiseCompensation {
+		threshold += noiseFloor(MetricLaplacianVariance, noiseSigma)
+	}
+	return threshold
+}
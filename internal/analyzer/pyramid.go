@@ -0,0 +1,185 @@
+package analyzer
+
+import (
+	"image"
+	"image/draw"
+)
+
+// regionMaxDim bounds the level that region analyses such as glare detection run on;
+// the regions they look for span many pixels, so native resolution adds nothing
+const regionMaxDim = 1024
+
+// regionLevel is the downscaled copy of the image that region analyses run on,
+// together with the document area found on it
+type regionLevel struct {
+	rgba *image.RGBA
+	gray *image.Gray
+	// scale is the number of native pixels per level pixel and origin the minimum
+	// point of the native bounds
+	scale  float64
+	origin image.Point
+	// document is the document area in level coordinates: the bounds of quad when a
+	// document boundary was found, else the spread of edges, else the whole level
+	document    image.Rectangle
+	hasDocument bool
+	quad        *documentQuad
+}
+
+// newRegionLevel locates the document on rgba, a pyramid level of at most regionMaxDim.
+// native is the bounds of the full-resolution image the level was derived from.
+func newRegionLevel(rgba *image.RGBA, native image.Rectangle) *regionLevel {
+	level := &regionLevel{
+		rgba:   rgba,
+		gray:   toGray(rgba),
+		scale:  float64(native.Dx()) / float64(rgba.Bounds().Dx()),
+		origin: native.Min,
+	}
+	if quad, ok := detectDocumentQuad(level.gray); ok {
+		level.quad = &quad
+		level.document, level.hasDocument = quad.bounds().Intersect(level.gray.Bounds()), true
+		return level
+	}
+	level.document, level.hasDocument = estimateDocumentBounds(level.gray)
+	if !level.hasDocument {
+		level.document = level.gray.Bounds()
+	}
+	return level
+}
+
+// toNative maps a rectangle on the level to native pixel coordinates
+func (l *regionLevel) toNative(r image.Rectangle) image.Rectangle {
+	return scaleRect(r, l.scale, l.origin)
+}
+
+// pointToNative maps a point on the level to native pixel coordinates
+func (l *regionLevel) pointToNative(p Point) Point {
+	return Point{X: p.X*l.scale + float64(l.origin.X), Y: p.Y*l.scale + float64(l.origin.Y)}
+}
+
+// innerDocument returns the document area with margin (a share of its size) cut from each
+// side: the outline shrunk towards its centre, as a bounding rectangle and a test for the
+// pixels inside. Without a whole outline the page fills the frame or the outline is a
+// shading boundary, and the edge spread used as the document area covers only the
+// content, so the whole level is used instead.
+func (l *regionLevel) innerDocument(margin float64) (image.Rectangle, func(x, y int) bool) {
+	if l.quad == nil || l.quad.cutOff {
+		area := l.gray.Bounds()
+		dx, dy := int(float64(area.Dx())*margin), int(float64(area.Dy())*margin)
+		return area.Inset(min(dx, dy)), func(x, y int) bool { return true }
+	}
+	centre := quadCentre(l.quad.corners)
+	var inner [4]Point
+	for i, c := range l.quad.corners {
+		inner[i] = Point{
+			X: centre.X + (c.X-centre.X)*(1-2*margin),
+			Y: centre.Y + (c.Y-centre.Y)*(1-2*margin),
+		}
+	}
+	return l.document, func(x, y int) bool { return quadContains(inner, Point{X: float64(x) + 0.5, Y: float64(y) + 0.5}) }
+}
+
+// imagePyramid holds successively halved, area-averaged copies of an image.
+// Level 0 is the native resolution.
+type imagePyramid struct {
+	levels []*image.RGBA
+}
+
+// buildPyramid converts img once and halves it until its longest side is at most maxDim
+func buildPyramid(img image.Image, maxDim int) *imagePyramid {
+	bounds := img.Bounds()
+	base := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(base, base.Bounds(), img, bounds.Min, draw.Src)
+
+	pyramid := &imagePyramid{levels: []*image.RGBA{base}}
+	for {
+		top := pyramid.top()
+		w, h := top.Bounds().Dx(), top.Bounds().Dy()
+		if maxDim <= 0 || (w <= maxDim && h <= maxDim) || w < 2 || h < 2 {
+			break
+		}
+		pyramid.levels = append(pyramid.levels, downsampleHalf(top))
+	}
+	return pyramid
+}
+
+// top returns the smallest level of the pyramid
+func (p *imagePyramid) top() *image.RGBA {
+	return p.levels[len(p.levels)-1]
+}
+
+// atMost returns the largest level whose longest side is at most maxDim, or the smallest
+// level when none is; maxDim <= 0 selects native resolution
+func (p *imagePyramid) atMost(maxDim int) *image.RGBA {
+	if maxDim <= 0 {
+		return p.levels[0]
+	}
+	for _, level := range p.levels {
+		if level.Bounds().Dx() <= maxDim && level.Bounds().Dy() <= maxDim {
+			return level
+		}
+	}
+	return p.top()
+}
+
+// rotate turns every level clockwise by a multiple of 90 degrees
+func (p *imagePyramid) rotate(rotation int) *imagePyramid {
+	rotated := &imagePyramid{levels: make([]*image.RGBA, len(p.levels))}
+	for i, level := range p.levels {
+		rotated.levels[i] = rotateClockwise(level, rotation)
+	}
+	return rotated
+}
+
+// downsampleHalf averages each 2x2 block into one pixel. Odd trailing rows and
+// columns are averaged over the pixels that exist, so the image mean is preserved.
+func downsampleHalf(src *image.RGBA) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := (sw+1)/2, (sh+1)/2
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sum [4]int
+			count := 0
+			for dy := 0; dy < 2; dy++ {
+				sy := 2*y + dy
+				if sy >= sh {
+					continue
+				}
+				for dx := 0; dx < 2; dx++ {
+					sx := 2*x + dx
+					if sx >= sw {
+						continue
+					}
+					i := src.PixOffset(sx, sy)
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					count++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[o+c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+	return dst
+}
+
+// toGray converts an RGBA level into a grayscale image with the same bounds, with the
+// weights of color.GrayModel
+func toGray(img *image.RGBA) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		src := img.Pix[img.PixOffset(bounds.Min.X, y):]
+		dst := gray.Pix[gray.PixOffset(bounds.Min.X, y):]
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b := uint32(src[4*x])*0x101, uint32(src[4*x+1])*0x101, uint32(src[4*x+2])*0x101
+			dst[x] = uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+		}
+	}
+	return gray
+}
@@ -0,0 +1,403 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode/decoder"
+	"github.com/makiuchi-d/gozxing/qrcode/detector"
+)
+
+const (
+	// maxFinderCandidates bounds the finder patterns considered for grouping into codes
+	maxFinderCandidates = 50
+	// minFinderCount is the number of scan rows a finder pattern must be confirmed on
+	minFinderCount = 2
+	// maxFinderModuleSpread is the largest ratio between the module sizes of the three
+	// finder patterns of one code
+	maxFinderModuleSpread = 1.4
+	// minFinderLegRatio is the smallest ratio between the two sides of the finder
+	// triangle; perspective makes them differ, a mismatched triple more so
+	minFinderLegRatio = 0.7
+	// maxFinderAngleError bounds how far the corner at the top-left finder may be from a
+	// right angle, as the relative error of the hypotenuse
+	maxFinderAngleError = 0.15
+	// minTimingMatch is the share of timing pattern modules that must alternate as expected
+	minTimingMatch = 0.8
+	// minQRDimension and maxQRDimension are the module counts per side of versions 1 and 40
+	minQRDimension = 21
+	maxQRDimension = 177
+)
+
+// QRCode is a QR code located by its three finder patterns
+type QRCode struct {
+	// Decoded is false when the finder patterns were found but the code could not be read
+	Decoded bool   `json:"decoded"`
+	Payload string `json:"payload,omitempty"`
+	// ErrorCorrectionLevel is L, M, Q or H
+	ErrorCorrectionLevel string `json:"error_correction_level,omitempty"`
+	Version              int    `json:"version,omitempty"`
+	// Polygon is the outline of the code clockwise from its top-left corner (the corner
+	// with no finder pattern is extrapolated), in native pixel coordinates
+	Polygon    [4]Point `json:"polygon"`
+	ModuleSize float64  `json:"module_size"`
+}
+
+// finderPattern is a candidate finder pattern centre
+type finderPattern struct {
+	x, y   float64
+	module float64
+	// count is the number of scan rows the pattern was found on
+	count int
+}
+
+// GetX, GetY and GetEstimatedModuleSize let the gozxing grid sampler use the pattern
+func (p *finderPattern) GetX() float64                   { return p.x }
+func (p *finderPattern) GetY() float64                   { return p.y }
+func (p *finderPattern) GetEstimatedModuleSize() float64 { return p.module }
+
+// blackMatrix binarizes gray with the ZXing hybrid binarizer, which thresholds 8x8
+// blocks against their neighbourhood and copes with uneven light
+func blackMatrix(gray *image.Gray) (*gozxing.BitMatrix, error) {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	pix := gray.Pix
+	if gray.Stride != w || len(pix) != w*h {
+		pix = make([]byte, w*h)
+		for y := 0; y < h; y++ {
+			copy(pix[y*w:(y+1)*w], gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):])
+		}
+	}
+	source, err := gozxing.NewPlanarYUVLuminanceSource(pix, w, h, 0, 0, w, h, false)
+	if err != nil {
+		return nil, err
+	}
+	bitmap, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		return nil, err
+	}
+	return bitmap.GetBlackMatrix()
+}
+
+// detectQRCodes finds QR codes by their finder patterns and decodes them. Coordinates
+// are relative to the top-left corner of gray.
+func detectQRCodes(gray *image.Gray) []QRCode {
+	bits, err := blackMatrix(gray)
+	if err != nil {
+		return nil
+	}
+
+	var codes []QRCode
+	for _, triple := range groupFinderPatterns(findFinderPatterns(bits)) {
+		bottomLeft, topLeft, topRight := triple[0], triple[1], triple[2]
+		module := (bottomLeft.module + topLeft.module + topRight.module) / 3
+		code := QRCode{Polygon: qrPolygon(bottomLeft, topLeft, topRight, module), ModuleSize: module}
+
+		info := detector.NewFinderPatternInfo(
+			detector.NewFinderPattern1(bottomLeft.x, bottomLeft.y, bottomLeft.module),
+			detector.NewFinderPattern1(topLeft.x, topLeft.y, topLeft.module),
+			detector.NewFinderPattern1(topRight.x, topRight.y, topRight.module))
+		sampled, err := detector.NewDetector(bits).ProcessFinderPatternInfo(info)
+		// Text and patterned backgrounds can mimic three finder patterns, but not the
+		// timing patterns between them
+		if err != nil || !hasTimingPatterns(sampled.GetBits()) {
+			continue
+		}
+		if decoded, err := decoder.NewDecoder().Decode(sampled.GetBits(), nil); err == nil {
+			code.Decoded = true
+			code.Payload = decoded.GetText()
+			code.ErrorCorrectionLevel = decoded.GetECLevel()
+			code.Version = (sampled.GetBits().GetWidth() - 17) / 4
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// hasTimingPatterns reports whether the sampled modules of a code candidate have the
+// alternating row and column that run between the finder patterns of every QR code,
+// allowing a few modules to be misread
+func hasTimingPatterns(modules *gozxing.BitMatrix) bool {
+	dimension := modules.GetWidth()
+	matches, total := 0, 0
+	for i := 8; i < dimension-8; i++ {
+		dark := i%2 == 0
+		if modules.Get(i, 6) == dark {
+			matches++
+		}
+		if modules.Get(6, i) == dark {
+			matches++
+		}
+		total += 2
+	}
+	return total > 0 && float64(matches) >= minTimingMatch*float64(total)
+}
+
+// findFinderPatterns scans every row for dark-light-dark-light-dark runs in the
+// proportions 1:1:3:1:1 and confirms each by a vertical and a horizontal scan through
+// its centre. Repeated finds of the same pattern are merged.
+func findFinderPatterns(bits *gozxing.BitMatrix) []*finderPattern {
+	w, h := bits.GetWidth(), bits.GetHeight()
+	var patterns []*finderPattern
+
+	for y := 0; y < h; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x <= w; x++ {
+			// A virtual light pixel past the row end closes a pattern touching the edge
+			black := x < w && bits.Get(x, y)
+			if black {
+				if state%2 == 1 {
+					state++
+				}
+				counts[state]++
+				continue
+			}
+			if state == 0 && counts[0] == 0 {
+				// Leading light pixels
+				continue
+			}
+			if state%2 == 1 {
+				counts[state]++
+				continue
+			}
+			if state < 4 {
+				state++
+				counts[state]++
+				continue
+			}
+
+			if isFinderRatio(counts) {
+				if p, ok := confirmFinderPattern(bits, counts, x, y); ok {
+					patterns = mergeFinderPattern(patterns, p)
+					counts, state = [5]int{}, 0
+					continue
+				}
+			}
+			// Keep the last dark-light pair as the start of the next candidate
+			counts, state = [5]int{counts[2], counts[3], counts[4], 1, 0}, 3
+		}
+	}
+	return patterns
+}
+
+// isFinderRatio reports whether five run lengths are in the proportions 1:1:3:1:1,
+// allowing each run half a module of error
+func isFinderRatio(counts [5]int) bool {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return false
+		}
+		total += c
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	tolerance := module / 2
+	return math.Abs(module-float64(counts[0])) < tolerance &&
+		math.Abs(module-float64(counts[1])) < tolerance &&
+		math.Abs(3*module-float64(counts[2])) < 3*tolerance &&
+		math.Abs(module-float64(counts[3])) < tolerance &&
+		math.Abs(module-float64(counts[4])) < tolerance
+}
+
+// confirmFinderPattern cross-checks the horizontal runs ending at endX on row y along the
+// column and then the row through their centre, and returns the refined centre
+func confirmFinderPattern(bits *gozxing.BitMatrix, counts [5]int, endX, y int) (*finderPattern, bool) {
+	total := counts[0] + counts[1] + counts[2] + counts[3] + counts[4]
+	centerX := float64(endX-counts[4]-counts[3]) - float64(counts[2])/2
+
+	column := func(i int) bool { return bits.Get(int(centerX), i) }
+	centerY, ok := crossCheckFinder(column, y, bits.GetHeight(), counts[2], total)
+	if !ok {
+		return nil, false
+	}
+	row := func(i int) bool { return bits.Get(i, int(centerY)) }
+	centerX, ok = crossCheckFinder(row, int(centerX), bits.GetWidth(), counts[2], total)
+	if !ok {
+		return nil, false
+	}
+	return &finderPattern{x: centerX, y: centerY, module: float64(total) / 7, count: 1}, true
+}
+
+// crossCheckFinder counts the runs of a finder pattern outwards from center along a line
+// of the given length, read through black, and returns the centre of the pattern on that
+// line when the runs have finder proportions and a total close to originalTotal
+func crossCheckFinder(black func(i int) bool, center, length, maxCount, originalTotal int) (float64, bool) {
+	var counts [5]int
+	// Towards lower coordinates: the centre run, then the light ring, then the dark ring
+	i := center
+	for ; i >= 0 && black(i); i-- {
+		counts[2]++
+	}
+	for ; i >= 0 && !black(i) && counts[1] <= maxCount; i-- {
+		counts[1]++
+	}
+	for ; i >= 0 && black(i) && counts[0] <= maxCount; i-- {
+		counts[0]++
+	}
+	i = center + 1
+	for ; i < length && black(i); i++ {
+		counts[2]++
+	}
+	for ; i < length && !black(i) && counts[3] <= maxCount; i++ {
+		counts[3]++
+	}
+	for ; i < length && black(i) && counts[4] <= maxCount; i++ {
+		counts[4]++
+	}
+
+	total := counts[0] + counts[1] + counts[2] + counts[3] + counts[4]
+	if 5*abs(total-originalTotal) >= 2*originalTotal || !isFinderRatio(counts) {
+		return 0, false
+	}
+	return float64(i-counts[4]-counts[3]) - float64(counts[2])/2, true
+}
+
+// mergeFinderPattern adds p to patterns, averaging it into an existing pattern at the
+// same place and scale
+func mergeFinderPattern(patterns []*finderPattern, p *finderPattern) []*finderPattern {
+	for _, q := range patterns {
+		if math.Abs(q.x-p.x) <= q.module && math.Abs(q.y-p.y) <= q.module &&
+			math.Abs(q.module-p.module) <= math.Max(1, q.module/2) {
+			n := float64(q.count)
+			q.x = (q.x*n + p.x) / (n + 1)
+			q.y = (q.y*n + p.y) / (n + 1)
+			q.module = (q.module*n + p.module) / (n + 1)
+			q.count++
+			return patterns
+		}
+	}
+	return append(patterns, p)
+}
+
+// groupFinderPatterns picks disjoint triples of finder patterns that form the right
+// angle of a QR code, best fitting first. Each triple is ordered bottom-left, top-left,
+// top-right.
+func groupFinderPatterns(patterns []*finderPattern) [][3]*finderPattern {
+	confirmed := patterns[:0:0]
+	for _, p := range patterns {
+		if p.count >= minFinderCount {
+			confirmed = append(confirmed, p)
+		}
+	}
+	sort.Slice(confirmed, func(i, j int) bool { return confirmed[i].count > confirmed[j].count })
+	if len(confirmed) > maxFinderCandidates {
+		confirmed = confirmed[:maxFinderCandidates]
+	}
+
+	type candidate struct {
+		triple [3]*finderPattern
+		err    float64
+	}
+	var candidates []candidate
+	for i := 0; i < len(confirmed); i++ {
+		for j := i + 1; j < len(confirmed); j++ {
+			for k := j + 1; k < len(confirmed); k++ {
+				if triple, err, ok := fitFinderTriple(confirmed[i], confirmed[j], confirmed[k]); ok {
+					candidates = append(candidates, candidate{triple, err})
+				}
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].err < candidates[j].err })
+
+	used := make(map[*finderPattern]bool)
+	var triples [][3]*finderPattern
+	for _, c := range candidates {
+		if used[c.triple[0]] || used[c.triple[1]] || used[c.triple[2]] {
+			continue
+		}
+		for _, p := range c.triple {
+			used[p] = true
+		}
+		triples = append(triples, c.triple)
+	}
+	return triples
+}
+
+// fitFinderTriple orders three finder patterns as bottom-left, top-left and top-right
+// and returns how far they are from the corners of a square code
+func fitFinderTriple(a, b, c *finderPattern) ([3]*finderPattern, float64, bool) {
+	modules := []float64{a.module, b.module, c.module}
+	sort.Float64s(modules)
+	if modules[2] > maxFinderModuleSpread*modules[0] {
+		return [3]*finderPattern{}, 0, false
+	}
+
+	// The top-left pattern is opposite the longest side
+	ab, bc, ac := finderDistance(a, b), finderDistance(b, c), finderDistance(a, c)
+	switch {
+	case bc >= ab && bc >= ac:
+		a, b = b, a
+	case ab >= ac && ab >= bc:
+		b, c = c, b
+	}
+	// Now b is the top-left one; a and c are clockwise after it on screen when the
+	// corner turns from c through b to a
+	if (c.x-b.x)*(a.y-b.y)-(c.y-b.y)*(a.x-b.x) < 0 {
+		a, c = c, a
+	}
+
+	legA, legC := finderDistance(a, b), finderDistance(b, c)
+	legRatio := math.Min(legA, legC) / math.Max(legA, legC)
+	angleErr := math.Abs(finderDistance(a, c)/math.Hypot(legA, legC) - 1)
+	module := (a.module + b.module + c.module) / 3
+	dimension := (legA+legC)/2/module + 7
+	if legRatio < minFinderLegRatio || angleErr > maxFinderAngleError ||
+		dimension < minQRDimension-4 || dimension > maxQRDimension+4 {
+		return [3]*finderPattern{}, 0, false
+	}
+	return [3]*finderPattern{a, b, c}, angleErr + (1 - legRatio), true
+}
+
+// finderDistance returns the distance between two pattern centres
+func finderDistance(a, b *finderPattern) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// qrPolygon returns the outline of a code from its finder pattern centres, which sit 3.5
+// modules inside the code's corners. The fourth corner completes the parallelogram.
+func qrPolygon(bottomLeft, topLeft, topRight *finderPattern, module float64) [4]Point {
+	ux, uy := topRight.x-topLeft.x, topRight.y-topLeft.y
+	vx, vy := bottomLeft.x-topLeft.x, bottomLeft.y-topLeft.y
+	lu, lv := math.Hypot(ux, uy), math.Hypot(vx, vy)
+	ux, uy, vx, vy = ux/lu*3.5*module, uy/lu*3.5*module, vx/lv*3.5*module, vy/lv*3.5*module
+
+	return [4]Point{
+		{X: topLeft.x - ux - vx, Y: topLeft.y - uy - vy},
+		{X: topRight.x + ux - vx, Y: topRight.y + uy - vy},
+		{X: topRight.x + bottomLeft.x - topLeft.x + ux + vx, Y: topRight.y + bottomLeft.y - topLeft.y + uy + vy},
+		{X: bottomLeft.x - ux + vx, Y: bottomLeft.y - uy + vy},
+	}
+}
+
+// applyQRAnalysis records the QR codes in the image and whether one carries the expected
+// payload
+func (a *imageAnalyzer) applyQRAnalysis(gray *image.Gray, opts AnalysisOptions, result *AnalysisResult) {
+	origin := gray.Bounds().Min
+	codes := detectQRCodes(gray)
+	for i := range codes {
+		for j := range codes[i].Polygon {
+			codes[i].Polygon[j].X += float64(origin.X)
+			codes[i].Polygon[j].Y += float64(origin.Y)
+		}
+	}
+	result.QRCodes = codes
+	result.QRDetected = len(codes) > 0
+
+	if expected := strings.TrimSpace(opts.ExpectedQRPayload); expected != "" {
+		match := false
+		for _, code := range codes {
+			if code.Decoded && strings.TrimSpace(code.Payload) == expected {
+				match = true
+			}
+		}
+		result.QRExpectedMatch = &match
+	}
+}
@@ -0,0 +1,270 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// minDocumentAreaFraction is the smallest share of the frame a document may cover
+	minDocumentAreaFraction = 0.1
+	// minQuadFill is the share of the region's convex hull the quadrilateral must cover;
+	// round or irregular shapes fall short (a disk reaches about 0.64)
+	minQuadFill = 0.85
+	// maxHullVertices bounds the hull vertices searched for the largest quadrilateral
+	maxHullVertices = 64
+	// cornerCutOffMargin is the distance from the frame edge, as a share of the frame
+	// size, within which a corner counts as cut off
+	cornerCutOffMargin = 0.005
+)
+
+// Point is a position in image coordinates
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// documentQuad is the document boundary found on the region level. Corners run
+// clockwise from the top-left one.
+type documentQuad struct {
+	corners [4]Point
+	// fraction is the share of the frame inside the quadrilateral
+	fraction float64
+	// cutOff is set when a corner lies on the frame edge
+	cutOff bool
+}
+
+// bounds returns the pixel rectangle enclosing the quadrilateral
+func (q documentQuad) bounds() image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range q.corners {
+		minX, minY = math.Min(minX, c.X), math.Min(minY, c.Y)
+		maxX, maxY = math.Max(maxX, c.X), math.Max(maxY, c.Y)
+	}
+	return image.Rect(int(minX), int(minY), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// detectDocumentQuad finds the document as the largest convex quadrilateral fitting a
+// region of uniform tone. The gray level is split with Otsu's threshold, and for both
+// the light and the dark class the largest region that does not touch all four frame
+// edges (which would be the background) is a candidate. The quadrilateral is the
+// largest one with its corners on the candidate's convex hull; it must cover most of
+// the hull, so only four-sided shapes qualify.
+func detectDocumentQuad(gray *image.Gray) (documentQuad, bool) {
+	rect := gray.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	if w < 8 || h < 8 {
+		return documentQuad{}, false
+	}
+
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+	threshold := uint8(otsuThreshold(hist[:]))
+
+	var best documentQuad
+	bestArea, found := 0.0, false
+	mask := make([]bool, w*h)
+	for _, light := range []bool{true, false} {
+		for y := 0; y < h; y++ {
+			row := gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):]
+			for x := 0; x < w; x++ {
+				mask[y*w+x] = (row[x] > threshold) == light
+			}
+		}
+
+		minArea := int(minDocumentAreaFraction * float64(w*h))
+		labels, components := labelComponentMap(mask, w, h, minArea)
+		var candidate *component
+		for i := range components {
+			c := &components[i]
+			b := c.bounds
+			if b.Min.X == 0 && b.Min.Y == 0 && b.Max.X == w && b.Max.Y == h {
+				continue
+			}
+			if candidate == nil || c.area > candidate.area {
+				candidate = c
+			}
+		}
+		if candidate == nil {
+			continue
+		}
+
+		hull := convexHull(rowExtremes(labels, w, candidate))
+		corners, area := largestQuad(hull)
+		if area < minQuadFill*polygonArea(hull) || area <= bestArea {
+			continue
+		}
+		best = documentQuad{corners: orderCorners(corners), fraction: area / float64(w*h)}
+		bestArea, found = area, true
+	}
+	if !found {
+		return documentQuad{}, false
+	}
+
+	margin := cornerCutOffMargin * float64(max(w, h))
+	for i, c := range best.corners {
+		if c.X <= margin || c.Y <= margin || c.X >= float64(w)-margin || c.Y >= float64(h)-margin {
+			best.cutOff = true
+		}
+		best.corners[i] = Point{X: c.X + float64(rect.Min.X), Y: c.Y + float64(rect.Min.Y)}
+	}
+	return best, true
+}
+
+// rowExtremes returns the outer corners of the leftmost and rightmost pixel of each row
+// of a component, which is all its convex hull depends on
+func rowExtremes(labels []int32, w int, c *component) []Point {
+	points := make([]Point, 0, 4*c.bounds.Dy())
+	for y := c.bounds.Min.Y; y < c.bounds.Max.Y; y++ {
+		row := labels[y*w : (y+1)*w]
+		left, right := -1, -1
+		for x := c.bounds.Min.X; x < c.bounds.Max.X; x++ {
+			if row[x] == c.label {
+				if left < 0 {
+					left = x
+				}
+				right = x
+			}
+		}
+		if left < 0 {
+			continue
+		}
+		fy := float64(y)
+		points = append(points,
+			Point{float64(left), fy}, Point{float64(left), fy + 1},
+			Point{float64(right + 1), fy}, Point{float64(right + 1), fy + 1})
+	}
+	return points
+}
+
+// cross returns the z component of (b-a) x (c-a)
+func cross(a, b, c Point) float64 {
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
+
+// convexHull returns the convex hull of points with Andrew's monotone chain
+func convexHull(points []Point) []Point {
+	if len(points) < 3 {
+		return points
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].X != points[j].X {
+			return points[i].X < points[j].X
+		}
+		return points[i].Y < points[j].Y
+	})
+
+	hull := make([]Point, 0, 2*len(points))
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// polygonArea returns the area of a simple polygon
+func polygonArea(points []Point) float64 {
+	area := 0.0
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	return math.Abs(area) / 2
+}
+
+// largestQuad returns the largest-area quadrilateral with its corners on the vertices
+// of a convex polygon. For each diagonal the best vertex on either side is chosen
+// independently, since the two triangles do not interact.
+func largestQuad(hull []Point) ([4]Point, float64) {
+	if len(hull) > maxHullVertices {
+		reduced := make([]Point, maxHullVertices)
+		for i := range reduced {
+			reduced[i] = hull[i*len(hull)/maxHullVertices]
+		}
+		hull = reduced
+	}
+	n := len(hull)
+	var best [4]Point
+	bestArea := 0.0
+	if n < 4 {
+		return best, 0
+	}
+
+	triangle := func(a, b, c Point) float64 { return math.Abs(cross(a, b, c)) / 2 }
+	for i := 0; i < n; i++ {
+		for k := i + 2; k < n; k++ {
+			bestJ, areaJ := -1, 0.0
+			for j := i + 1; j < k; j++ {
+				if a := triangle(hull[i], hull[j], hull[k]); a > areaJ {
+					bestJ, areaJ = j, a
+				}
+			}
+			bestL, areaL := -1, 0.0
+			for l := k + 1; l < n+i; l++ {
+				if a := triangle(hull[k], hull[l%n], hull[i]); a > areaL {
+					bestL, areaL = l%n, a
+				}
+			}
+			if bestJ >= 0 && bestL >= 0 && areaJ+areaL > bestArea {
+				bestArea = areaJ + areaL
+				best = [4]Point{hull[i], hull[bestJ], hull[k], hull[bestL]}
+			}
+		}
+	}
+	return best, bestArea
+}
+
+// orderCorners orders the corners clockwise on screen, starting from the top-left one
+func orderCorners(corners [4]Point) [4]Point {
+	var cx, cy float64
+	for _, c := range corners {
+		cx += c.X / 4
+		cy += c.Y / 4
+	}
+	sorted := corners
+	sort.Slice(sorted[:], func(i, j int) bool {
+		return math.Atan2(sorted[i].Y-cy, sorted[i].X-cx) < math.Atan2(sorted[j].Y-cy, sorted[j].X-cx)
+	})
+	first := 0
+	for i, c := range sorted {
+		if c.X+c.Y < sorted[first].X+sorted[first].Y {
+			first = i
+		}
+	}
+	var ordered [4]Point
+	for i := range ordered {
+		ordered[i] = sorted[(first+i)%4]
+	}
+	return ordered
+}
+
+// quadCentre returns the mean of a quadrilateral's corners
+func quadCentre(q [4]Point) Point {
+	return Point{X: (q[0].X + q[1].X + q[2].X + q[3].X) / 4, Y: (q[0].Y + q[1].Y + q[2].Y + q[3].Y) / 4}
+}
+
+// quadContains reports whether p lies inside the convex quadrilateral q
+func quadContains(q [4]Point, p Point) bool {
+	positive, negative := false, false
+	for i := range q {
+		c := cross(q[i], q[(i+1)%4], p)
+		positive, negative = positive || c > 0, negative || c < 0
+	}
+	return !(positive && negative)
+}
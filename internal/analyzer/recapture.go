@@ -0,0 +1,382 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// moireTileSize is the side of the tiles whose spectra are searched for moiré, at
+	// native resolution where the pixel grid of a screen is resolved; moireTiles is the
+	// number of tiles with the least print searched, and maxMoireTileInk the share of
+	// print above which a tile has too little paper left
+	moireTileSize   = 256
+	moireTiles      = 4
+	maxMoireTileInk = 0.5
+	// moireInkDepth is how much darker than the paper a pixel of print is, which moiré
+	// on the paper does not reach, and moireFillRadius the radius of the window of paper
+	// print is painted over with
+	moireInkDepth   = 40
+	moireFillRadius = 6
+	// minMoireFrequency and maxMoireFrequency bound the radial frequencies searched, as a
+	// fraction of Nyquist; lower ones hold the layout of the page itself
+	minMoireFrequency = 0.1
+	maxMoireFrequency = 0.9
+	// moirePeakRatio is how far above the median of its frequency ring a spectral bin must
+	// rise to count as a periodic peak
+	moirePeakRatio = 100.0
+	// moireMinAmplitude is the smallest amplitude, in 0-255 units, of a periodic pattern
+	// counted as moiré; fainter ones are left by painting over the print
+	moireMinAmplitude = 2.0
+	// moireFullShare is the share of the searched spectral energy in peaks at which the
+	// moiré score reaches 1
+	moireFullShare = 0.02
+	// bezelBand is the width of the strip outside the document checked for a screen
+	// bezel, as a share of the level's shorter side
+	bezelBand = 0.02
+	// bezelMaxLuma and bezelMaxSigma bound the brightness and its spread in a bezel strip,
+	// and bezelMinDark is the share of its pixels that must be that dark
+	bezelMaxLuma  = 50
+	bezelMaxSigma = 12.0
+	bezelMinDark  = 0.85
+	// minBezelSides is the number of document sides a bezel must line
+	minBezelSides = 3
+	// bandingMinAmplitude and bandingFullAmplitude are the RMS ripple of the background
+	// brightness, in 0-255 units, from which refresh banding counts at all and in full
+	bandingMinAmplitude  = 0.5
+	bandingFullAmplitude = 3.0
+	// paperPercentile picks the paper rather than the print in a line or a tile
+	paperPercentile = 0.8
+	// minBandingLength is the number of rows or columns a banding profile needs
+	minBandingLength = 64
+	// moireWeight, bandingWeight and bezelWeight are the likelihoods of a recapture that
+	// each cue alone gives at full strength
+	moireWeight   = 0.85
+	bandingWeight = 0.6
+	bezelWeight   = 0.5
+)
+
+// recaptureCues holds the signs of a document photographed off a screen
+type recaptureCues struct {
+	// moire is the 0-1 strength of isolated periodic peaks in the spectrum, banding the
+	// 0-1 strength of periodic brightness bands, and bezel is set when a dark, uniform
+	// frame lines the document
+	moire, banding float64
+	bezel          bool
+}
+
+// likelihood combines the cues as independent evidence (noisy-OR)
+func (c recaptureCues) likelihood() float64 {
+	bezel := 0.0
+	if c.bezel {
+		bezel = 1
+	}
+	return 1 - (1-moireWeight*c.moire)*(1-bandingWeight*c.banding)*(1-bezelWeight*bezel)
+}
+
+// moireScore measures moiré on the tiles of rect with the least print. Monospaced text,
+// such as receipts and machine-readable zones, forms a lattice of spectral peaks much
+// like a screen's, so the print is painted over with the surrounding paper first: a
+// screen modulates the paper as well as the print. Tiles are ranked by the print their
+// histograms show, so only the few searched are painted over.
+func moireScore(gray *image.Gray, rect image.Rectangle) float64 {
+	rect = rect.Intersect(gray.Bounds())
+	type tile struct {
+		rect image.Rectangle
+		dark float64
+	}
+	var tiles []tile
+	for y := rect.Min.Y; y+moireTileSize <= rect.Max.Y; y += moireTileSize {
+		for x := rect.Min.X; x+moireTileSize <= rect.Max.X; x += moireTileSize {
+			t := tile{rect: image.Rect(x, y, x+moireTileSize, y+moireTileSize)}
+			var hist [256]int
+			for ty := t.rect.Min.Y; ty < t.rect.Max.Y; ty++ {
+				for _, v := range gray.Pix[gray.PixOffset(t.rect.Min.X, ty):gray.PixOffset(t.rect.Max.X, ty)] {
+					hist[v]++
+				}
+			}
+			cut := percentileFromHistogram(hist[:], paperPercentile) - moireInkDepth
+			for v := 0; v < max(0, cut); v++ {
+				t.dark += float64(hist[v])
+			}
+			tiles = append(tiles, t)
+		}
+	}
+	sort.Slice(tiles, func(i, j int) bool { return tiles[i].dark < tiles[j].dark })
+
+	var share float64
+	searched := 0
+	for _, t := range tiles {
+		if searched == moireTiles {
+			break
+		}
+		paper, ink := paperOnly(gray, t.rect)
+		if ink > maxMoireTileInk {
+			continue
+		}
+		share += spectralPeakShare(paper)
+		searched++
+	}
+	if searched == 0 {
+		return 0
+	}
+	return math.Min(1, share/float64(searched)/moireFullShare)
+}
+
+// paperOnly copies rect of gray with every pixel of print, and its neighbours, replaced
+// by the mean of the paper around it, and returns the copy with the share of pixels
+// replaced. Print is anything moireInkDepth darker than the paper level of the tile.
+func paperOnly(gray *image.Gray, rect image.Rectangle) (*image.Gray, float64) {
+	w, h := rect.Dx(), rect.Dy()
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+	cut := percentileFromHistogram(hist[:], paperPercentile) - moireInkDepth
+
+	// Print is grown by a pixel to take in the anti-aliased rims of strokes
+	dark := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dark[y*w+x] = int(gray.Pix[gray.PixOffset(rect.Min.X+x, rect.Min.Y+y)]) < cut
+		}
+	}
+	ink := make([]bool, w*h)
+	var inked int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for dy := max(0, y-1); dy <= min(h-1, y+1) && !ink[y*w+x]; dy++ {
+				for dx := max(0, x-1); dx <= min(w-1, x+1); dx++ {
+					if dark[dy*w+dx] {
+						ink[y*w+x] = true
+						inked++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// Paper sums over a square window, from integral images of value and count
+	sums := make([]int, (w+1)*(h+1))
+	counts := make([]int, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v, c := 0, 0
+			if !ink[y*w+x] {
+				v, c = int(gray.Pix[gray.PixOffset(rect.Min.X+x, rect.Min.Y+y)]), 1
+			}
+			i := (y+1)*(w+1) + x + 1
+			sums[i] = v + sums[i-1] + sums[i-w-1] - sums[i-w-2]
+			counts[i] = c + counts[i-1] + counts[i-w-1] - counts[i-w-2]
+		}
+	}
+	box := func(table []int, x0, y0, x1, y1 int) int {
+		return table[y1*(w+1)+x1] - table[y0*(w+1)+x1] - table[y1*(w+1)+x0] + table[y0*(w+1)+x0]
+	}
+
+	paper := image.NewGray(image.Rect(0, 0, w, h))
+	fill := uint8(cut + moireInkDepth)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			o := paper.PixOffset(x, y)
+			if !ink[y*w+x] {
+				paper.Pix[o] = gray.Pix[gray.PixOffset(rect.Min.X+x, rect.Min.Y+y)]
+				continue
+			}
+			x0, y0 := max(0, x-moireFillRadius), max(0, y-moireFillRadius)
+			x1, y1 := min(w, x+moireFillRadius+1), min(h, y+moireFillRadius+1)
+			paper.Pix[o] = fill
+			if n := box(counts, x0, y0, x1, y1); n > 0 {
+				paper.Pix[o] = uint8(box(sums, x0, y0, x1, y1) / n)
+			}
+		}
+	}
+	return paper, float64(inked) / float64(w*h)
+}
+
+// spectralPeakShare returns the share of the spectral energy of gray held by isolated
+// periodic peaks of visible amplitude. A screen's pixel grid and its subpixel stripes
+// beat against the camera's sensor grid into narrow peaks, where paper spreads its
+// energy over each frequency ring. Bins near the axes are skipped, as straight edges put energy there,
+// and so are the multiples of 1/8 cycle per pixel, where JPEG block edges put theirs.
+func spectralPeakShare(gray *image.Gray) float64 {
+	spectrum, size, ok := powerSpectrum(gray, gray.Bounds(), moireTileSize)
+	if !ok {
+		return 0
+	}
+	half := size / 2
+	block := size / 8
+	onBlockGrid := func(k int) bool {
+		m := ((k % block) + block) % block
+		return m <= 1 || m >= block-1
+	}
+
+	// Bins are grouped into rings of unit radius
+	rings := make([][]float64, half+1)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			kx, ky := x-half, y-half
+			if abs(kx) <= 1 || abs(ky) <= 1 || (onBlockGrid(kx) && onBlockGrid(ky)) {
+				continue
+			}
+			r := math.Hypot(float64(kx), float64(ky))
+			f := r / float64(half)
+			if f < minMoireFrequency || f > maxMoireFrequency {
+				continue
+			}
+			rings[int(r)] = append(rings[int(r)], spectrum[y][x])
+		}
+	}
+
+	// A sinusoid of amplitude A puts A*size²/8 into its bin through the Hann window, of
+	// which about half the power is left when it falls between bins
+	n2 := float64(size * size)
+	minPeak := 0.5 * math.Pow(moireMinAmplitude*n2/8, 2)
+	var total, peaks float64
+	for _, ring := range rings {
+		if len(ring) < 8 {
+			continue
+		}
+		sorted := append([]float64(nil), ring...)
+		sort.Float64s(sorted)
+		median := sorted[len(sorted)/2]
+		for _, p := range ring {
+			total += p
+			if p > moirePeakRatio*median && p > minPeak {
+				peaks += p
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return peaks / total
+}
+
+// hasScreenBezel reports whether dark, uniform strips line at least minBezelSides sides
+// of the document area on the level. Sides flush with the frame edge have no strip.
+func hasScreenBezel(gray *image.Gray, document image.Rectangle) bool {
+	bounds := gray.Bounds()
+	band := max(2, int(float64(min(bounds.Dx(), bounds.Dy()))*bezelBand))
+	strips := []image.Rectangle{
+		image.Rect(document.Min.X, document.Min.Y-band, document.Max.X, document.Min.Y),
+		image.Rect(document.Max.X, document.Min.Y, document.Max.X+band, document.Max.Y),
+		image.Rect(document.Min.X, document.Max.Y, document.Max.X, document.Max.Y+band),
+		image.Rect(document.Min.X-band, document.Min.Y, document.Min.X, document.Max.Y),
+	}
+
+	sides := 0
+	for _, strip := range strips {
+		strip = strip.Intersect(bounds)
+		if strip.Dx() < 2 || strip.Dy() < 2 {
+			continue
+		}
+		var n, dark int
+		var sum, sumSq float64
+		for y := strip.Min.Y; y < strip.Max.Y; y++ {
+			for _, v := range gray.Pix[gray.PixOffset(strip.Min.X, y):gray.PixOffset(strip.Max.X, y)] {
+				n++
+				if v <= bezelMaxLuma {
+					dark++
+				}
+				sum += float64(v)
+				sumSq += float64(v) * float64(v)
+			}
+		}
+		nf := float64(n)
+		if float64(dark)/nf >= bezelMinDark && math.Sqrt(math.Max(0, varianceOf(sum, sumSq, nf))) <= bezelMaxSigma {
+			sides++
+		}
+	}
+	return sides >= minBezelSides
+}
+
+// bandingScore measures periodic brightness bands across the rows or the columns of rect.
+// A rolling shutter catches the screen's refresh as bands of the whole width of the
+// frame. Each line's brightness is a high percentile, so text on it does not count, and the
+// profile is detrended to drop shading before its periodicity is measured.
+func bandingScore(gray *image.Gray, rect image.Rectangle) float64 {
+	rect = rect.Intersect(gray.Bounds())
+	rows := make([]float64, rect.Dy())
+	cols := make([]float64, rect.Dx())
+	var hist [256]int
+	for y := range rows {
+		hist = [256]int{}
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, rect.Min.Y+y):gray.PixOffset(rect.Max.X, rect.Min.Y+y)] {
+			hist[v]++
+		}
+		rows[y] = float64(percentileFromHistogram(hist[:], paperPercentile))
+	}
+	for x := range cols {
+		hist = [256]int{}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			hist[gray.Pix[gray.PixOffset(rect.Min.X+x, y)]]++
+		}
+		cols[x] = float64(percentileFromHistogram(hist[:], paperPercentile))
+	}
+	return math.Max(profileBanding(rows), profileBanding(cols))
+}
+
+// profileBanding returns the 0-1 banding strength of a brightness profile: its ripple
+// around a moving average of an eighth of its length, weighted by the height of the
+// strongest autocorrelation peak after the first zero crossing
+func profileBanding(profile []float64) float64 {
+	n := len(profile)
+	if n < minBandingLength {
+		return 0
+	}
+	radius := n / 16
+	residual := make([]float64, n)
+	var energy float64
+	for i := range profile {
+		lo, hi := max(0, i-radius), min(n, i+radius+1)
+		var sum float64
+		for _, v := range profile[lo:hi] {
+			sum += v
+		}
+		residual[i] = profile[i] - sum/float64(hi-lo)
+		energy += residual[i] * residual[i]
+	}
+	amplitude := math.Sqrt(energy / float64(n))
+	if amplitude < bandingMinAmplitude || energy == 0 {
+		return 0
+	}
+
+	correlation := func(lag int) float64 {
+		var sum float64
+		for i := 0; i+lag < n; i++ {
+			sum += residual[i] * residual[i+lag]
+		}
+		return sum / energy * float64(n) / float64(n-lag)
+	}
+	periodicity, crossed := 0.0, false
+	for lag := 2; lag <= n/3; lag++ {
+		c := correlation(lag)
+		if !crossed {
+			crossed = c < 0
+			continue
+		}
+		periodicity = math.Max(periodicity, c)
+	}
+	strength := math.Min(1, (amplitude-bandingMinAmplitude)/(bandingFullAmplitude-bandingMinAmplitude))
+	return math.Max(0, math.Min(1, periodicity)) * strength
+}
+
+// applyRecaptureAnalysis looks for signs that the document was photographed off a
+// screen: moiré in the native grayscale, and refresh banding and a bezel on the level
+func (a *imageAnalyzer) applyRecaptureAnalysis(gray *image.Gray, level *regionLevel, profile QualityProfile, result *AnalysisResult) {
+	cues := recaptureCues{
+		moire:   moireScore(gray, level.toNative(level.document)),
+		banding: bandingScore(level.gray, level.document),
+		bezel:   level.hasDocument && hasScreenBezel(level.gray, level.document),
+	}
+	result.MoireScore = cues.moire
+	result.BandingScore = cues.banding
+	result.ScreenBezel = cues.bezel
+	result.RecaptureLikelihood = cues.likelihood()
+	result.ScreenRecapture = profile.MaxRecaptureLikelihood > 0 && result.RecaptureLikelihood > profile.MaxRecaptureLikelihood
+}
@@ -0,0 +1,216 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MaxRectifiedSide bounds the longest side of a rectified image in pixels
+const MaxRectifiedSide = 10000
+
+// maxRectifiedPixelRatio bounds the pixel count of a rectified image as a multiple of
+// the source's: a paper size and DPI may upsample a small outline, but not without limit
+const maxRectifiedPixelRatio = 4
+
+// ErrNoDocument is returned when no document outline was found to rectify
+var ErrNoDocument = errors.New("no document outline found")
+
+// PaperSize is a physical document format in millimetres, portrait. Roll formats such
+// as receipts have a fixed width and any length, and leave HeightMM at 0.
+type PaperSize struct {
+	Name     string  `json:"name"`
+	WidthMM  float64 `json:"width_mm"`
+	HeightMM float64 `json:"height_mm"`
+}
+
+// Built-in paper sizes
+var paperSizes = []PaperSize{
+	{Name: "A4", WidthMM: 210, HeightMM: 297},
+	{Name: "letter", WidthMM: 215.9, HeightMM: 279.4},
+	// ID-1 is the credit card and ID card format
+	{Name: "ID-1", WidthMM: 53.98, HeightMM: 85.6},
+	// Thermal receipt rolls
+	{Name: "receipt-80", WidthMM: 80},
+	{Name: "receipt-58", WidthMM: 58},
+}
+
+// LookupPaperSize returns the built-in paper size with the given name, ignoring case
+func LookupPaperSize(name string) (PaperSize, error) {
+	for _, size := range paperSizes {
+		if strings.EqualFold(size.Name, name) {
+			return size, nil
+		}
+	}
+	return PaperSize{}, fmt.Errorf("unknown paper size %q (expected one of %s)", name, strings.Join(PaperSizeNames(), ", "))
+}
+
+// PaperSizeNames returns the names of the built-in paper sizes in sorted order
+func PaperSizeNames() []string {
+	names := make([]string, len(paperSizes))
+	for i, size := range paperSizes {
+		names[i] = size.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RectifyOptions configures a perspective correction
+type RectifyOptions struct {
+	// Corners overrides document detection: the outline clockwise from the top-left
+	// corner, in image coordinates
+	Corners *[4]Point
+	// PaperSize fixes the aspect ratio of the output, turned to match the outline
+	PaperSize *PaperSize
+	// DPI sizes the output from PaperSize; 0 keeps the outline's own resolution
+	DPI int
+}
+
+// Validate checks that the options can be satisfied
+func (o RectifyOptions) Validate() error {
+	if o.DPI < 0 {
+		return fmt.Errorf("dpi must not be negative")
+	}
+	if o.DPI > 0 && o.PaperSize == nil {
+		return fmt.Errorf("dpi requires a paper size")
+	}
+	return nil
+}
+
+// RectifyResult is a document warped to a flat rectangle
+type RectifyResult struct {
+	Image *image.RGBA
+	// Corners is the outline that was warped, in image coordinates
+	Corners [4]Point
+	// Detected is set when the corners came from document detection
+	Detected bool
+	// CornerCutOff is set when a detected corner lies on the frame edge
+	CornerCutOff bool
+}
+
+// Rectify warps the document in img to a flat rectangle using the detected or given
+// outline
+func (a *imageAnalyzer) Rectify(img image.Image, opts RectifyOptions) (RectifyResult, error) {
+	if err := opts.Validate(); err != nil {
+		return RectifyResult{}, err
+	}
+
+	var result RectifyResult
+	bounds := img.Bounds()
+	if opts.Corners != nil {
+		for i, c := range opts.Corners {
+			if c.X < float64(bounds.Min.X) || c.Y < float64(bounds.Min.Y) || c.X > float64(bounds.Max.X) || c.Y > float64(bounds.Max.Y) {
+				return RectifyResult{}, fmt.Errorf("corner %d (%.1f, %.1f) lies outside the image", i, c.X, c.Y)
+			}
+		}
+		result.Corners = *opts.Corners
+	} else {
+		level := newRegionLevel(buildPyramid(img, regionMaxDim).top(), bounds)
+		if level.quad == nil {
+			return RectifyResult{}, ErrNoDocument
+		}
+		for i, c := range level.quad.corners {
+			result.Corners[i] = level.pointToNative(c)
+		}
+		result.Detected = true
+		result.CornerCutOff = level.quad.cutOff
+	}
+
+	width, height, err := rectifiedSize(result.Corners, opts, bounds.Dx()*bounds.Dy())
+	if err != nil {
+		return RectifyResult{}, err
+	}
+	output := [4]Point{{0, 0}, {float64(width), 0}, {float64(width), float64(height)}, {0, float64(height)}}
+	h, ok := solveHomography(output, result.Corners)
+	if !ok {
+		return RectifyResult{}, fmt.Errorf("document corners are degenerate")
+	}
+
+	result.Image = warpPerspective(img, h, width, height, nil)
+	return result, nil
+}
+
+// rectifiedSize returns the output size for an outline. Without a paper size it keeps
+// the longer of each pair of opposite sides; with one it keeps the measured width and
+// takes the paper's aspect ratio, or sizes both sides from the paper and DPI. A roll
+// format only fixes the shorter side, and the outline's own aspect ratio is kept.
+// sourcePixels is the pixel count of the image the outline lies in.
+func rectifiedSize(corners [4]Point, opts RectifyOptions, sourcePixels int) (width, height int, err error) {
+	w := math.Max(distance(corners[0], corners[1]), distance(corners[3], corners[2]))
+	h := math.Max(distance(corners[0], corners[3]), distance(corners[1], corners[2]))
+
+	if paper := opts.PaperSize; paper != nil && paper.HeightMM == 0 {
+		if opts.DPI > 0 {
+			side := paper.WidthMM / 25.4 * float64(opts.DPI)
+			ratio := side / math.Min(w, h)
+			w, h = w*ratio, h*ratio
+		}
+	} else if paper != nil {
+		paperW, paperH := paper.WidthMM, paper.HeightMM
+		if w > h {
+			paperW, paperH = paperH, paperW
+		}
+		if opts.DPI > 0 {
+			w = paperW / 25.4 * float64(opts.DPI)
+		}
+		h = w * paperH / paperW
+	}
+
+	width, height = int(math.Round(w)), int(math.Round(h))
+	if width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("document outline is empty")
+	}
+	if width > MaxRectifiedSide || height > MaxRectifiedSide {
+		return 0, 0, fmt.Errorf("rectified image of %dx%d exceeds %d pixels per side", width, height, MaxRectifiedSide)
+	}
+	if limit := maxRectifiedPixelRatio * sourcePixels; width*height > limit {
+		return 0, 0, fmt.Errorf("rectified image of %dx%d exceeds %d pixels, %d times the source image", width, height, limit, maxRectifiedPixelRatio)
+	}
+	return width, height, nil
+}
+
+// warpPerspective renders a width x height image whose pixel centres are mapped into
+// img by h, with bilinear interpolation. Samples outside img take the fill colour, or
+// repeat its edge pixels when fill is nil.
+func warpPerspective(img image.Image, h homography, width, height int, fill *color.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(bounds)
+		draw.Draw(src, bounds, img, bounds.Min, draw.Src)
+	}
+	maxX, maxY := float64(bounds.Max.X-1), float64(bounds.Max.Y-1)
+	minX, minY := float64(bounds.Min.X), float64(bounds.Min.Y)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := h.apply(Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+			if fill != nil && (p.X < minX || p.Y < minY || p.X > maxX+1 || p.Y > maxY+1) {
+				dst.SetRGBA(x, y, *fill)
+				continue
+			}
+			// Pixel centres sit at half-integer coordinates in the source as well
+			sx := math.Max(minX, math.Min(maxX, p.X-0.5))
+			sy := math.Max(minY, math.Min(maxY, p.Y-0.5))
+			x0, y0 := int(sx), int(sy)
+			x1, y1 := min(x0+1, bounds.Max.X-1), min(y0+1, bounds.Max.Y-1)
+			fx, fy := sx-float64(x0), sy-float64(y0)
+
+			i00, i10 := src.PixOffset(x0, y0), src.PixOffset(x1, y0)
+			i01, i11 := src.PixOffset(x0, y1), src.PixOffset(x1, y1)
+			o := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				top := float64(src.Pix[i00+c])*(1-fx) + float64(src.Pix[i10+c])*fx
+				bottom := float64(src.Pix[i01+c])*(1-fx) + float64(src.Pix[i11+c])*fx
+				dst.Pix[o+c] = uint8(top*(1-fy) + bottom*fy + 0.5)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,135 @@
+package analyzer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSolveHomography(t *testing.T) {
+	from := [4]Point{{0, 0}, {300, 0}, {300, 400}, {0, 400}}
+	to := [4]Point{{150, 100}, {470, 130}, {450, 560}, {120, 520}}
+	h, ok := solveHomography(from, to)
+	if !ok {
+		t.Fatal("solveHomography failed on a convex quad")
+	}
+	for i := range from {
+		if p := h.apply(from[i]); distance(p, to[i]) > 1e-6 {
+			t.Errorf("corner %d maps to (%.4f, %.4f), want (%.0f, %.0f)", i, p.X, p.Y, to[i].X, to[i].Y)
+		}
+	}
+	// The centre of the square lands on the crossing of the quad's diagonals
+	centre := h.apply(Point{150, 200})
+	back, _ := solveHomography(to, from)
+	if p := back.apply(centre); distance(p, Point{150, 200}) > 1e-6 {
+		t.Errorf("inverse maps the centre back to (%.4f, %.4f)", p.X, p.Y)
+	}
+
+	if _, ok := solveHomography(from, [4]Point{{0, 0}, {100, 100}, {200, 200}, {0, 300}}); ok {
+		t.Error("solveHomography accepted three collinear corners")
+	}
+}
+
+func TestRectifiedSize(t *testing.T) {
+	a4, receipt := paperSizes[0], PaperSize{Name: "receipt-80", WidthMM: 80}
+	portrait := [4]Point{{10, 10}, {310, 20}, {320, 420}, {0, 410}}
+	landscape := [4]Point{{0, 0}, {420, 0}, {420, 300}, {0, 300}}
+	const source = 1000 * 1000
+
+	tests := []struct {
+		name          string
+		corners       [4]Point
+		opts          RectifyOptions
+		source        int
+		width, height int
+		err           string
+	}{
+		{"outline keeps its longer sides", portrait, RectifyOptions{}, source, 320, 401, ""},
+		{"paper fixes the aspect ratio", portrait, RectifyOptions{PaperSize: &a4}, source, 320, 453, ""},
+		{"paper turns with a landscape outline", landscape, RectifyOptions{PaperSize: &a4}, source, 420, 297, ""},
+		{"paper and dpi size both sides", portrait, RectifyOptions{PaperSize: &a4, DPI: 150}, 2 * source, 1240, 1754, ""},
+		{"roll width sets the shorter side", portrait, RectifyOptions{PaperSize: &receipt, DPI: 100}, source, 315, 395, ""},
+		{"over the pixel ratio", portrait, RectifyOptions{PaperSize: &a4, DPI: 300}, source, 0, 0, "times the source image"},
+		{"over the side limit", portrait, RectifyOptions{PaperSize: &receipt, DPI: 5000}, 1 << 40, 0, 0, "pixels per side"},
+		{"empty outline", [4]Point{}, RectifyOptions{}, source, 0, 0, "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, err := rectifiedSize(tt.corners, tt.opts, tt.source)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %dx%d, error %v; want an error containing %q", width, height, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if abs(width-tt.width) > 1 || abs(height-tt.height) > 1 {
+				t.Errorf("got %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+// TestRectifyRoundTrip warps a page into a perspective view, rectifies it from the given
+// and from the detected outline, and compares the result with the page
+func TestRectifyRoundTrip(t *testing.T) {
+	a := newTestAnalyzer(t)
+
+	// The page has a dark block near its top-left corner, so a turned or mirrored result
+	// does not match
+	page := newPage(300, 400, 225)
+	fillRect(page, image.Rect(30, 30, 130, 90), 40)
+	fillRect(page, image.Rect(30, 150, 270, 170), 60)
+	fillRect(page, image.Rect(30, 220, 200, 240), 60)
+	fillRect(page, image.Rect(180, 320, 270, 370), 90)
+	pageCorners := [4]Point{{0, 0}, {300, 0}, {300, 400}, {0, 400}}
+
+	quad := [4]Point{{150, 100}, {470, 130}, {450, 560}, {120, 520}}
+	toPage, _ := solveHomography(quad, pageCorners)
+	table := color.RGBA{60, 50, 45, 255}
+	frame := warpPerspective(page, toPage, 640, 660, &table)
+
+	for _, tt := range []struct {
+		name    string
+		corners *[4]Point
+	}{
+		{"given corners", &quad},
+		{"detected corners", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.Rectify(frame, RectifyOptions{Corners: tt.corners})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.corners == nil {
+				if !result.Detected {
+					t.Error("corners were not reported as detected")
+				}
+				for i, c := range result.Corners {
+					if d := distance(c, quad[i]); d > 6 {
+						t.Errorf("corner %d detected at (%.1f, %.1f), %.1f px from (%.0f, %.0f)", i, c.X, c.Y, d, quad[i].X, quad[i].Y)
+					}
+				}
+			}
+
+			// Each output pixel is compared with the page pixel at the same relative position
+			out := result.Image
+			b := out.Bounds()
+			var diff float64
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					px := min(299, (x*300+150)/b.Dx())
+					py := min(399, (y*400+200)/b.Dy())
+					diff += math.Abs(float64(out.Pix[out.PixOffset(x, y)]) - float64(page.Pix[page.PixOffset(px, py)]))
+				}
+			}
+			if mean := diff / float64(b.Dx()*b.Dy()); mean > 8 {
+				t.Errorf("rectified %dx%d image differs from the page by %.1f gray levels on average", b.Dx(), b.Dy(), mean)
+			}
+		})
+	}
+}
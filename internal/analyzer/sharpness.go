@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Blur verdicts reported in AnalysisResult.BlurVerdict
+const (
+	BlurVerdictSharp           = "SHARP"
+	BlurVerdictBlurry          = "BLURRY"
+	BlurVerdictPartiallyBlurry = "PARTIALLY_BLURRY"
+)
+
+const (
+	// DefaultSharpnessGrid is the number of tile rows and columns used when the request does not set one
+	DefaultSharpnessGrid = 4
+	// MaxSharpnessGrid bounds the grid so tiles stay large enough to measure
+	MaxSharpnessGrid = 16
+
+	// tileTextureStdDev is the minimum intensity standard deviation for a tile to carry
+	// enough detail to judge focus; flat tiles (blank paper, sky) are ignored
+	tileTextureStdDev = 8.0
+	// relativeTileSharpness is the fraction of the reference (75th percentile) tile
+	// variance a tile must reach to count as sharp, so focus is judged against the
+	// image's own content rather than only the global threshold
+	relativeTileSharpness = 0.1
+	// minSharpAreaPercent is the share of textured tiles that must be sharp before an
+	// image that is sharp overall is still considered fully in focus, and minSoftTiles
+	// the number of soft tiles a partly blurred region must span. The share is counted
+	// in tiles, so the region it takes depends on the grid: on the default 4x4 grid 4 of
+	// 16 textured tiles must be soft, and one soft tile, such as a margin with a few
+	// words, is not enough.
+	minSharpAreaPercent = 80.0
+	minSoftTiles        = 2
+)
+
+// Region is a rectangular area in image coordinates
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// regionFromRect converts an image.Rectangle into a Region
+func regionFromRect(r image.Rectangle) Region {
+	return Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// sharpnessTile holds the focus measurements of one grid cell
+type sharpnessTile struct {
+	rect     image.Rectangle
+	variance float64
+	textured bool
+}
+
+// sharpnessMap is the per-tile sharpness of an image, stored row by row
+type sharpnessMap struct {
+	rows, cols int
+	tiles      []sharpnessTile
+}
+
+// computeSharpnessMap splits the image into a rows x cols grid and measures the Laplacian
+// variance of each cell. Outside accurate mode only a centred window of each cell is measured.
+func (a *imageAnalyzer) computeSharpnessMap(gray *image.Gray, rows, cols int, settings modeSettings) sharpnessMap {
+	bounds := gray.Bounds()
+	m := sharpnessMap{rows: rows, cols: cols, tiles: make([]sharpnessTile, 0, rows*cols)}
+
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < cols; tx++ {
+			cell := image.Rect(
+				bounds.Min.X+tx*bounds.Dx()/cols, bounds.Min.Y+ty*bounds.Dy()/rows,
+				bounds.Min.X+(tx+1)*bounds.Dx()/cols, bounds.Min.Y+(ty+1)*bounds.Dy()/rows,
+			)
+
+			measured := cell
+			if size := settings.sharpnessTileSize; size > 0 && size < cell.Dx() && size < cell.Dy() {
+				c := image.Pt((cell.Min.X+cell.Max.X)/2, (cell.Min.Y+cell.Max.Y)/2)
+				measured = image.Rect(c.X-size/2, c.Y-size/2, c.X+size/2, c.Y+size/2)
+			}
+
+			var sum, sumSq, n float64
+			a.accumulateLaplacian(gray, measured, &sum, &sumSq, &n)
+
+			m.tiles = append(m.tiles, sharpnessTile{
+				rect:     cell,
+				variance: varianceOf(sum, sumSq, n),
+				textured: intensityStdDev(gray, measured) >= tileTextureStdDev,
+			})
+		}
+	}
+	return m
+}
+
+// summarize returns the percentage of textured tiles that are sharp, the blurriest
+// textured tile and the number of textured tiles that are not sharp. A tile is sharp when its variance
+// reaches both the global threshold and a fraction of the image's reference tile.
+func (m sharpnessMap) summarize(threshold float64) (sharpPercent float64, blurriest *sharpnessTile, soft int) {
+	variances := make([]float64, 0, len(m.tiles))
+	for _, tile := range m.tiles {
+		if tile.textured {
+			variances = append(variances, tile.variance)
+		}
+	}
+	if len(variances) == 0 {
+		return 0, nil, 0
+	}
+	sort.Float64s(variances)
+	cutoff := math.Max(threshold, relativeTileSharpness*variances[len(variances)*3/4])
+
+	sharp := 0
+	for i := range m.tiles {
+		tile := &m.tiles[i]
+		if !tile.textured {
+			continue
+		}
+		if tile.variance >= cutoff {
+			sharp++
+		}
+		if blurriest == nil || tile.variance < blurriest.variance {
+			blurriest = tile
+		}
+	}
+	return 100 * float64(sharp) / float64(len(variances)), blurriest, len(variances) - sharp
+}
+
+// heatmap returns the tile variances as a rows x cols matrix
+func (m sharpnessMap) heatmap() [][]float64 {
+	matrix := make([][]float64, m.rows)
+	for r := range matrix {
+		matrix[r] = make([]float64, m.cols)
+		for c := range matrix[r] {
+			matrix[r][c] = m.tiles[r*m.cols+c].variance
+		}
+	}
+	return matrix
+}
+
+// applyRegionalSharpness fills the regional sharpness fields of result and refines the blur verdict
+func (a *imageAnalyzer) applyRegionalSharpness(gray *image.Gray, opts AnalysisOptions, settings modeSettings, threshold float64, result *AnalysisResult) {
+	rows, cols := opts.SharpnessGridRows, opts.SharpnessGridCols
+	if rows <= 0 {
+		rows = DefaultSharpnessGrid
+	}
+	if cols <= 0 {
+		cols = DefaultSharpnessGrid
+	}
+
+	m := a.computeSharpnessMap(gray, rows, cols, settings)
+	sharpPercent, blurriest, soft := m.summarize(threshold)
+
+	result.SharpAreaPercent = sharpPercent
+	if blurriest != nil {
+		region := regionFromRect(blurriest.rect)
+		result.BlurriestRegion = &region
+	}
+	if opts.IncludeHeatmap {
+		result.SharpnessMap = m.heatmap()
+	}
+
+	switch {
+	case result.Blurry:
+		result.BlurVerdict = BlurVerdictBlurry
+	case soft >= minSoftTiles && sharpPercent < minSharpAreaPercent:
+		result.BlurVerdict = BlurVerdictPartiallyBlurry
+	default:
+		result.BlurVerdict = BlurVerdictSharp
+	}
+}
+
+// intensityStdDev returns the standard deviation of the gray levels inside rect
+func intensityStdDev(gray *image.Gray, rect image.Rectangle) float64 {
+	rect = rect.Intersect(gray.Bounds())
+	var sum, sumSq, n float64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)]
+		for _, p := range row {
+			v := float64(p)
+			sum += v
+			sumSq += v * v
+		}
+		n += float64(len(row))
+	}
+	return math.Sqrt(math.Max(varianceOf(sum, sumSq, n), 0))
+}
@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+// SharpnessMetric names a focus measure that can decide whether an image is blurry
+type SharpnessMetric string
+
+const (
+	// MetricLaplacianVariance is the variance of the 4-neighbour Laplacian
+	MetricLaplacianVariance SharpnessMetric = "laplacian_variance"
+	// MetricTenengrad is the mean Sobel gradient energy
+	MetricTenengrad SharpnessMetric = "tenengrad"
+	// MetricBrenner is the mean squared difference between pixels two apart
+	MetricBrenner SharpnessMetric = "brenner"
+	// MetricModifiedLaplacian is the mean sum of absolute second derivatives in x and y
+	MetricModifiedLaplacian SharpnessMetric = "modified_laplacian"
+	// MetricFFTHighFrequency is the share of spectral energy above fftHighFrequencyCutoff
+	MetricFFTHighFrequency SharpnessMetric = "fft_high_frequency"
+)
+
+const (
+	// fftWindowSize is the side of the windows the spectral metric is pooled over, and
+	// fftMaxWindows bounds how many of them are sampled across the measured regions
+	fftWindowSize = 128
+	fftMaxWindows = 64
+	// fftMinDetail is the standard deviation of image structure, net of noise, below which
+	// a window is flat (blank paper, plain background) and left out
+	fftMinDetail = 4.0
+	// fftHighFrequencyCutoff is the radial frequency, as a fraction of Nyquist, above
+	// which spectral energy counts as high-frequency detail
+	fftHighFrequencyCutoff = 0.25
+)
+
+// SharpnessMetrics holds every focus measure computed on the grayscale image. All
+// gradient metrics are per-pixel means, so they do not grow with image size.
+type SharpnessMetrics struct {
+	LaplacianVariance float64 `json:"laplacian_variance"`
+	Tenengrad         float64 `json:"tenengrad"`
+	Brenner           float64 `json:"brenner"`
+	ModifiedLaplacian float64 `json:"modified_laplacian"`
+	FFTHighFreqRatio  float64 `json:"fft_high_frequency_ratio"`
+}
+
+// Value returns the named metric
+func (m SharpnessMetrics) Value(metric SharpnessMetric) float64 {
+	switch metric {
+	case MetricTenengrad:
+		return m.Tenengrad
+	case MetricBrenner:
+		return m.Brenner
+	case MetricModifiedLaplacian:
+		return m.ModifiedLaplacian
+	case MetricFFTHighFrequency:
+		return m.FFTHighFreqRatio
+	default:
+		return m.LaplacianVariance
+	}
+}
+
+// sharpnessRegions returns the rectangles sharpness is measured on: the full frame in
+// accurate mode, otherwise an evenly spaced grid of native-resolution tiles. Falls back to
+// the full frame when the tiles would cover most of the image anyway.
+func sharpnessRegions(bounds image.Rectangle, settings modeSettings) []image.Rectangle {
+	tiles, size := settings.sharpnessTiles, settings.sharpnessTileSize
+	if tiles <= 0 || tiles*size*2 > bounds.Dx() || tiles*size*2 > bounds.Dy() {
+		return []image.Rectangle{bounds}
+	}
+
+	regions := make([]image.Rectangle, 0, tiles*tiles)
+	for ty := 0; ty < tiles; ty++ {
+		for tx := 0; tx < tiles; tx++ {
+			// Centre each tile within its grid cell
+			cx := bounds.Min.X + (2*tx+1)*bounds.Dx()/(2*tiles)
+			cy := bounds.Min.Y + (2*ty+1)*bounds.Dy()/(2*tiles)
+			regions = append(regions, image.Rect(cx-size/2, cy-size/2, cx+size/2, cy+size/2))
+		}
+	}
+	return regions
+}
+
+// computeSharpnessMetrics evaluates every sharpness metric over the same regions of the
+// gray buffer. noiseSigma is the estimated luma noise, which the spectral metric removes.
+func (a *imageAnalyzer) computeSharpnessMetrics(gray *image.Gray, settings modeSettings, noiseSigma float64) SharpnessMetrics {
+	regions := sharpnessRegions(gray.Bounds(), settings)
+
+	var lapSum, lapSumSq, lapN float64
+	var tenengrad, brenner, modLap, n float64
+	stride := gray.Stride
+	for _, rect := range regions {
+		a.accumulateLaplacian(gray, rect, &lapSum, &lapSumSq, &lapN)
+
+		// Gradient metrics need a two-pixel margin for the Brenner difference
+		rect = rect.Intersect(gray.Bounds())
+		for y := rect.Min.Y + 1; y < rect.Max.Y-1; y++ {
+			for x := rect.Min.X + 1; x < rect.Max.X-2; x++ {
+				i := gray.PixOffset(x, y)
+				p := func(o int) float64 { return float64(gray.Pix[i+o]) }
+
+				gx := (p(-stride+1) + 2*p(1) + p(stride+1)) - (p(-stride-1) + 2*p(-1) + p(stride-1))
+				gy := (p(stride-1) + 2*p(stride) + p(stride+1)) - (p(-stride-1) + 2*p(-stride) + p(-stride+1))
+				tenengrad += gx*gx + gy*gy
+
+				d := p(2) - p(0)
+				brenner += d * d
+
+				modLap += math.Abs(2*p(0)-p(-1)-p(1)) + math.Abs(2*p(0)-p(-stride)-p(stride))
+				n++
+			}
+		}
+	}
+
+	metrics := SharpnessMetrics{LaplacianVariance: varianceOf(lapSum, lapSumSq, lapN)}
+	if n > 0 {
+		metrics.Tenengrad = tenengrad / n
+		metrics.Brenner = brenner / n
+		metrics.ModifiedLaplacian = modLap / n
+	}
+	metrics.FFTHighFreqRatio = highFrequencyRatio(gray, regions, noiseSigma)
+	return metrics
+}
+
+// fftWindows spreads up to fftMaxWindows windows evenly over the regions, centred in the
+// cells of a grid laid over each region
+func fftWindows(gray *image.Gray, regions []image.Rectangle) []image.Rectangle {
+	perSide := max(1, int(math.Sqrt(float64(fftMaxWindows/len(regions)))))
+	var windows []image.Rectangle
+	for _, rect := range regions {
+		rect = rect.Intersect(gray.Bounds())
+		cols := min(perSide, rect.Dx()/fftWindowSize)
+		rows := min(perSide, rect.Dy()/fftWindowSize)
+		for ty := 0; ty < rows; ty++ {
+			for tx := 0; tx < cols; tx++ {
+				cx := rect.Min.X + (2*tx+1)*rect.Dx()/(2*cols)
+				cy := rect.Min.Y + (2*ty+1)*rect.Dy()/(2*rows)
+				half := fftWindowSize / 2
+				windows = append(windows, image.Rect(cx-half, cy-half, cx+half, cy+half))
+			}
+		}
+	}
+	return windows
+}
+
+// highFrequencyRatio returns the share of (non-DC) spectral energy above the cutoff
+// frequency, pooled over the windows of the regions that hold structure. White noise of
+// the given sigma spreads a known power over every frequency bin, and is taken out of
+// both sums, so noise on a blurred image does not pass for detail.
+func highFrequencyRatio(gray *image.Gray, regions []image.Rectangle, noiseSigma float64) float64 {
+	// Each bin of a Hann-windowed crop receives sigma² times the squared window energy
+	var windowEnergy float64
+	for i := 0; i < fftWindowSize; i++ {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(fftWindowSize-1))
+		windowEnergy += w * w
+	}
+	noisePower := noiseSigma * noiseSigma * windowEnergy * windowEnergy
+
+	var total, high float64
+	for _, window := range fftWindows(gray, regions) {
+		var sum, sumSq, n float64
+		for y := window.Min.Y; y < window.Max.Y; y++ {
+			for _, v := range gray.Pix[gray.PixOffset(window.Min.X, y):gray.PixOffset(window.Max.X, y)] {
+				sum += float64(v)
+				sumSq += float64(v) * float64(v)
+				n++
+			}
+		}
+		if varianceOf(sum, sumSq, n)-noiseSigma*noiseSigma < fftMinDetail*fftMinDetail {
+			continue
+		}
+
+		spectrum, size, ok := powerSpectrum(gray, window, fftWindowSize)
+		if !ok {
+			continue
+		}
+		half := float64(size / 2)
+		for y := range spectrum {
+			for x, power := range spectrum[y] {
+				fx, fy := float64(x)-half, float64(y)-half
+				if fx == 0 && fy == 0 {
+					continue
+				}
+				total += power - noisePower
+				if math.Hypot(fx, fy)/half > fftHighFrequencyCutoff {
+					high += power - noisePower
+				}
+			}
+		}
+	}
+	if total <= 0 {
+		return 0
+	}
+	return math.Max(0, high) / total
+}
@@ -0,0 +1,47 @@
+package analyzer
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestSpectralSharpness(t *testing.T) {
+	a := newTestAnalyzer(t)
+	document, err := LookupProfile(ProfileDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages whose text leaves the centre of the frame blank
+	r := rand.New(rand.NewSource(1))
+	page := func() *image.Gray {
+		img := newPage(1600, 1200, 235)
+		drawText(img, image.Rect(100, 80, 1500, 380), 16, r)
+		drawText(img, image.Rect(100, 820, 1500, 1120), 16, r)
+		return img
+	}
+	crisp := page()
+	// Blurred well past legibility, then covered in sensor noise
+	blurred := boxBlur(page(), 4)
+	addNoise(blurred, 1.5, r)
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		blurry bool
+	}{
+		{"crisp page with a blank centre", crisp, false},
+		{"blurred page with sensor noise", blurred, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []AnalysisMode{ModeFast, ModeBalanced, ModeAccurate} {
+				result := a.AnalyzeWithOptions(tt.img, AnalysisOptions{Mode: mode, Profile: &document})
+				if result.Blurry != tt.blurry {
+					t.Errorf("%s mode: blurry = %v, want %v (fft ratio %.4f)", mode, result.Blurry, tt.blurry, result.Sharpness.FFTHighFreqRatio)
+				}
+			}
+		})
+	}
+}
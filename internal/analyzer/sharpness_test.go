@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"image"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+func TestRegionalBlurVerdict(t *testing.T) {
+	a := newTestAnalyzer(t)
+	r := rand.New(rand.NewSource(1))
+
+	// softened returns a crisp page of text with the given area out of focus
+	softened := func(soft image.Rectangle) *image.Gray {
+		page := newPage(1600, 1200, 235)
+		addNoise(page, 2, r)
+		drawText(page, image.Rect(40, 40, 1560, 1160), 16, r)
+		if !soft.Empty() {
+			blurred := boxBlur(page.SubImage(soft).(*image.Gray), 4)
+			draw.Draw(page, soft, blurred, soft.Min, draw.Src)
+		}
+		return page
+	}
+
+	tests := []struct {
+		name string
+		soft image.Rectangle
+		want string
+	}{
+		{"in focus", image.Rectangle{}, BlurVerdictSharp},
+		{"one soft tile of the 4x4 grid", image.Rect(400, 300, 800, 600), BlurVerdictSharp},
+		{"soft left half", image.Rect(0, 0, 800, 1200), BlurVerdictPartiallyBlurry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := a.AnalyzeWithOptions(softened(tt.soft), AnalysisOptions{Mode: ModeAccurate})
+			if result.BlurVerdict != tt.want {
+				t.Errorf("verdict = %s, want %s (sharp area %.0f%%)", result.BlurVerdict, tt.want, result.SharpAreaPercent)
+			}
+		})
+	}
+}
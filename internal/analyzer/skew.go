@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// maxSkewSearch bounds the candidate angles in degrees; larger rotations are a
+	// matter of page orientation rather than skew
+	maxSkewSearch = 45.0
+	// skewCoarseStep must stay below the width of the projection peak, about one text
+	// line height over the document width, or the peak can fall between candidates
+	skewCoarseStep = 0.5
+	// skewFineStep refines the angle around the best coarse candidate
+	skewFineStep = 0.05
+	// maxSkewSamples bounds the number of ink pixels projected per candidate angle
+	maxSkewSamples = 20000
+	// minSkewInkFraction and maxSkewInkFraction bound the share of ink that looks like
+	// text rather than a blank page or a dark photo
+	minSkewInkFraction = 0.002
+	maxSkewInkFraction = 0.4
+	// minSkewConfidence is the confidence an angle needs before the image counts as skewed
+	minSkewConfidence = 0.15
+)
+
+// skewEstimate is the angle of the text lines in degrees, positive when they rise to the
+// right (counter-clockwise), with a 0-1 confidence in it
+type skewEstimate struct {
+	angle      float64
+	confidence float64
+}
+
+// estimateSkew finds the text line angle in rect by projection-profile variance
+// maximization: ink pixels are projected perpendicular to each candidate angle, and
+// when the angle matches the lines the profile splits into sharp peaks and gaps,
+// maximizing its sum of squares. ok is false when rect holds no text-like ink.
+func estimateSkew(gray *image.Gray, rect image.Rectangle) (skewEstimate, bool) {
+	rect = rect.Intersect(gray.Bounds())
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(rect.Min.X, y):gray.PixOffset(rect.Max.X, y)] {
+			hist[v]++
+		}
+	}
+	total := rect.Dx() * rect.Dy()
+	threshold := otsuThreshold(hist[:])
+	dark := 0
+	for v := 0; v <= threshold; v++ {
+		dark += hist[v]
+	}
+	// Ink is the minority class, so light text on a dark background works as well
+	inkIsDark := dark <= total-dark
+	ink := min(dark, total-dark)
+	if total == 0 || float64(ink) < minSkewInkFraction*float64(total) || float64(ink) > maxSkewInkFraction*float64(total) {
+		return skewEstimate{}, false
+	}
+
+	// Sample ink coordinates relative to the centre of rect. The pixel grid has angles
+	// of its own that would show up in the profile, so samples are drawn at random (with
+	// a fixed seed) and jittered within their pixel.
+	keep := float64(maxSkewSamples) / float64(ink)
+	rng := rand.New(rand.NewSource(1))
+	cx, cy := float64(rect.Min.X+rect.Max.X)/2, float64(rect.Min.Y+rect.Max.Y)/2
+	points := make([][2]float64, 0, min(ink, maxSkewSamples*11/10))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if (gray.Pix[gray.PixOffset(x, y)] <= uint8(threshold)) != inkIsDark {
+				continue
+			}
+			if keep >= 1 || rng.Float64() < keep {
+				points = append(points, [2]float64{float64(x) + rng.Float64() - cx, float64(y) + rng.Float64() - cy})
+			}
+		}
+	}
+
+	diagonal := int(math.Hypot(float64(rect.Dx()), float64(rect.Dy()))) + 2
+	bins := make([]float64, diagonal)
+	score := func(deg float64) float64 {
+		sin, cos := math.Sincos(deg * math.Pi / 180)
+		for i := range bins {
+			bins[i] = 0
+		}
+		for _, p := range points {
+			bins[int(p[0]*sin+p[1]*cos+float64(diagonal)/2)]++
+		}
+		sum := 0.0
+		for _, b := range bins {
+			sum += b * b
+		}
+		return sum
+	}
+
+	var coarse []float64
+	best, bestScore := 0.0, -1.0
+	for deg := -maxSkewSearch; deg <= maxSkewSearch; deg += skewCoarseStep {
+		s := score(deg)
+		coarse = append(coarse, s)
+		if s > bestScore {
+			best, bestScore = deg, s
+		}
+	}
+	center := best
+	for deg := center - skewCoarseStep; deg <= center+skewCoarseStep; deg += skewFineStep {
+		if s := score(deg); s > bestScore {
+			best, bestScore = deg, s
+		}
+	}
+
+	// Text gives one dominant peak; without lines every angle scores about the same
+	sort.Float64s(coarse)
+	median := coarse[len(coarse)/2]
+	return skewEstimate{angle: best, confidence: 1 - median/bestScore}, true
+}
@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimateSkew(t *testing.T) {
+	page := newPage(1000, 800, 235)
+	drawText(page, image.Rect(150, 150, 850, 650), 12, rand.New(rand.NewSource(1)))
+
+	for _, angle := range []float64{-44.13, -29.96, -12.41, -3.87, -1.33, -0.52, 0, 0.02, 0.71, 2.23, 4.98, 8.46, 19.88, 44.12} {
+		t.Run(fmt.Sprintf("%.2f°", angle), func(t *testing.T) {
+			rotated := rotateGray(page, angle, 235)
+			skew, ok := estimateSkew(rotated, rotated.Bounds())
+			if !ok {
+				t.Fatal("no text found")
+			}
+			if err := math.Abs(skew.angle - angle); err > 0.1 {
+				t.Errorf("angle = %.2f°, want %.2f° ± 0.1°", skew.angle, angle)
+			}
+			if skew.confidence < minSkewConfidence || skew.confidence > 1 {
+				t.Errorf("confidence = %.2f, want %.2f-1", skew.confidence, minSkewConfidence)
+			}
+		})
+	}
+
+	t.Run("blank page", func(t *testing.T) {
+		blank := newPage(1000, 800, 235)
+		addNoise(blank, 2, rand.New(rand.NewSource(1)))
+		if skew, ok := estimateSkew(blank, blank.Bounds()); ok && skew.confidence >= minSkewConfidence {
+			t.Errorf("blank page skewed by %.2f° with confidence %.2f", skew.angle, skew.confidence)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// textMaxDim bounds the copy of the image whose text is read; the x-height of small
+	// print must span a few pixels on it
+	textMaxDim = 2048
+	// textMargin is the share of the document cut from each side before its ink is read,
+	// so page edges and their shadows do not count as text
+	textMargin = 0.02
+	// minCharHeight and maxCharShare bound the height of a character, in pixels and as a
+	// share of the short side of the image
+	minCharHeight = 3
+	maxCharShare  = 0.2
+	// maxCharAspect is the widest width-to-height ratio of a character; letters of small
+	// or bold print run together into whole words
+	maxCharAspect = 10.0
+	// minCharFill is the lowest share of its bounding box a character covers; frames,
+	// table grids and underlined blocks are sparser
+	minCharFill = 0.05
+	// maxCharGap is the widest gap between neighbouring characters of a line, relative
+	// to the taller one; word spaces of monospaced print reach 1.5, and wider gaps
+	// separate columns
+	maxCharGap = 2.0
+	// minCharOverlap is the least vertical overlap of neighbouring characters, relative
+	// to the shorter one, and maxCharHeightRatio the largest ratio of their heights
+	minCharOverlap     = 0.5
+	maxCharHeightRatio = 3.0
+	// minLineChars is the number of characters a chain needs to count as a text line
+	minLineChars = 3
+	// baselineTolerance is the distance from the fitted baseline, relative to the median
+	// character height, within which a character sits on the baseline
+	baselineTolerance = 0.25
+	// xHeightBandShare is the share of the densest row above the baseline that rows of
+	// the x-height band reach; the ascenders above it are sparser
+	xHeightBandShare = 0.4
+	// maxLineHeightRatio is the largest ratio of the ink height of a line to its
+	// x-height; ascenders and descenders of Latin text span about twice the x-height,
+	// while chains of graphics fragments rise much higher
+	maxLineHeightRatio = 4.0
+	// maxLineGap is the widest gap between the lines of a block, relative to the taller
+	// line, and maxLineXHeightRatio the largest ratio of their x-heights
+	maxLineGap          = 1.0
+	maxLineXHeightRatio = 1.5
+)
+
+// textLevel is a copy of the image fine enough for small print, holding the ink that
+// Sauvola binarization finds in the document area
+type textLevel struct {
+	// ink is 0 on ink pixels and 255 elsewhere
+	ink *image.Gray
+	// scale is the number of native pixels per text level pixel and origin the minimum
+	// point of the native bounds
+	scale  float64
+	origin image.Point
+}
+
+// newTextLevel binarizes rgba, a pyramid level of at most textMaxDim, and keeps the ink
+// inside the document found on level. Ink outside it, such as the grain of a table, is
+// dropped. native is the bounds of the full-resolution image.
+func newTextLevel(rgba *image.RGBA, native image.Rectangle, level *regionLevel) *textLevel {
+	gray := toGray(rgba)
+	bin := binarize(gray, BinarizeOptions{})
+
+	area, inside := level.innerDocument(textMargin)
+	toLevel := float64(level.gray.Rect.Dx()) / float64(gray.Rect.Dx())
+	ink := image.NewGray(gray.Rect)
+	for y := 0; y < gray.Rect.Dy(); y++ {
+		for x := 0; x < gray.Rect.Dx(); x++ {
+			i := ink.PixOffset(x, y)
+			ink.Pix[i] = 255
+			lx, ly := int(float64(x)*toLevel), int(float64(y)*toLevel)
+			if bin.Pix[bin.PixOffset(x, y)] == 0 && (image.Point{X: lx, Y: ly}).In(area) && inside(lx, ly) {
+				ink.Pix[i] = 0
+			}
+		}
+	}
+	return &textLevel{ink: ink, scale: float64(native.Dx()) / float64(gray.Rect.Dx()), origin: native.Min}
+}
+
+// textLine is a chain of characters on a common baseline, in text level coordinates.
+// area is its length along the baseline times the height of its ink.
+type textLine struct {
+	bounds  image.Rectangle
+	xHeight float64
+	area    float64
+}
+
+// textLayout is the text found on a text level
+type textLayout struct {
+	lines  []textLine
+	blocks []image.Rectangle
+}
+
+// detectText finds characters as connected ink components of plausible size and shape,
+// chains neighbours of similar height into lines, measures the x-height of each line
+// above its fitted baseline and groups stacked lines into blocks
+func detectText(text *textLevel) textLayout {
+	w, h := text.ink.Rect.Dx(), text.ink.Rect.Dy()
+	mask := make([]bool, w*h)
+	for i, v := range text.ink.Pix {
+		mask[i] = v == 0
+	}
+	labels, components := labelComponentMap(mask, w, h, 2)
+	maxHeight := int(maxCharShare * float64(min(w, h)))
+	var chars []component
+	for _, c := range components {
+		cw, ch := c.bounds.Dx(), c.bounds.Dy()
+		if ch >= minCharHeight && ch <= maxHeight && float64(cw) <= maxCharAspect*float64(ch) &&
+			float64(c.area) >= minCharFill*float64(cw*ch) {
+			chars = append(chars, c)
+		}
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i].bounds.Min.X < chars[j].bounds.Min.X })
+
+	// Each character links to its nearest neighbour on the right
+	parent := make([]int, len(chars))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, a := range chars {
+		best, bestGap := -1, math.MaxInt
+		reach := a.bounds.Max.X + int(maxCharGap*maxCharHeightRatio*float64(a.bounds.Dy()))
+		for j := i + 1; j < len(chars) && chars[j].bounds.Min.X <= reach; j++ {
+			b := chars[j]
+			gap := b.bounds.Min.X - a.bounds.Max.X
+			ha, hb := a.bounds.Dy(), b.bounds.Dy()
+			overlap := min(a.bounds.Max.Y, b.bounds.Max.Y) - max(a.bounds.Min.Y, b.bounds.Min.Y)
+			if gap < 0 || float64(gap) > maxCharGap*float64(max(ha, hb)) ||
+				float64(overlap) < minCharOverlap*float64(min(ha, hb)) ||
+				float64(max(ha, hb)) > maxCharHeightRatio*float64(min(ha, hb)) {
+				continue
+			}
+			if gap < bestGap {
+				best, bestGap = j, gap
+			}
+		}
+		if best >= 0 {
+			parent[find(best)] = find(i)
+		}
+	}
+	groups := map[int][]component{}
+	for i := range chars {
+		groups[find(i)] = append(groups[find(i)], chars[i])
+	}
+
+	var layout textLayout
+	for _, group := range groups {
+		if len(group) < minLineChars {
+			continue
+		}
+		if line, ok := measureTextLine(labels, w, group); ok {
+			layout.lines = append(layout.lines, line)
+		}
+	}
+	sort.Slice(layout.lines, func(i, j int) bool {
+		a, b := layout.lines[i].bounds, layout.lines[j].bounds
+		return a.Min.Y < b.Min.Y || a.Min.Y == b.Min.Y && a.Min.X < b.Min.X
+	})
+	layout.blocks = groupTextBlocks(layout.lines)
+	return layout
+}
+
+// measureTextLine fits the baseline of a chain of characters to the bottoms of those
+// sitting on it and takes the x-height from the dense band of ink above it
+func measureTextLine(labels []int32, w int, chars []component) (textLine, bool) {
+	heights := make([]int, len(chars))
+	line := textLine{bounds: chars[0].bounds}
+	for i, c := range chars {
+		heights[i] = c.bounds.Dy()
+		line.bounds = line.bounds.Union(c.bounds)
+	}
+	sort.Ints(heights)
+	median := float64(heights[len(heights)/2])
+
+	// Least squares through the character bottoms, refitted without the descenders and
+	// punctuation that miss the first fit
+	fit := func(keep func(c component) bool) (float64, float64, bool) {
+		var n, sx, sy, sxx, sxy float64
+		for _, c := range chars {
+			if !keep(c) {
+				continue
+			}
+			x, y := float64(c.bounds.Min.X+c.bounds.Max.X)/2, float64(c.bounds.Max.Y)
+			n, sx, sy, sxx, sxy = n+1, sx+x, sy+y, sxx+x*x, sxy+x*y
+		}
+		if n < 2 || n*sxx-sx*sx == 0 {
+			return sy / math.Max(n, 1), 0, n > 0
+		}
+		slope := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+		return (sy - slope*sx) / n, slope, true
+	}
+	intercept, slope, _ := fit(func(component) bool { return true })
+	intercept, slope, ok := fit(func(c component) bool {
+		x := float64(c.bounds.Min.X+c.bounds.Max.X) / 2
+		return math.Abs(float64(c.bounds.Max.Y)-(intercept+slope*x)) <= baselineTolerance*median
+	})
+	if !ok {
+		return textLine{}, false
+	}
+
+	// Ink heights above the baseline, in rows
+	span := line.bounds.Dy() + int(math.Abs(slope)*float64(line.bounds.Dx())) + 2
+	profile := make([]int, 2*span)
+	for _, c := range chars {
+		for y := c.bounds.Min.Y; y < c.bounds.Max.Y; y++ {
+			for x := c.bounds.Min.X; x < c.bounds.Max.X; x++ {
+				if labels[y*w+x] != c.label {
+					continue
+				}
+				d := int(math.Floor(intercept+slope*(float64(x)+0.5)-float64(y)-0.5)) + span
+				if d >= 0 && d < len(profile) {
+					profile[d]++
+				}
+			}
+		}
+	}
+	peak, lowest, highest := 0, len(profile), -1
+	for d, v := range profile {
+		if v > profile[peak] {
+			peak = d
+		}
+		if v > 0 {
+			lowest, highest = min(lowest, d), max(highest, d)
+		}
+	}
+	bottom, top := peak, peak
+	threshold := xHeightBandShare * float64(profile[peak])
+	for bottom > 0 && float64(profile[bottom-1]) >= threshold {
+		bottom--
+	}
+	for top+1 < len(profile) && float64(profile[top+1]) >= threshold {
+		top++
+	}
+	line.xHeight = float64(top - bottom + 1)
+	if float64(highest-lowest+1) > maxLineHeightRatio*line.xHeight {
+		return textLine{}, false
+	}
+	line.area = float64(line.bounds.Dx()) * math.Hypot(1, slope) * float64(highest-lowest+1)
+	return line, true
+}
+
+// groupTextBlocks joins lines that overlap horizontally, follow each other closely and
+// share an x-height into blocks
+func groupTextBlocks(lines []textLine) []image.Rectangle {
+	parent := make([]int, len(lines))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, a := range lines {
+		for j := i + 1; j < len(lines); j++ {
+			b := lines[j]
+			gap := max(a.bounds.Min.Y, b.bounds.Min.Y) - min(a.bounds.Max.Y, b.bounds.Max.Y)
+			if a.bounds.Max.X <= b.bounds.Min.X || b.bounds.Max.X <= a.bounds.Min.X ||
+				float64(gap) > maxLineGap*float64(max(a.bounds.Dy(), b.bounds.Dy())) ||
+				math.Max(a.xHeight, b.xHeight) > maxLineXHeightRatio*math.Min(a.xHeight, b.xHeight) {
+				continue
+			}
+			parent[find(j)] = find(i)
+		}
+	}
+	var blocks []image.Rectangle
+	index := map[int]int{}
+	for i, line := range lines {
+		root := find(i)
+		if k, ok := index[root]; ok {
+			blocks[k] = blocks[k].Union(line.bounds)
+			continue
+		}
+		index[root] = len(blocks)
+		blocks = append(blocks, line.bounds)
+	}
+	return blocks
+}
+
+// applyTextAnalysis reports the text blocks, line count, coverage and median x-height
+func (a *imageAnalyzer) applyTextAnalysis(text *textLevel, result *AnalysisResult) {
+	layout := detectText(text)
+	result.TextLineCount = len(layout.lines)
+	if len(layout.lines) == 0 {
+		return
+	}
+	covered := 0.0
+	xHeights := make([]float64, len(layout.lines))
+	for i, line := range layout.lines {
+		covered += line.area
+		xHeights[i] = line.xHeight
+	}
+	sort.Float64s(xHeights)
+	result.XHeight = xHeights[len(xHeights)/2] * text.scale
+	result.TextCoverage = math.Min(1, covered/float64(text.ink.Rect.Dx()*text.ink.Rect.Dy()))
+	result.TextBlocks = make([]Region, len(layout.blocks))
+	for i, block := range layout.blocks {
+		result.TextBlocks[i] = regionFromRect(scaleRect(block, text.scale, text.origin))
+	}
+}
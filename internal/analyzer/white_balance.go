@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"image"
+	"math"
+)
+
+// Colour cast directions
+const (
+	CastNeutral = "neutral"
+	CastWarm    = "warm"
+	CastCool    = "cool"
+	CastGreen   = "green"
+	CastMagenta = "magenta"
+)
+
+const (
+	// whitePatchShare is the share of brightest pixels the white patch is averaged over
+	whitePatchShare = 0.02
+	// minWhitePatchLuma is the luma the white patch must reach to stand for the illuminant
+	minWhitePatchLuma = 100
+	// maxWhitePatchSaturation rejects white patches that are really bright coloured
+	// content, such as a red product filling the frame
+	maxWhitePatchSaturation = 0.5
+	// minCastAgreement is how much of the white patch's cast the gray world must share:
+	// an illuminant tints everything, while a colourful subject only moves the average
+	minCastAgreement = 0.5
+	// neutralCastStrength is the cast strength below which no direction is reported
+	neutralCastStrength = 0.05
+)
+
+// castVector is a colour in log-chromaticity axes: warmth is ln(R/B), tint is
+// ln(G/sqrt(R*B)); (0, 0) is neutral gray
+type castVector struct {
+	warmth, tint float64
+}
+
+// castOf returns the cast vector of an RGB triple
+func castOf(r, g, b float64) castVector {
+	r, g, b = math.Max(r, 1), math.Max(g, 1), math.Max(b, 1)
+	return castVector{warmth: math.Log(r / b), tint: math.Log(g / math.Sqrt(r*b))}
+}
+
+// strength returns the length of the cast vector
+func (c castVector) strength() float64 {
+	return math.Hypot(c.warmth, c.tint)
+}
+
+// direction names the dominant axis of the cast
+func (c castVector) direction() string {
+	switch {
+	case c.strength() < neutralCastStrength:
+		return CastNeutral
+	case math.Abs(c.warmth) >= math.Abs(c.tint) && c.warmth > 0:
+		return CastWarm
+	case math.Abs(c.warmth) >= math.Abs(c.tint):
+		return CastCool
+	case c.tint > 0:
+		return CastGreen
+	default:
+		return CastMagenta
+	}
+}
+
+// whitePatch averages the brightest unclipped pixels of the level, which on documents
+// and most photos are paper, walls or highlights that reflect the illuminant. ok is
+// false when they are too dark or too saturated to be neutral surfaces.
+func whitePatch(level *image.RGBA) (r, g, b float64, ok bool) {
+	rect := level.Bounds()
+	var hist [256]int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := level.Pix[level.PixOffset(rect.Min.X, y):level.PixOffset(rect.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			if max(row[i], row[i+1], row[i+2]) < highlightClipLevel {
+				hist[(299*int(row[i])+587*int(row[i+1])+114*int(row[i+2])+500)/1000]++
+			}
+		}
+	}
+	limit := percentileFromHistogram(hist[:], 1-whitePatchShare)
+	if limit < minWhitePatchLuma {
+		return 0, 0, 0, false
+	}
+
+	var sumR, sumG, sumB, sumSat, n float64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := level.Pix[level.PixOffset(rect.Min.X, y):level.PixOffset(rect.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			pr, pg, pb := int(row[i]), int(row[i+1]), int(row[i+2])
+			hi := max(pr, pg, pb)
+			if hi >= highlightClipLevel || (299*pr+587*pg+114*pb+500)/1000 < limit {
+				continue
+			}
+			sumR += float64(pr)
+			sumG += float64(pg)
+			sumB += float64(pb)
+			sumSat += float64(hi-min(pr, pg, pb)) / float64(hi)
+			n++
+		}
+	}
+	if n == 0 || sumSat/n > maxWhitePatchSaturation {
+		return 0, 0, 0, false
+	}
+	return sumR / n, sumG / n, sumB / n, true
+}
+
+// correlatedColorTemperature converts an sRGB illuminant estimate into a colour
+// temperature in Kelvin with McCamy's approximation
+func correlatedColorTemperature(r, g, b float64) float64 {
+	linear := func(v float64) float64 {
+		v /= 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := 0.4124*lr + 0.3576*lg + 0.1805*lb
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := 0.0193*lr + 0.1192*lg + 0.9505*lb
+	if x+y+z == 0 {
+		return 0
+	}
+	cx, cy := x/(x+y+z), y/(x+y+z)
+	n := (cx - 0.3320) / (0.1858 - cy)
+	cct := 449*n*n*n + 3525*n*n + 6823.3*n + 5520.33
+	return math.Max(1000, math.Min(25000, cct))
+}
+
+// applyWhiteBalanceAnalysis estimates the illuminant from the white patch, falling back
+// to the gray world (the channel means), and reports its colour temperature and cast.
+// The image only counts as badly balanced when the white patch is tinted and the gray
+// world shares that tint; without a white patch a cast cannot be told apart from
+// colourful content, so none is flagged.
+func (a *imageAnalyzer) applyWhiteBalanceAnalysis(level *image.RGBA, m metrics, profile QualityProfile, result *AnalysisResult) {
+	grayWorld := castOf(m.avgR, m.avgG, m.avgB)
+	r, g, b, ok := whitePatch(level)
+	if !ok {
+		r, g, b = m.avgR, m.avgG, m.avgB
+	}
+
+	cast := castOf(r, g, b)
+	result.ColorTemperature = correlatedColorTemperature(r, g, b)
+	result.ColorCast = cast.direction()
+	result.ColorCastStrength = cast.strength()
+	if !ok || result.ColorCastStrength <= profile.MaxColorCast {
+		return
+	}
+	shared := (grayWorld.warmth*cast.warmth + grayWorld.tint*cast.tint) / result.ColorCastStrength
+	result.IncorrectWB = shared >= minCastAgreement*result.ColorCastStrength
+}
@@ -1,18 +1,27 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"net/http"
 	"time"
+
+	"golang.org/x/image/tiff"
 )
 
+// MaxImageSize is the largest encoded image, in bytes, that is downloaded
+const MaxImageSize = 50 << 20
+
 type ImageFetcher interface {
 	FetchImage(ctx context.Context, imageURL string) (image.Image, error)
+	// FetchImageData returns the encoded image bytes without decoding them
+	FetchImageData(ctx context.Context, imageURL string) ([]byte, error)
 }
 
 type HTTPImageFetcher struct {
@@ -39,13 +48,21 @@ func NewHTTPImageFetcher() ImageFetcher {
 }
 
 func (h *HTTPImageFetcher) FetchImage(ctx context.Context, imageURL string) (image.Image, error) {
+	data, err := h.FetchImageData(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeImage(data)
+}
+
+func (h *HTTPImageFetcher) FetchImageData(ctx context.Context, imageURL string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 
 	// Set headers for proper image handling
-	req.Header.Set("Accept", "image/jpeg, image/png, image/webp, */*")
+	req.Header.Set("Accept", "image/jpeg, image/png, image/tiff, image/webp, */*")
 	req.Header.Set("User-Agent", "Go-Image-Inspector/1.0")
 
 	resp, err := h.client.Do(req)
@@ -58,10 +75,55 @@ func (h *HTTPImageFetcher) FetchImage(ctx context.Context, imageURL string) (ima
 		return nil, fmt.Errorf("unexpected status code %d when fetching image from %s", resp.StatusCode, imageURL)
 	}
 
-	img, _, err := image.Decode(resp.Body)
+	if resp.ContentLength > MaxImageSize {
+		return nil, fmt.Errorf("image at %s is %d bytes, larger than the %d byte limit", imageURL, resp.ContentLength, MaxImageSize)
+	}
+
+	// Read one byte past the limit to tell a file of exactly the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image from %s: %w", imageURL, err)
+	}
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("image at %s is larger than the %d byte limit", imageURL, MaxImageSize)
+	}
+
+	return data, nil
+}
+
+// DecodeImage decodes encoded image bytes in any registered format; of a multi-page TIFF
+// only the first page is decoded
+func DecodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
 	return img, nil
 }
+
+// DecodeImagePages decodes every page of a multi-page TIFF, in order, and any other image
+// as a single page
+func DecodeImagePages(data []byte) ([]image.Image, error) {
+	offsets, order, ok, err := tiffPageOffsets(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if !ok {
+		img, err := DecodeImage(data)
+		if err != nil {
+			return nil, err
+		}
+		return []image.Image{img}, nil
+	}
+
+	pages := make([]image.Image, len(offsets))
+	for i, offset := range offsets {
+		page, err := tiff.Decode(newTIFFPageReader(data, order, offset))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page %d: %w", i+1, err)
+		}
+		pages[i] = page
+	}
+	return pages, nil
+}
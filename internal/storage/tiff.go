@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// TIFF tags written by EncodeBilevelTIFF, in the ascending order the IFD requires
+const (
+	tiffImageWidth                = 256
+	tiffImageLength               = 257
+	tiffBitsPerSample             = 258
+	tiffCompression               = 259
+	tiffPhotometricInterpretation = 262
+	tiffStripOffsets              = 273
+	tiffSamplesPerPixel           = 277
+	tiffRowsPerStrip              = 278
+	tiffStripByteCounts           = 279
+	tiffXResolution               = 282
+	tiffYResolution               = 283
+	tiffResolutionUnit            = 296
+)
+
+// TIFF field types and values
+const (
+	tiffShort       = 3
+	tiffLong        = 4
+	tiffRational    = 5
+	tiffPackBits    = 32773
+	tiffBlackIsZero = 1
+	tiffInch        = 2
+)
+
+// tiffDefaultDPI is the resolution recorded when none is given
+const tiffDefaultDPI = 72
+
+// EncodeBilevelTIFF writes img as a baseline bilevel TIFF: one bit per pixel, PackBits
+// compressed, in a single strip. Pixels with a gray value of at least 128 are white.
+// dpi is recorded as the resolution (0 = 72).
+func EncodeBilevelTIFF(w io.Writer, img image.Image, dpi int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return fmt.Errorf("cannot encode an empty image")
+	}
+	if dpi <= 0 {
+		dpi = tiffDefaultDPI
+	}
+
+	white := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y >= 128
+	}
+	// Paletted images, such as binarization output, only need each palette entry converted
+	if p, ok := img.(*image.Paletted); ok {
+		isWhite := make([]bool, len(p.Palette))
+		for i, c := range p.Palette {
+			isWhite[i] = color.GrayModel.Convert(c).(color.Gray).Y >= 128
+		}
+		white = func(x, y int) bool {
+			i := int(p.Pix[p.PixOffset(x, y)])
+			return i < len(isWhite) && isWhite[i]
+		}
+	}
+
+	// Rows are packed separately, as the PackBits scheme requires
+	var strip bytes.Buffer
+	row := make([]byte, (width+7)/8)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		clear(row)
+		for x := 0; x < width; x++ {
+			if white(bounds.Min.X+x, y) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		packBits(&strip, row)
+	}
+
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+	// Header, then the strip, then the IFD on a word boundary, then the resolution values
+	stripOffset := uint32(8)
+	ifdOffset := stripOffset + uint32(strip.Len())
+	ifdOffset += ifdOffset % 2
+	entries := []entry{
+		{tiffImageWidth, tiffLong, uint32(width)},
+		{tiffImageLength, tiffLong, uint32(height)},
+		{tiffBitsPerSample, tiffShort, 1},
+		{tiffCompression, tiffShort, tiffPackBits},
+		{tiffPhotometricInterpretation, tiffShort, tiffBlackIsZero},
+		{tiffStripOffsets, tiffLong, stripOffset},
+		{tiffSamplesPerPixel, tiffShort, 1},
+		{tiffRowsPerStrip, tiffLong, uint32(height)},
+		{tiffStripByteCounts, tiffLong, uint32(strip.Len())},
+		{tiffXResolution, tiffRational, 0},
+		{tiffYResolution, tiffRational, 0},
+		{tiffResolutionUnit, tiffShort, tiffInch},
+	}
+	resolutionOffset := ifdOffset + 2 + 12*uint32(len(entries)) + 4
+	entries[9].value = resolutionOffset
+	entries[10].value = resolutionOffset + 8
+
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	le := binary.LittleEndian
+	buf.Write(le.AppendUint16(nil, 42))
+	buf.Write(le.AppendUint32(nil, ifdOffset))
+	buf.Write(strip.Bytes())
+	if buf.Len() < int(ifdOffset) {
+		buf.WriteByte(0)
+	}
+
+	buf.Write(le.AppendUint16(nil, uint16(len(entries))))
+	for _, e := range entries {
+		buf.Write(le.AppendUint16(nil, e.tag))
+		buf.Write(le.AppendUint16(nil, e.typ))
+		buf.Write(le.AppendUint32(nil, 1))
+		// Values shorter than four bytes are left-aligned in the value field
+		if e.typ == tiffShort {
+			buf.Write(le.AppendUint16(nil, uint16(e.value)))
+			buf.Write([]byte{0, 0})
+		} else {
+			buf.Write(le.AppendUint32(nil, e.value))
+		}
+	}
+	// No further IFDs
+	buf.Write(le.AppendUint32(nil, 0))
+	for i := 0; i < 2; i++ {
+		buf.Write(le.AppendUint32(nil, uint32(dpi)))
+		buf.Write(le.AppendUint32(nil, 1))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// packBits appends data to buf compressed with the PackBits run-length scheme: a header
+// n in 0..127 precedes n+1 literal bytes, and -1..-127 precedes one byte repeated 1-n times
+func packBits(buf *bytes.Buffer, data []byte) {
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+		if run > 1 {
+			buf.WriteByte(byte(int8(1 - run)))
+			buf.WriteByte(data[i])
+			i += run
+			continue
+		}
+
+		// Literal bytes up to the next run of at least two
+		start := i
+		for i < len(data) && i-start < 128 && (i+1 >= len(data) || data[i+1] != data[i]) {
+			i++
+		}
+		buf.WriteByte(byte(i - start - 1))
+		buf.Write(data[start:i])
+	}
+}
+
+// MaxTIFFPages is the most pages read from a multi-page TIFF
+const MaxTIFFPages = 50
+
+// tiffPageOffsets returns the offsets of the IFDs of a TIFF file, one per page, and the
+// file's byte order; ok is false for other formats
+func tiffPageOffsets(data []byte) (offsets []uint32, order binary.ByteOrder, ok bool, err error) {
+	if len(data) < 8 {
+		return nil, nil, false, nil
+	}
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, nil, false, nil
+	}
+
+	seen := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:]); offset != 0; {
+		if seen[offset] {
+			return nil, nil, true, fmt.Errorf("TIFF pages loop back to the IFD at %d", offset)
+		}
+		if len(offsets) == MaxTIFFPages {
+			return nil, nil, true, fmt.Errorf("TIFF has more than %d pages", MaxTIFFPages)
+		}
+		if int64(offset)+2 > int64(len(data)) {
+			return nil, nil, true, fmt.Errorf("TIFF IFD at %d is past the end of the file", offset)
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+		next := int64(offset) + 2 + 12*int64(order.Uint16(data[offset:]))
+		if next+4 > int64(len(data)) {
+			return nil, nil, true, fmt.Errorf("TIFF IFD at %d runs past the end of the file", offset)
+		}
+		offset = order.Uint32(data[next:])
+	}
+	if len(offsets) == 0 {
+		return nil, nil, true, fmt.Errorf("TIFF has no pages")
+	}
+	return offsets, order, true, nil
+}
+
+// tiffPageReader reads a TIFF file as if its header pointed at the IFD of a later page;
+// the TIFF decoder only reads the first
+type tiffPageReader struct {
+	data   []byte
+	header [8]byte
+	pos    int64
+}
+
+func newTIFFPageReader(data []byte, order binary.ByteOrder, offset uint32) *tiffPageReader {
+	r := &tiffPageReader{data: data}
+	copy(r.header[:], data[:4])
+	order.PutUint32(r.header[4:], offset)
+	return r
+}
+
+func (r *tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off < int64(len(r.header)) {
+		copy(p, r.header[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *tiffPageReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// unpackBits reverses packBits, failing on a header that runs past the data
+func unpackBits(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(int8(data[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(data) {
+				t.Fatalf("literal run of %d bytes at %d overruns %d bytes", n+1, i-1, len(data))
+			}
+			out = append(out, data[i:i+n+1]...)
+			i += n + 1
+		case n > -128:
+			if i >= len(data) {
+				t.Fatalf("repeat run at %d has no byte", i-1)
+			}
+			out = append(out, bytes.Repeat(data[i:i+1], 1-n)...)
+			i++
+		default:
+			t.Fatalf("no-op header at %d", i-1)
+		}
+	}
+	return out
+}
+
+func TestPackBits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	distinct := make([]byte, 300)
+	for i := range distinct {
+		distinct[i] = byte(i)
+	}
+	random := make([]byte, 1000)
+	r.Read(random)
+	mixed := append(append(append([]byte{1, 2, 3}, bytes.Repeat([]byte{7}, 130)...), 4, 5), bytes.Repeat([]byte{0}, 2)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		// headers are the run headers the encoding must start with
+		headers []int8
+	}{
+		{"single byte", []byte{9}, []int8{0}},
+		{"repeat run", bytes.Repeat([]byte{0xff}, 5), []int8{-4}},
+		{"repeat run over 128 bytes", bytes.Repeat([]byte{0}, 300), []int8{-127, -127, -43}},
+		{"literal run over 128 bytes", distinct, []int8{127}},
+		{"literals then repeats", mixed, []int8{2, -127, -1, 1, -1}},
+		{"random bytes", random, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			packBits(&buf, tt.data)
+			encoded := buf.Bytes()
+			if got := unpackBits(t, encoded); !bytes.Equal(got, tt.data) {
+				t.Fatalf("round trip gave %d bytes, want the %d bytes packed", len(got), len(tt.data))
+			}
+
+			var headers []int8
+			for i := 0; i < len(encoded) && len(headers) < len(tt.headers); {
+				n := int8(encoded[i])
+				headers = append(headers, n)
+				if n >= 0 {
+					i += int(n) + 2
+				} else {
+					i += 2
+				}
+			}
+			for i := range tt.headers {
+				if i >= len(headers) || headers[i] != tt.headers[i] {
+					t.Fatalf("run headers %v, want %v", headers, tt.headers)
+				}
+			}
+		})
+	}
+}
+
+// bilevelTestImage returns a w x h gray image with white pixels where white reports true
+func bilevelTestImage(w, h int, white func(x, y int) bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if white(x, y) {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestEncodeBilevelTIFFLayout(t *testing.T) {
+	// 13 pixels do not fill two bytes, so each row ends in padding bits
+	img := bilevelTestImage(13, 3, func(x, y int) bool { return (x+y)%3 == 0 })
+	var buf bytes.Buffer
+	if err := EncodeBilevelTIFF(&buf, img, 300); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	le := binary.LittleEndian
+
+	if string(data[:2]) != "II" || le.Uint16(data[2:]) != 42 {
+		t.Fatalf("header % x, want little-endian TIFF", data[:4])
+	}
+	ifd := int(le.Uint32(data[4:]))
+	if ifd%2 != 0 {
+		t.Errorf("IFD at odd offset %d", ifd)
+	}
+
+	count := int(le.Uint16(data[ifd:]))
+	values := make(map[uint16]uint32, count)
+	prev := -1
+	for i := 0; i < count; i++ {
+		e := data[ifd+2+12*i:]
+		tag, typ := le.Uint16(e), le.Uint16(e[2:])
+		if int(tag) <= prev {
+			t.Errorf("tag %d follows tag %d; the IFD must be sorted", tag, prev)
+		}
+		prev = int(tag)
+		if n := le.Uint32(e[4:]); n != 1 {
+			t.Errorf("tag %d has %d values, want 1", tag, n)
+		}
+		if typ == tiffShort {
+			values[tag] = uint32(le.Uint16(e[8:]))
+		} else {
+			values[tag] = le.Uint32(e[8:])
+		}
+	}
+	if next := le.Uint32(data[ifd+2+12*count:]); next != 0 {
+		t.Errorf("next IFD offset %d, want 0", next)
+	}
+
+	want := map[uint16]uint32{
+		tiffImageWidth:                13,
+		tiffImageLength:               3,
+		tiffBitsPerSample:             1,
+		tiffCompression:               tiffPackBits,
+		tiffPhotometricInterpretation: tiffBlackIsZero,
+		tiffStripOffsets:              8,
+		tiffSamplesPerPixel:           1,
+		tiffRowsPerStrip:              3,
+		tiffResolutionUnit:            tiffInch,
+	}
+	for tag, v := range want {
+		if values[tag] != v {
+			t.Errorf("tag %d = %d, want %d", tag, values[tag], v)
+		}
+	}
+	for _, tag := range []uint16{tiffXResolution, tiffYResolution} {
+		off := values[tag]
+		if num, den := le.Uint32(data[off:]), le.Uint32(data[off+4:]); num != 300 || den != 1 {
+			t.Errorf("tag %d = %d/%d, want 300/1", tag, num, den)
+		}
+	}
+
+	// The strip runs from its offset to the IFD, less the padding byte
+	offset, length := values[tiffStripOffsets], values[tiffStripByteCounts]
+	if end := int(offset + length); end != ifd && end+1 != ifd {
+		t.Errorf("strip ends at %d, IFD starts at %d", end, ifd)
+	}
+	rows := unpackBits(t, data[offset:offset+length])
+	if len(rows) != 3*2 {
+		t.Fatalf("strip unpacks to %d bytes, want 2 per row", len(rows))
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 13; x++ {
+			bit := rows[2*y+x/8]&(0x80>>(x%8)) != 0
+			if want := (x+y)%3 == 0; bit != want {
+				t.Errorf("pixel (%d, %d) white = %v, want %v", x, y, bit, want)
+			}
+		}
+	}
+}
+
+func TestEncodeBilevelTIFFDecodes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// Random pixels give literal runs and the solid bands repeat runs of over 128 bytes
+	noise := make([]bool, 1100*40)
+	for i := range noise {
+		noise[i] = r.Intn(2) == 0
+	}
+	tests := []struct {
+		name  string
+		img   image.Image
+		white func(x, y int) bool
+	}{
+		{"random and solid rows", nil, func(x, y int) bool {
+			switch {
+			case y < 10:
+				return true
+			case y < 20:
+				return false
+			default:
+				return noise[y*1100+x]
+			}
+		}},
+		{"paletted", image.NewPaletted(image.Rect(0, 0, 1100, 40), color.Palette{color.Black, color.White}), func(x, y int) bool {
+			return (x/7+y/5)%2 == 0
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.img
+			switch p := img.(type) {
+			case nil:
+				img = bilevelTestImage(1100, 40, tt.white)
+			case *image.Paletted:
+				for y := 0; y < 40; y++ {
+					for x := 0; x < 1100; x++ {
+						if tt.white(x, y) {
+							p.SetColorIndex(x, y, 1)
+						}
+					}
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeBilevelTIFF(&buf, img, 0); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := tiff.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := decoded.Bounds(); b.Dx() != 1100 || b.Dy() != 40 {
+				t.Fatalf("decoded %dx%d, want 1100x40", b.Dx(), b.Dy())
+			}
+			for y := 0; y < 40; y++ {
+				for x := 0; x < 1100; x++ {
+					got := color.GrayModel.Convert(decoded.At(x, y)).(color.Gray).Y == 255
+					if got != tt.white(x, y) {
+						t.Fatalf("pixel (%d, %d) white = %v, want %v", x, y, got, !got)
+					}
+				}
+			}
+		})
+	}
+
+	if err := EncodeBilevelTIFF(&bytes.Buffer{}, image.NewGray(image.Rect(0, 0, 0, 5)), 0); err == nil {
+		t.Error("an empty image was encoded")
+	}
+}
+
+// grayTIFFPages writes pages as an uncompressed 8-bit gray TIFF with one IFD per page in
+// the given byte order; next, when set, replaces the last page's link to the next IFD
+func grayTIFFPages(order binary.ByteOrder, pages []*image.Gray, next *uint32) []byte {
+	var buf bytes.Buffer
+	put16 := func(v uint16) {
+		var b [2]byte
+		order.PutUint16(b[:], v)
+		buf.Write(b[:])
+	}
+	put32 := func(v uint32) {
+		var b [4]byte
+		order.PutUint32(b[:], v)
+		buf.Write(b[:])
+	}
+	if order == binary.ByteOrder(binary.LittleEndian) {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	put16(42)
+	put32(0)
+	link := 4
+	for _, page := range pages {
+		w, h := page.Bounds().Dx(), page.Bounds().Dy()
+		stripOffset := uint32(buf.Len())
+		for y := 0; y < h; y++ {
+			buf.Write(page.Pix[y*page.Stride : y*page.Stride+w])
+		}
+		if buf.Len()%2 != 0 {
+			buf.WriteByte(0)
+		}
+		order.PutUint32(buf.Bytes()[link:], uint32(buf.Len()))
+
+		entries := [][3]uint32{
+			{tiffImageWidth, tiffLong, uint32(w)},
+			{tiffImageLength, tiffLong, uint32(h)},
+			{tiffBitsPerSample, tiffShort, 8},
+			{tiffCompression, tiffShort, 1},
+			{tiffPhotometricInterpretation, tiffShort, tiffBlackIsZero},
+			{tiffStripOffsets, tiffLong, stripOffset},
+			{tiffSamplesPerPixel, tiffShort, 1},
+			{tiffRowsPerStrip, tiffLong, uint32(h)},
+			{tiffStripByteCounts, tiffLong, uint32(w * h)},
+		}
+		put16(uint16(len(entries)))
+		for _, e := range entries {
+			put16(uint16(e[0]))
+			put16(uint16(e[1]))
+			put32(1)
+			if e[1] == tiffShort {
+				put16(uint16(e[2]))
+				buf.Write([]byte{0, 0})
+			} else {
+				put32(e[2])
+			}
+		}
+		link = buf.Len()
+		put32(0)
+	}
+	if next != nil {
+		order.PutUint32(buf.Bytes()[link:], *next)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeImagePages(t *testing.T) {
+	// Each page has its own size and a gray level of 40 times its number
+	pages := make([]*image.Gray, 3)
+	for i := range pages {
+		pages[i] = image.NewGray(image.Rect(0, 0, 20+i, 10+2*i))
+		for j := range pages[i].Pix {
+			pages[i].Pix[j] = uint8(40 * (i + 1))
+		}
+		pages[i].Pix[0] = 255
+	}
+
+	for _, tt := range []struct {
+		name  string
+		order binary.ByteOrder
+	}{
+		{"little-endian", binary.LittleEndian},
+		{"big-endian", binary.BigEndian},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeImagePages(grayTIFFPages(tt.order, pages, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded) != len(pages) {
+				t.Fatalf("decoded %d pages, want %d", len(decoded), len(pages))
+			}
+			for i, page := range decoded {
+				b := page.Bounds()
+				if b.Dx() != 20+i || b.Dy() != 10+2*i {
+					t.Errorf("page %d is %dx%d, want %dx%d", i+1, b.Dx(), b.Dy(), 20+i, 10+2*i)
+				}
+				corner := color.GrayModel.Convert(page.At(0, 0)).(color.Gray).Y
+				inside := color.GrayModel.Convert(page.At(5, 5)).(color.Gray).Y
+				if corner != 255 || inside != uint8(40*(i+1)) {
+					t.Errorf("page %d has gray %d and %d, want 255 and %d", i+1, corner, inside, 40*(i+1))
+				}
+			}
+		})
+	}
+
+	t.Run("single page", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeBilevelTIFF(&buf, pages[0], 0); err != nil {
+			t.Fatal(err)
+		}
+		if decoded, err := DecodeImagePages(buf.Bytes()); err != nil || len(decoded) != 1 {
+			t.Errorf("decoded %d pages, error %v; want 1 page", len(decoded), err)
+		}
+	})
+
+	loop := uint32(8 + 20*10)
+	past := uint32(1 << 20)
+	many := make([]*image.Gray, MaxTIFFPages+1)
+	for i := range many {
+		many[i] = pages[0]
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"pages that loop", grayTIFFPages(binary.LittleEndian, pages[:2], &loop)},
+		{"a page past the end", grayTIFFPages(binary.LittleEndian, pages[:2], &past)},
+		{"too many pages", grayTIFFPages(binary.LittleEndian, many, nil)},
+		{"no pages", []byte("II*\x00\x00\x00\x00\x00")},
+		{"not an image", []byte("not an image at all")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if decoded, err := DecodeImagePages(tt.data); err == nil {
+				t.Errorf("decoded %d pages without an error", len(decoded))
+			}
+		})
+	}
+}
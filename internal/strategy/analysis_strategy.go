@@ -67,10 +67,9 @@ func NewFastAnalysisStrategy(analyzer analyzer.ImageAnalyzer) AnalysisStrategy {
 	}
 }
 
-// Analyze performs fast analysis
+// Analyze performs fast analysis on a downscaled pyramid level with sampled sharpness tiles
 func (s *FastAnalysisStrategy) Analyze(img image.Image) analyzer.AnalysisResult {
-	// For fast analysis, we use standard mode but could optimize further
-	return s.analyzer.Analyze(img, false)
+	return s.analyzer.AnalyzeWithOptions(img, analyzer.AnalysisOptions{Mode: analyzer.ModeFast})
 }
 
 // GetStrategyName returns the strategy name
@@ -1,11 +1,17 @@
 package transport
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"go-image-inspector/internal/analyzer"
@@ -36,6 +42,104 @@ type AnalysisRequest struct {
 	URL          string `json:"url" binding:"required,url"`
 	IsOCR        bool   `json:"is_ocr,omitempty"`
 	ExpectedText string `json:"expected_text,omitempty"`
+	// Value a QR code on the document must carry, such as the application ID
+	ExpectedQR string `json:"expected_qr,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+	// Physical size of the photographed document, overriding the profile's, for the
+	// effective DPI check
+	DocumentSize string `json:"document_size,omitempty"`
+	// Turn a sideways or upside-down page upright before analyzing it
+	AutoRotate bool `json:"auto_rotate,omitempty"`
+	// Regional sharpness grid and heatmap output
+	GridRows       int  `json:"grid_rows,omitempty"`
+	GridCols       int  `json:"grid_cols,omitempty"`
+	IncludeHeatmap bool `json:"include_heatmap,omitempty"`
+	// Return the luma and RGB histograms
+	IncludeHistograms bool `json:"include_histograms,omitempty"`
+}
+
+// maxBatchPages is the most pages, over all images, a batch request analyzes
+const maxBatchPages = storage.MaxTIFFPages
+
+type BatchAnalysisRequest struct {
+	// Images to analyze, each page of a multi-page TIFF on its own
+	URLs         []string `json:"urls" binding:"required,min=1,max=20,dive,required,url"`
+	IsOCR        bool     `json:"is_ocr,omitempty"`
+	Mode         string   `json:"mode,omitempty"`
+	Profile      string   `json:"profile,omitempty"`
+	DocumentSize string   `json:"document_size,omitempty"`
+	AutoRotate   bool     `json:"auto_rotate,omitempty"`
+	// Leave blank pages out of the full analysis
+	SkipBlank bool `json:"skip_blank,omitempty"`
+}
+
+type BatchPage struct {
+	URL string `json:"url"`
+	// Page number within the image, from 1; 0 when the image could not be read
+	Page int `json:"page"`
+	// Blank is set for a BLANK verdict; near-blank pages are analyzed as usual
+	Blank   bool                     `json:"blank"`
+	Skipped bool                     `json:"skipped,omitempty"`
+	Result  *analyzer.AnalysisResult `json:"result,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+type BatchAnalysisResponse struct {
+	Pages      []BatchPage `json:"pages"`
+	BlankPages int         `json:"blank_pages"`
+}
+
+type RectifyRequest struct {
+	URL string `json:"url" binding:"required,url"`
+	// Document outline clockwise from the top-left corner; detected when omitted
+	Corners []analyzer.Point `json:"corners,omitempty"`
+	// Output size: a paper format fixes the aspect ratio, and with a DPI also the size
+	PaperSize string `json:"paper_size,omitempty"`
+	DPI       int    `json:"dpi,omitempty"`
+	// Output encoding: jpeg (default) or png, with the JPEG quality
+	Format  string `json:"format,omitempty"`
+	Quality int    `json:"quality,omitempty"`
+}
+
+type RectifyResponse struct {
+	Corners      [4]analyzer.Point `json:"corners"`
+	Detected     bool              `json:"detected"`
+	CornerCutOff bool              `json:"corner_cut_off"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	Format       string            `json:"format"`
+	// Image is the encoded output, base64 in JSON
+	Image []byte `json:"image"`
+}
+
+type EnhanceRequest struct {
+	URL string `json:"url" binding:"required,url"`
+	// Pipeline steps to run, always in pipeline order; all when omitted
+	Steps []string `json:"steps,omitempty"`
+	// Output colour format: gray (default), color or binary
+	Output string `json:"output,omitempty"`
+	// Binary output threshold: sauvola (default), niblack or otsu, and the local window size
+	Binarization string `json:"binarization,omitempty"`
+	Window       int    `json:"window,omitempty"`
+	// Profile the before and after analyses are judged against; ocr when omitted
+	Profile string `json:"profile,omitempty"`
+	// Output encoding: png (default), jpeg or, for binary output, tiff
+	Format  string `json:"format,omitempty"`
+	Quality int    `json:"quality,omitempty"`
+}
+
+type EnhanceResponse struct {
+	Applied        []analyzer.EnhanceStep `json:"applied"`
+	SkewCorrection float64                `json:"skew_correction"`
+	Output         analyzer.EnhanceOutput `json:"output"`
+	Width          int                    `json:"width"`
+	Height         int                    `json:"height"`
+	Format         string                 `json:"format"`
+	// Image is the encoded output, base64 in JSON
+	Image  []byte                  `json:"image"`
+	Before analyzer.AnalysisResult `json:"before"`
+	After  analyzer.AnalysisResult `json:"after"`
 }
 
 type ErrorResponse struct {
@@ -55,6 +159,9 @@ func NewHandler(analyzer analyzer.ImageAnalyzer, fetcher storage.ImageFetcher, c
 	// Configure routes
 	r.GET("/health", healthCheck)
 	r.POST("/analyze", analyzeImage(analyzer, fetcher, cfg))
+	r.POST("/analyze/batch", analyzeBatch(analyzer, fetcher, cfg))
+	r.POST("/rectify", rectifyImage(analyzer, fetcher, cfg))
+	r.POST("/enhance", enhanceImage(analyzer, fetcher, cfg))
 
 	return r
 }
@@ -100,39 +207,27 @@ func analyzeImage(a analyzer.ImageAnalyzer, f storage.ImageFetcher, cfg *config.
 			req.IsOCR = isOCRQuery == "true"
 		}
 
+		opts, ok := analysisOptions(c, req)
+		if !ok {
+			return
+		}
+
 		// Log image fetch attempt
 		logger.WithFields(logrus.Fields{
 			"url":    req.URL,
 			"is_ocr": req.IsOCR,
+			"mode":   opts.Mode,
 		}).Debug("Fetching image")
 
-		img, err := f.FetchImage(ctx, req.URL)
-		if err != nil {
-			// Wrap network/fetch errors with custom error type
-			var fetchErr *apperrors.AppError
-			if errors.Is(err, context.DeadlineExceeded) {
-				fetchErr = apperrors.NewTimeoutError("Image fetch timeout", err)
-			} else {
-				fetchErr = apperrors.NewNetworkError("Failed to fetch image", err)
-			}
-
-			logger.WithError(fetchErr).WithFields(logrus.Fields{
-				"url": req.URL,
-				"ip":  c.ClientIP(),
-			}).Error("Failed to fetch image")
-
-			respondError(c, fetchErr.StatusCode, "failed to fetch image", fetchErr)
+		img, data, ok := fetchImage(ctx, c, f, req.URL)
+		if !ok {
 			return
 		}
+		// The encoded bytes let the analyzer inspect format-level details such as JPEG tables
+		opts.ImageData = data
 
-		var result analyzer.AnalysisResult
-		if req.IsOCR {
-			// Use OCR analysis when isOCR is true
-			result = a.AnalyzeWithOCR(img, req.ExpectedText)
-		} else {
-			// Use regular analysis when isOCR is false
-			result = a.Analyze(img, false)
-		}
+		// OCR requests are validated against the OCR quality conditions
+		result := a.AnalyzeWithOptions(img, opts)
 
 		// Log successful completion
 		duration := time.Since(startTime)
@@ -143,12 +238,433 @@ func analyzeImage(a analyzer.ImageAnalyzer, f storage.ImageFetcher, cfg *config.
 			"overexposed":        result.Overexposed,
 			"oversaturated":      result.Oversaturated,
 			"blurry":             result.Blurry,
+			"blur_verdict":       result.BlurVerdict,
 		}).Info("Image analysis completed successfully")
 
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// analysisOptions builds the analyzer options of a request, responding with the matching
+// error and returning false when a value is invalid
+func analysisOptions(c *gin.Context, req AnalysisRequest) (analyzer.AnalysisOptions, bool) {
+	mode, err := analyzer.ParseAnalysisMode(req.Mode)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid analysis mode", apperrors.NewValidationError("Invalid analysis mode", err))
+		return analyzer.AnalysisOptions{}, false
+	}
+
+	opts := analyzer.AnalysisOptions{
+		IsOCR:             req.IsOCR,
+		ExpectedText:      req.ExpectedText,
+		ExpectedQRPayload: req.ExpectedQR,
+		Mode:              mode,
+		AutoRotate:        req.AutoRotate,
+		SharpnessGridRows: req.GridRows,
+		SharpnessGridCols: req.GridCols,
+		IncludeHeatmap:    req.IncludeHeatmap,
+		IncludeHistograms: req.IncludeHistograms,
+	}
+	if req.Profile != "" {
+		profile, err := analyzer.LookupProfile(req.Profile)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid profile", apperrors.NewValidationError("Invalid profile", err))
+			return analyzer.AnalysisOptions{}, false
+		}
+		opts.Profile = &profile
+	}
+	if req.DocumentSize != "" {
+		size, err := analyzer.LookupPaperSize(req.DocumentSize)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid document size", apperrors.NewValidationError("Invalid document size", err))
+			return analyzer.AnalysisOptions{}, false
+		}
+		if opts.Profile == nil {
+			profile := analyzer.DefaultProfile(req.IsOCR)
+			opts.Profile = &profile
+		}
+		opts.Profile.DocumentSize = &size
+	}
+	if err := opts.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid analysis options", apperrors.NewValidationError("Invalid analysis options", err))
+		return analyzer.AnalysisOptions{}, false
+	}
+	return opts, true
+}
+
+func analyzeBatch(a analyzer.ImageAnalyzer, f storage.ImageFetcher, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.RequestTimeout)
+		defer cancel()
+
+		var req BatchAnalysisRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid request format", err)
+			return
+		}
+		for _, imageURL := range req.URLs {
+			if err := validateImageURL(imageURL); err != nil {
+				respondError(c, apperrors.GetStatusCode(err), "invalid image URL", err)
+				return
+			}
+		}
+		opts, ok := analysisOptions(c, AnalysisRequest{
+			IsOCR:        req.IsOCR,
+			Mode:         req.Mode,
+			Profile:      req.Profile,
+			DocumentSize: req.DocumentSize,
+			AutoRotate:   req.AutoRotate,
+		})
+		if !ok {
+			return
+		}
+
+		// Images that cannot be fetched or decoded are reported in their entry, so one bad
+		// URL does not fail the pages of the others
+		type input struct {
+			url   string
+			data  []byte
+			pages []image.Image
+			err   error
+		}
+		inputs := make([]input, len(req.URLs))
+		total := 0
+		for i, imageURL := range req.URLs {
+			inputs[i].url = imageURL
+			data, err := f.FetchImageData(ctx, imageURL)
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					respondError(c, http.StatusGatewayTimeout, "failed to fetch image", apperrors.NewTimeoutError("Image fetch timeout", err))
+					return
+				}
+				inputs[i].err = apperrors.NewNetworkError("Failed to fetch image", err)
+				continue
+			}
+			pages, err := storage.DecodeImagePages(data)
+			if err != nil {
+				inputs[i].err = apperrors.NewProcessingError("Failed to decode image", err)
+				continue
+			}
+			inputs[i].data, inputs[i].pages = data, pages
+			total += len(pages)
+		}
+		if total > maxBatchPages {
+			err := fmt.Errorf("%d pages, at most %d are analyzed per request", total, maxBatchPages)
+			respondError(c, http.StatusBadRequest, "too many pages", apperrors.NewValidationError("Too many pages", err))
+			return
+		}
+
+		response := BatchAnalysisResponse{Pages: make([]BatchPage, 0, total)}
+		for _, in := range inputs {
+			if in.err != nil {
+				logger.WithError(in.err).WithFields(logrus.Fields{
+					"url": in.url,
+					"ip":  c.ClientIP(),
+				}).Error("Failed to read batch image")
+				response.Pages = append(response.Pages, BatchPage{URL: in.url, Error: in.err.Error()})
+				continue
+			}
+			for i, img := range in.pages {
+				page := BatchPage{URL: in.url, Page: i + 1}
+				// A fast pass judges blankness on a smaller copy of the page, which still tells an
+				// empty page from one with a page number
+				if req.SkipBlank {
+					if quick := a.AnalyzeWithOptions(img, analyzer.AnalysisOptions{Mode: analyzer.ModeFast}); quick.BlankVerdict == analyzer.BlankVerdictBlank {
+						page.Blank, page.Skipped = true, true
+						response.BlankPages++
+						response.Pages = append(response.Pages, page)
+						continue
+					}
+				}
+				pageOpts := opts
+				// Format-level details such as JPEG tables describe single images only
+				if len(in.pages) == 1 {
+					pageOpts.ImageData = in.data
+				}
+				result := a.AnalyzeWithOptions(img, pageOpts)
+				page.Blank = result.BlankVerdict == analyzer.BlankVerdictBlank
+				if page.Blank {
+					response.BlankPages++
+				}
+				page.Result = &result
+				response.Pages = append(response.Pages, page)
+			}
+		}
+
+		logger.WithFields(logrus.Fields{
+			"images":             len(req.URLs),
+			"pages":              total,
+			"blank_pages":        response.BlankPages,
+			"skip_blank":         req.SkipBlank,
+			"processing_time_ms": time.Since(startTime).Milliseconds(),
+		}).Info("Batch analysis completed successfully")
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func rectifyImage(a analyzer.ImageAnalyzer, f storage.ImageFetcher, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.RequestTimeout)
+		defer cancel()
+
+		var req RectifyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid request format", err)
+			return
+		}
+		if err := validateImageURL(req.URL); err != nil {
+			respondError(c, apperrors.GetStatusCode(err), "invalid image URL", err)
+			return
+		}
+
+		var opts analyzer.RectifyOptions
+		if len(req.Corners) > 0 {
+			if len(req.Corners) != 4 {
+				respondError(c, http.StatusBadRequest, "invalid corners", apperrors.NewValidationError("Exactly four corners are required", nil))
+				return
+			}
+			corners := [4]analyzer.Point(req.Corners)
+			opts.Corners = &corners
+		}
+		if req.PaperSize != "" {
+			paper, err := analyzer.LookupPaperSize(req.PaperSize)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, "invalid paper size", apperrors.NewValidationError("Invalid paper size", err))
+				return
+			}
+			opts.PaperSize = &paper
+		}
+		opts.DPI = req.DPI
+		if err := opts.Validate(); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid rectify options", apperrors.NewValidationError("Invalid rectify options", err))
+			return
+		}
+
+		format, quality, err := parseImageFormat(req.Format, req.Quality, "jpeg", "png")
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid output format", apperrors.NewValidationError("Invalid output format", err))
+			return
+		}
+
+		img, _, ok := fetchImage(ctx, c, f, req.URL)
+		if !ok {
+			return
+		}
+
+		result, err := a.Rectify(img, opts)
+		if err != nil {
+			// A missing document is a property of the image; anything else stems from the
+			// requested corners or size
+			appErr := apperrors.NewValidationError("Failed to rectify image", err)
+			if errors.Is(err, analyzer.ErrNoDocument) {
+				appErr = apperrors.NewProcessingError("Failed to rectify image", err)
+			}
+			respondError(c, appErr.StatusCode, "failed to rectify image", appErr)
+			return
+		}
+
+		encoded, err := encodeImage(result.Image, format, quality)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "failed to encode image", apperrors.NewInternalError("Failed to encode image", err))
+			return
+		}
+
+		bounds := result.Image.Bounds()
+		logger.WithFields(logrus.Fields{
+			"url":                req.URL,
+			"detected":           result.Detected,
+			"width":              bounds.Dx(),
+			"height":             bounds.Dy(),
+			"processing_time_ms": time.Since(startTime).Milliseconds(),
+		}).Info("Image rectification completed successfully")
+
+		c.JSON(http.StatusOK, RectifyResponse{
+			Corners:      result.Corners,
+			Detected:     result.Detected,
+			CornerCutOff: result.CornerCutOff,
+			Width:        bounds.Dx(),
+			Height:       bounds.Dy(),
+			Format:       format,
+			Image:        encoded,
+		})
+	}
+}
+
+func enhanceImage(a analyzer.ImageAnalyzer, f storage.ImageFetcher, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.RequestTimeout)
+		defer cancel()
+
+		var req EnhanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid request format", err)
+			return
+		}
+		if err := validateImageURL(req.URL); err != nil {
+			respondError(c, apperrors.GetStatusCode(err), "invalid image URL", err)
+			return
+		}
+
+		// Both analyses judge OCR readiness, which is what the enhancement is for
+		opts := analyzer.EnhanceOptions{Analysis: analyzer.AnalysisOptions{IsOCR: true}}
+		if req.Steps != nil {
+			opts.Steps = make([]analyzer.EnhanceStep, 0, len(req.Steps))
+			for _, value := range req.Steps {
+				step, err := analyzer.ParseEnhanceStep(value)
+				if err != nil {
+					respondError(c, http.StatusBadRequest, "invalid enhancement step", apperrors.NewValidationError("Invalid enhancement step", err))
+					return
+				}
+				opts.Steps = append(opts.Steps, step)
+			}
+		}
+		output, err := analyzer.ParseEnhanceOutput(req.Output)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid output", apperrors.NewValidationError("Invalid output", err))
+			return
+		}
+		opts.Output = output
+		method, err := analyzer.ParseBinarizationMethod(req.Binarization)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid binarization method", apperrors.NewValidationError("Invalid binarization method", err))
+			return
+		}
+		opts.Binarization = analyzer.BinarizeOptions{Method: method, Window: req.Window}
+		if req.Profile != "" {
+			profile, err := analyzer.LookupProfile(req.Profile)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, "invalid profile", apperrors.NewValidationError("Invalid profile", err))
+				return
+			}
+			opts.Analysis.Profile = &profile
+		}
+		if err := opts.Validate(); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid enhancement options", apperrors.NewValidationError("Invalid enhancement options", err))
+			return
+		}
+
+		format, quality, err := parseImageFormat(req.Format, req.Quality, "png", "jpeg", "tiff")
+		if err == nil && format == "tiff" && output != analyzer.OutputBinary {
+			err = fmt.Errorf("tiff output requires binary output")
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid output format", apperrors.NewValidationError("Invalid output format", err))
+			return
+		}
+
+		img, data, ok := fetchImage(ctx, c, f, req.URL)
+		if !ok {
+			return
+		}
+		opts.Analysis.ImageData = data
+
+		result, err := a.Enhance(img, opts)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "failed to enhance image", apperrors.NewValidationError("Failed to enhance image", err))
+			return
+		}
+
+		encoded, err := encodeImage(result.Image, format, quality)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "failed to encode image", apperrors.NewInternalError("Failed to encode image", err))
+			return
+		}
+
+		bounds := result.Image.Bounds()
+		logger.WithFields(logrus.Fields{
+			"url":                req.URL,
+			"applied":            result.Applied,
+			"output":             output,
+			"processing_time_ms": time.Since(startTime).Milliseconds(),
+		}).Info("Image enhancement completed successfully")
+
+		c.JSON(http.StatusOK, EnhanceResponse{
+			Applied:        result.Applied,
+			SkewCorrection: result.SkewCorrection,
+			Output:         output,
+			Width:          bounds.Dx(),
+			Height:         bounds.Dy(),
+			Format:         format,
+			Image:          encoded,
+			Before:         result.Before,
+			After:          result.After,
+		})
+	}
+}
+
+// parseImageFormat validates an output format against the allowed ones, the first of
+// which is the default, and the JPEG quality
+func parseImageFormat(format string, quality int, allowed ...string) (string, int, error) {
+	if format == "" {
+		format = allowed[0]
+	}
+	if !slices.Contains(allowed, format) {
+		return "", 0, fmt.Errorf("unknown format %q (expected %s)", format, strings.Join(allowed, ", "))
+	}
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+	if quality < 1 || quality > 100 {
+		return "", 0, fmt.Errorf("quality must be between 1 and 100")
+	}
+	return format, quality, nil
+}
+
+// encodeImage encodes img as PNG, as JPEG at the given quality, or as a bilevel TIFF
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "tiff":
+		err = storage.EncodeBilevelTIFF(&buf, img, 0)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	return buf.Bytes(), err
+}
+
+// fetchImage downloads and decodes the image at imageURL, responding with the matching
+// error and returning false when either step fails
+func fetchImage(ctx context.Context, c *gin.Context, f storage.ImageFetcher, imageURL string) (image.Image, []byte, bool) {
+	data, err := f.FetchImageData(ctx, imageURL)
+	if err != nil {
+		// Wrap network/fetch errors with custom error type
+		var fetchErr *apperrors.AppError
+		if errors.Is(err, context.DeadlineExceeded) {
+			fetchErr = apperrors.NewTimeoutError("Image fetch timeout", err)
+		} else {
+			fetchErr = apperrors.NewNetworkError("Failed to fetch image", err)
+		}
+
+		logger.WithError(fetchErr).WithFields(logrus.Fields{
+			"url": imageURL,
+			"ip":  c.ClientIP(),
+		}).Error("Failed to fetch image")
+
+		respondError(c, fetchErr.StatusCode, "failed to fetch image", fetchErr)
+		return nil, nil, false
+	}
+
+	img, err := storage.DecodeImage(data)
+	if err != nil {
+		decodeErr := apperrors.NewProcessingError("Failed to decode image", err)
+		logger.WithError(decodeErr).WithFields(logrus.Fields{
+			"url": imageURL,
+			"ip":  c.ClientIP(),
+		}).Error("Failed to decode image")
+
+		respondError(c, decodeErr.StatusCode, "failed to decode image", decodeErr)
+		return nil, nil, false
+	}
+	return img, data, true
+}
+
 func healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "available",